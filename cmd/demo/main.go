@@ -143,8 +143,8 @@ func createSampleWorkflow() *graph.DAG {
 
 	// Layer 2: DNS resolution (sequential)
 	dag.AddNodeAtPosition("subfinder-1", "dnsx-1", "dnsx", "-l {{input}} -resp -a -silent -o {{output}}", 2, 0, "", false)
-	dag.Nodes["assetfinder-1"].Children = append(dag.Nodes["assetfinder-1"].Children, "dnsx-1")
-	dag.Nodes["amass-1"].Children = append(dag.Nodes["amass-1"].Children, "dnsx-1")
+	dag.AddEdge("assetfinder-1", "dnsx-1")
+	dag.AddEdge("amass-1", "dnsx-1")
 
 	// Layer 3: Web probing
 	dag.AddNodeAtPosition("dnsx-1", "httpx-1", "httpx", "-l {{input}} -title -tech-detect -silent -o {{output}}", 3, 0, "", false)
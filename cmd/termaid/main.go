@@ -1,21 +1,77 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"os"
 
 	tea "github.com/charmbracelet/bubbletea"
 
+	"github.com/MKlolbullen/termaid/internal/secrets"
 	"github.com/MKlolbullen/termaid/internal/tui"
 )
 
 func main() {
+	noCache := flag.Bool("no-cache", false, "run every tool even if a cached result exists")
+	concurrency := flag.Int("concurrency", 6, "maximum number of tools running at once")
+	targetConcurrency := flag.Int("target-concurrency", 2, "maximum number of targets scanned at once")
+	scopeFile := flag.String("scope", "", "JSON scope file that overrides the workflow's scope")
+	force := flag.Bool("force", false, "run workflows even if validation finds structural problems")
+	flag.Func("var", "set a workflow variable, as name=value (repeatable)", tui.SetVar)
+	flag.Parse()
+
+	if *noCache {
+		tui.DisableCache()
+	}
+	if *force {
+		tui.ForceInvalid()
+	}
+	tui.SetConcurrency(*concurrency)
+	tui.SetTargetConcurrency(*targetConcurrency)
+	if *scopeFile != "" {
+		if err := tui.SetScopeFile(*scopeFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// termaid secrets set|list|rm manages the encrypted API key store
+	if args := flag.Args(); len(args) > 0 && args[0] == "secrets" {
+		if err := runSecrets(args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if path, err := secrets.DefaultPath(); err == nil {
+		if _, err := os.Stat(path); err == nil {
+			if err := askPassphrase(); err != nil {
+				log.Fatal(err)
+			}
+		}
+		store, err := secrets.Open(path)
+		if err != nil {
+			log.Fatalf("cannot open secrets: %v", err)
+		}
+		tui.UseSecrets(store)
+	}
+
+	var first tea.Model = tui.NewMenu()
+
+	// termaid resume <run-id> continues an interrupted run
+	if args := flag.Args(); len(args) == 2 && args[0] == "resume" {
+		first, _ = tui.ResumeRun(args[1])
+	}
+
 	prog := tea.NewProgram(
-		tui.NewMenu(),
+		first,
 		tea.WithAltScreen(),
 		tea.WithMouseAllMotion(), // ← mouse support
 	)
 
-	if err := prog.Start(); err != nil {
+	_, err := prog.Run()
+	// however the program ended, take any running tools down with it
+	tui.StopRuns()
+	if err != nil {
 		log.Fatal(err)
 	}
 }
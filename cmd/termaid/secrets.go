@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/x/term"
+
+	"github.com/MKlolbullen/termaid/internal/secrets"
+)
+
+const secretsUsage = `usage:
+  termaid secrets set NAME [VALUE]   store a secret (VALUE is read from stdin when omitted)
+  termaid secrets list               list stored secret names
+  termaid secrets rm NAME            delete a secret
+
+The store is encrypted with $TERMAID_SECRETS_PASSPHRASE, prompted for when
+unset on a terminal.`
+
+// runSecrets implements the termaid secrets subcommand.
+func runSecrets(args []string) error {
+	path, err := secrets.DefaultPath()
+	if err != nil {
+		return err
+	}
+	if err := askPassphrase(); err != nil {
+		return err
+	}
+	store, err := secrets.Open(path)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		for _, name := range store.Names() {
+			fmt.Println(name)
+		}
+		return nil
+
+	case len(args) >= 2 && len(args) <= 3 && args[0] == "set":
+		value := ""
+		if len(args) == 3 {
+			value = args[2]
+		} else {
+			// reading from stdin keeps the value out of shell history
+			if value, err = readValue("value for " + args[1]); err != nil {
+				return err
+			}
+		}
+		if err := store.Set(args[1], value); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "stored %s in %s\n", args[1], path)
+		return nil
+
+	case len(args) == 2 && args[0] == "rm":
+		return store.Remove(args[1])
+	}
+
+	return fmt.Errorf("%s", secretsUsage)
+}
+
+// askPassphrase prompts for the store passphrase when stdin is a terminal
+// and $TERMAID_SECRETS_PASSPHRASE is unset.
+func askPassphrase() error {
+	if os.Getenv(secrets.PassphraseEnv) != "" || !term.IsTerminal(os.Stdin.Fd()) {
+		return nil
+	}
+	pass, err := readValue("secrets passphrase")
+	if err != nil {
+		return err
+	}
+	return os.Setenv(secrets.PassphraseEnv, pass)
+}
+
+// readValue prompts on stderr and reads one line from stdin, without echo
+// when stdin is a terminal.
+func readValue(prompt string) (string, error) {
+	fmt.Fprintf(os.Stderr, "%s: ", prompt)
+	if fd := os.Stdin.Fd(); term.IsTerminal(fd) {
+		value, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("cannot read %s: %w", prompt, err)
+		}
+		return string(value), nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("no %s given", prompt)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
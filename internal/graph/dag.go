@@ -1,6 +1,11 @@
 package graph
 
-import "fmt"
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
 
 // Node represents a workflow vertex with 2D matrix positioning.
 type Node struct {
@@ -14,32 +19,112 @@ type Node struct {
 	SubX     int      `json:"sub_x"`    // X position within subgraph
 	SubY     int      `json:"sub_y"`    // Y position within subgraph
 	Parallel bool     `json:"parallel"` // can run in parallel with other nodes
+	Tee      bool     `json:"tee"`      // mirror stdout into the live log
+	Shell    bool     `json:"shell"`    // run args through /bin/sh -c (pipes, redirection)
+	In       string   `json:"in"`       // data type the node reads (domain, hosts, urls, …)
+	Out      string   `json:"out"`      // data type the node writes
+	Parser   string   `json:"parser"`   // structured parser of its output (nuclei, httpx, …)
+
+	// nil timeout, retries and backoff_delay take the catalog's, so an
+	// explicit 0 can still turn a catalog default off
+	Timeout      *int   `json:"timeout"`       // seconds per attempt (0 = no limit)
+	Retries      *int   `json:"retries"`       // extra attempts after a failure
+	Backoff      string `json:"backoff"`       // fixed, linear or exponential
+	BackoffDelay *int   `json:"backoff_delay"` // base delay between attempts in seconds
+	CacheTTL     string `json:"cache_ttl"`     // result cache lifetime ("12h"); "off" disables the cache
+
+	Shard ShardSpec `json:"shard"` // split {{input}} into chunks run side by side
+
+	Conditions map[string]string `json:"conditions"` // child ID → condition for taking that edge
+
+	OnError    string `json:"on_error"`    // what a failure means for the run (OnError* values)
+	AcceptExit []int  `json:"accept_exit"` // exit codes besides 0 that count as success
+
+	SecretEnv   map[string]string `json:"secret_env"`   // environment variable → secret name
+	SecretFiles map[string]string `json:"secret_files"` // file in {{secret_dir}} → template using {{secret.NAME}}
+
+	Limits ResourceLimits `json:"limits"` // rlimits applied to the tool process
+}
+
+// Error policies for Node.OnError. An empty policy means OnErrorContinue.
+const (
+	OnErrorContinue        = "continue"             // log the failure and carry on
+	OnErrorSkipDescendants = "skip-descendants"     // take none of the node's outgoing edges
+	OnErrorAbort           = "abort-workflow"       // stop the whole run
+	OnErrorRequired        = "required-for-success" // the run fails unless this node succeeds
+)
+
+// Condition returns the condition on the edge to childID, or "" when the
+// edge is always taken.
+func (n *Node) Condition(childID string) string {
+	return n.Conditions[childID]
+}
+
+// ShardSpec splits a node's input either into a fixed number of chunks or
+// into chunks of a fixed number of lines; Lines wins when both are set. The
+// zero value disables sharding.
+type ShardSpec struct {
+	Chunks int `json:"chunks,omitempty"` // split into this many chunks
+	Lines  int `json:"lines,omitempty"`  // or into chunks of this many lines
+}
+
+// Enabled reports whether the spec splits the input at all.
+func (s ShardSpec) Enabled() bool { return s.Chunks > 1 || s.Lines > 0 }
+
+// ResourceLimits caps what a tool process may use. Zero fields are unlimited.
+// Limits apply per process, so a tool that forks gets them in every child.
+type ResourceLimits struct {
+	CPUSeconds int `json:"cpu_seconds,omitempty" yaml:"cpu_seconds"`   // CPU time
+	MemoryMB   int `json:"memory_mb,omitempty" yaml:"memory_mb"`       // address space
+	OpenFiles  int `json:"open_files,omitempty" yaml:"open_files"`     // file descriptors
+	FileSizeMB int `json:"file_size_mb,omitempty" yaml:"file_size_mb"` // largest file the tool may write
 }
 
+// Set reports whether any limit is configured.
+func (l ResourceLimits) Set() bool { return l != ResourceLimits{} }
+
 // Coordinate represents a 2D position in the workflow matrix
 type Coordinate struct {
 	X int // Layer (horizontal)
 	Y int // Position (vertical)
 }
 
+// Scope limits which targets may flow between nodes. Hosts are matched
+// against domain globs ("*.example.com", which also covers example.com) or
+// CIDRs; an empty include list allows every host that is not excluded.
+type Scope struct {
+	Include      []string `json:"include,omitempty"`       // host globs or CIDRs
+	Exclude      []string `json:"exclude,omitempty"`       // host globs or CIDRs, checked first
+	IncludePaths []string `json:"include_paths,omitempty"` // URL path regexes
+	ExcludePaths []string `json:"exclude_paths,omitempty"` // URL path regexes, checked first
+	Ports        []int    `json:"ports,omitempty"`         // allowed ports
+	ExcludePorts []int    `json:"exclude_ports,omitempty"`
+}
+
 // SubgraphInfo contains metadata about a subgraph
 type SubgraphInfo struct {
-	ID          string            `json:"id"`
-	Name        string            `json:"name"`
-	Description string            `json:"description"`
-	Nodes       []string          `json:"nodes"`
-	Parallel    bool              `json:"parallel"`
-	Matrix      map[string]Coordinate `json:"matrix"` // node_id -> local coordinate
+	ID          string                `json:"id"`
+	Name        string                `json:"name"`
+	Description string                `json:"description"`
+	Nodes       []string              `json:"nodes"`
+	Parallel    bool                  `json:"parallel"`
+	MaxParallel int                   `json:"max_parallel,omitempty"` // nodes of this subgraph running at once (0 = unlimited)
+	Matrix      map[string]Coordinate `json:"matrix"`                 // node_id -> local coordinate
 }
 
 // DAG is a directed acyclic graph of nodes with matrix positioning.
 type DAG struct {
-	Nodes     map[string]*Node            `json:"nodes"`
-	Root      string                      `json:"root"`
-	Matrix    map[Coordinate][]*Node      `json:"matrix"`    // coordinate -> nodes at position
-	Subgraphs map[string]*SubgraphInfo    `json:"subgraphs"` // subgraph_id -> info
-	MaxX      int                         `json:"max_x"`     // maximum layer
-	MaxY      int                         `json:"max_y"`     // maximum position in any layer
+	Nodes     map[string]*Node         `json:"nodes"`
+	Root      string                   `json:"root"`
+	Matrix    map[Coordinate][]*Node   `json:"matrix"`    // coordinate -> nodes at position
+	Subgraphs map[string]*SubgraphInfo `json:"subgraphs"` // subgraph_id -> info
+	MaxX      int                      `json:"max_x"`     // maximum layer
+	MaxY      int                      `json:"max_y"`     // maximum position in any layer
+	Scope     *Scope                   `json:"scope"`     // targets allowed between nodes; nil allows all
+	Vars      map[string]string        `json:"variables"` // workflow variables → default values
+
+	mu      sync.Mutex          // guards parents
+	parents map[string][]string // child → parents, built on first use (see index)
 }
 
 // NewDAG with an implicit "input" root.
@@ -117,12 +202,87 @@ func (g *DAG) AddNodeAtPosition(parentID, nodeID, tool, args string, layer, posi
 	
 	g.Nodes[nodeID] = node
 	g.Nodes[parentID].Children = append(g.Nodes[parentID].Children, nodeID)
+	g.link(parentID, nodeID)
 	g.addToMatrix(node)
 	g.updateBounds(layer, position)
 	
 	return nil
 }
 
+// SpliceNode inserts a new node on the edge parentID → childID, so that the
+// parent feeds the new node and the new node feeds the child. A condition on
+// the edge stays with the parent. The new node goes one layer right of the
+// parent; the child and its descendants move right when that layer is theirs.
+func (g *DAG) SpliceNode(parentID, childID, nodeID, tool string) (*Node, error) {
+	parent, ok := g.Nodes[parentID]
+	if !ok {
+		return nil, fmt.Errorf("parent %q not found", parentID)
+	}
+	child, ok := g.Nodes[childID]
+	if !ok {
+		return nil, fmt.Errorf("child %q not found", childID)
+	}
+	if _, dup := g.Nodes[nodeID]; dup {
+		return nil, fmt.Errorf("node %q already exists", nodeID)
+	}
+	idx := slices.Index(parent.Children, childID)
+	if idx < 0 {
+		return nil, fmt.Errorf("no edge %s → %s", parentID, childID)
+	}
+
+	layer := parent.Layer + 1
+	if child.Layer <= layer {
+		g.shiftRight(childID, layer+1-child.Layer, make(map[string]bool))
+	}
+
+	pos := g.getNextPosition(layer, "")
+	for len(g.Matrix[Coordinate{X: layer, Y: pos}]) > 0 {
+		pos++
+	}
+
+	node := &Node{
+		ID:       nodeID,
+		Tool:     tool,
+		Children: []string{childID},
+		Layer:    layer,
+		Position: pos,
+	}
+
+	parent.Children[idx] = nodeID
+	g.unlink(parentID, childID)
+	if cond, ok := parent.Conditions[childID]; ok {
+		delete(parent.Conditions, childID)
+		parent.Conditions[nodeID] = cond
+	}
+
+	g.Nodes[nodeID] = node
+	g.link(parentID, nodeID)
+	g.link(nodeID, childID)
+	g.addToMatrix(node)
+	g.updateBounds(node.Layer, node.Position)
+
+	return node, nil
+}
+
+// shiftRight moves a node and everything below it dx layers to the right,
+// keeping each node's position unless another node already holds it.
+func (g *DAG) shiftRight(id string, dx int, moved map[string]bool) {
+	node, ok := g.Nodes[id]
+	if !ok || moved[id] {
+		return
+	}
+	moved[id] = true
+
+	pos := node.Position
+	for len(g.Matrix[Coordinate{X: node.Layer + dx, Y: pos}]) > 0 {
+		pos++
+	}
+	_ = g.MoveNode(id, node.Layer+dx, pos)
+	for _, c := range node.Children {
+		g.shiftRight(c, dx, moved)
+	}
+}
+
 // Helper methods for matrix management
 
 // addToMatrix adds a node to the coordinate matrix.
@@ -337,6 +497,7 @@ func (g *DAG) RemoveNode(id string) error {
 		}
 		n.Children = dst
 	}
+	g.Reindex()
 	
 	// Recalculate bounds
 	g.recalculateBounds()
@@ -468,3 +629,50 @@ func (g *DAG) GetSubgraphNodes(subgraphID string) []*Node {
 	}
 	return []*Node{}
 }
+
+// Clone returns a deep copy of g that shares no nodes, slices or maps with
+// it, so one copy can run while the other is edited.
+func (g *DAG) Clone() *DAG {
+	c := &DAG{
+		Nodes:     make(map[string]*Node, len(g.Nodes)),
+		Root:      g.Root,
+		Matrix:    make(map[Coordinate][]*Node, len(g.Matrix)),
+		Subgraphs: make(map[string]*SubgraphInfo, len(g.Subgraphs)),
+		MaxX:      g.MaxX,
+		MaxY:      g.MaxY,
+		Vars:      maps.Clone(g.Vars),
+	}
+	if g.Scope != nil {
+		scope := *g.Scope
+		scope.Include = slices.Clone(scope.Include)
+		scope.Exclude = slices.Clone(scope.Exclude)
+		scope.IncludePaths = slices.Clone(scope.IncludePaths)
+		scope.ExcludePaths = slices.Clone(scope.ExcludePaths)
+		scope.Ports = slices.Clone(scope.Ports)
+		scope.ExcludePorts = slices.Clone(scope.ExcludePorts)
+		c.Scope = &scope
+	}
+	for id, n := range g.Nodes {
+		node := *n
+		node.Children = slices.Clone(n.Children)
+		node.Conditions = maps.Clone(n.Conditions)
+		node.AcceptExit = slices.Clone(n.AcceptExit)
+		node.SecretEnv = maps.Clone(n.SecretEnv)
+		node.SecretFiles = maps.Clone(n.SecretFiles)
+		c.Nodes[id] = &node
+	}
+	for coord, nodes := range g.Matrix {
+		for _, n := range nodes {
+			if node, ok := c.Nodes[n.ID]; ok {
+				c.Matrix[coord] = append(c.Matrix[coord], node)
+			}
+		}
+	}
+	for id, sg := range g.Subgraphs {
+		info := *sg
+		info.Nodes = slices.Clone(sg.Nodes)
+		info.Matrix = maps.Clone(sg.Matrix)
+		c.Subgraphs[id] = &info
+	}
+	return c
+}
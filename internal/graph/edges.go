@@ -0,0 +1,224 @@
+package graph
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// AddEdge connects from to to, so to also reads from's output. The edge must
+// keep the graph acyclic: it is refused when to already reaches from. When to
+// is not right of from it moves right, with its descendants, to the layer
+// after from.
+func (g *DAG) AddEdge(from, to string) error {
+	parent, ok := g.Nodes[from]
+	if !ok {
+		return fmt.Errorf("node %q not found", from)
+	}
+	child, ok := g.Nodes[to]
+	if !ok {
+		return fmt.Errorf("node %q not found", to)
+	}
+	switch {
+	case to == g.Root:
+		return fmt.Errorf("cannot add an edge into %s", g.Root)
+	case from == to:
+		return fmt.Errorf("cannot connect %s to itself", from)
+	case slices.Contains(parent.Children, to):
+		return fmt.Errorf("edge %s → %s already exists", from, to)
+	}
+	if path := g.path(to, from); path != nil {
+		return fmt.Errorf("edge %s → %s would close the cycle %s", from, to, strings.Join(append([]string{from}, path...), " → "))
+	}
+
+	if child.Layer <= parent.Layer {
+		g.shiftRight(to, parent.Layer+1-child.Layer, make(map[string]bool))
+	}
+	parent.Children = append(parent.Children, to)
+	g.link(from, to)
+	return nil
+}
+
+// RemoveEdge disconnects from and to, dropping any condition on the edge. A
+// node left without parents reads from the root again.
+func (g *DAG) RemoveEdge(from, to string) error {
+	parent, ok := g.Nodes[from]
+	if !ok {
+		return fmt.Errorf("node %q not found", from)
+	}
+	if !slices.Contains(parent.Children, to) {
+		return fmt.Errorf("no edge %s → %s", from, to)
+	}
+
+	parent.Children = slices.DeleteFunc(parent.Children, func(c string) bool { return c == to })
+	delete(parent.Conditions, to)
+	g.unlink(from, to)
+	return nil
+}
+
+// Parents returns the nodes with an edge to id, ordered by layer, position
+// and ID. A node no edge points at has the root as its only parent, the way
+// workflow files leave it implicit; the root itself has none.
+func (g *DAG) Parents(id string) []string {
+	if _, ok := g.Nodes[id]; !ok || id == g.Root {
+		return nil
+	}
+	ps := g.explicitParents(id)
+	if len(ps) == 0 {
+		return []string{g.Root}
+	}
+	g.sortByPlace(ps)
+	return ps
+}
+
+// Ancestors returns every node id reads from, directly or not, sorted by ID.
+func (g *DAG) Ancestors(id string) []string {
+	return g.reach(id, g.Parents)
+}
+
+// Descendants returns every node that reads from id, directly or not, sorted
+// by ID. Nodes without parents descend from the root.
+func (g *DAG) Descendants(id string) []string {
+	return g.reach(id, g.children)
+}
+
+// children returns the nodes of id's outgoing edges, plus the parentless
+// nodes for the root.
+func (g *DAG) children(id string) []string {
+	var cs []string
+	for _, c := range g.Nodes[id].Children {
+		if _, ok := g.Nodes[c]; ok && c != g.Root {
+			cs = append(cs, c)
+		}
+	}
+	if id == g.Root {
+		for n := range g.Nodes {
+			if n != g.Root && len(g.explicitParents(n)) == 0 {
+				cs = append(cs, n)
+			}
+		}
+	}
+	return cs
+}
+
+func (g *DAG) reach(id string, next func(string) []string) []string {
+	if _, ok := g.Nodes[id]; !ok {
+		return nil
+	}
+	seen := map[string]bool{id: true}
+	queue := []string{id}
+	var out []string
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, n := range next(cur) {
+			if !seen[n] {
+				seen[n] = true
+				out = append(out, n)
+				queue = append(queue, n)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// path returns the nodes on a shortest edge path from → … → to, both ends
+// included, or nil when there is none.
+func (g *DAG) path(from, to string) []string {
+	prev := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if cur == to {
+			var path []string
+			for n := to; n != ""; n = prev[n] {
+				path = append([]string{n}, path...)
+			}
+			return path
+		}
+		for _, c := range g.Nodes[cur].Children {
+			if _, seen := prev[c]; !seen && g.Nodes[c] != nil {
+				prev[c] = cur
+				queue = append(queue, c)
+			}
+		}
+	}
+	return nil
+}
+
+// Reindex drops the parent index so the next query rebuilds it from
+// Children. Call it after editing Children by hand; AddEdge, RemoveEdge and
+// the node methods keep the index current themselves.
+func (g *DAG) Reindex() {
+	g.mu.Lock()
+	g.parents = nil
+	g.mu.Unlock()
+}
+
+// explicitParents returns a copy of the nodes with an edge to id. The index
+// is guarded by g.mu, so a graph shared by several runs can be queried from
+// all of them at once.
+func (g *DAG) explicitParents(id string) []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return slices.Clone(g.index()[id])
+}
+
+// index returns the reverse index of explicit edges, child → parents,
+// building it from Children the first time. The edge methods keep it up to
+// date afterwards; dangling children and edges into the root are left out.
+// The caller holds g.mu.
+func (g *DAG) index() map[string][]string {
+	if g.parents != nil {
+		return g.parents
+	}
+	g.parents = make(map[string][]string, len(g.Nodes))
+	for id, n := range g.Nodes {
+		for _, c := range n.Children {
+			g.addParent(id, c)
+		}
+	}
+	return g.parents
+}
+
+// link records a new edge in the index, if it has been built.
+func (g *DAG) link(from, to string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.parents != nil {
+		g.addParent(from, to)
+	}
+}
+
+func (g *DAG) addParent(from, to string) {
+	if _, ok := g.Nodes[to]; !ok || to == g.Root || slices.Contains(g.parents[to], from) {
+		return
+	}
+	g.parents[to] = append(g.parents[to], from)
+}
+
+func (g *DAG) unlink(from, to string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.parents == nil {
+		return
+	}
+	g.parents[to] = slices.DeleteFunc(g.parents[to], func(p string) bool { return p == from })
+}
+
+// sortByPlace orders ids by layer, position and ID.
+func (g *DAG) sortByPlace(ids []string) {
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := g.Nodes[ids[i]], g.Nodes[ids[j]]
+		if a.Layer != b.Layer {
+			return a.Layer < b.Layer
+		}
+		if a.Position != b.Position {
+			return a.Position < b.Position
+		}
+		return a.ID < b.ID
+	})
+}
@@ -0,0 +1,194 @@
+package graph
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// edgeDAG builds input → a → c and input → b, with d → e hanging off the
+// root below them.
+func edgeDAG(t *testing.T) *DAG {
+	t.Helper()
+	g := NewDAG()
+	for _, n := range []struct {
+		parent, id string
+		layer      int
+	}{
+		{"input", "a", 1}, {"input", "b", 1}, {"a", "c", 2}, {"input", "d", 1}, {"d", "e", 2},
+	} {
+		if err := g.AddNode(n.parent, n.id, n.id, "", n.layer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return g
+}
+
+// checkIndex compares the parent index with the edges in Children.
+func checkIndex(t *testing.T, g *DAG) {
+	t.Helper()
+	want := make(map[string][]string)
+	for id, n := range g.Nodes {
+		for _, c := range n.Children {
+			if _, ok := g.Nodes[c]; ok && c != g.Root {
+				want[c] = append(want[c], id)
+			}
+		}
+	}
+	for id := range g.Nodes {
+		if got := sorted(g.explicitParents(id)); !slices.Equal(got, sorted(want[id])) {
+			t.Errorf("index holds parents %q for %s, edges say %q", got, id, sorted(want[id]))
+		}
+	}
+}
+
+func TestAddEdge(t *testing.T) {
+	g := edgeDAG(t)
+	if err := g.AddEdge("b", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if got := g.Parents("c"); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("Parents(c) = %q, want [a b]", got)
+	}
+
+	// c is left of its new child d, so d and e move right
+	if err := g.AddEdge("c", "d"); err != nil {
+		t.Fatal(err)
+	}
+	if d, e := g.Nodes["d"], g.Nodes["e"]; d.Layer != 3 || e.Layer != 4 {
+		t.Errorf("d, e in layers %d, %d; want 3, 4", d.Layer, e.Layer)
+	}
+	checkIndex(t, g)
+
+	for _, tt := range []struct{ from, to, err string }{
+		{"b", "c", "already exists"},
+		{"a", "a", "to itself"},
+		{"a", "input", "into input"},
+		{"ghost", "a", `"ghost" not found`},
+		{"a", "ghost", `"ghost" not found`},
+	} {
+		if err := g.AddEdge(tt.from, tt.to); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("AddEdge(%s, %s) = %v, want %q", tt.from, tt.to, err, tt.err)
+		}
+	}
+}
+
+func TestAddEdgeCycle(t *testing.T) {
+	g := edgeDAG(t)
+	if err := g.AddEdge("c", "d"); err != nil {
+		t.Fatal(err)
+	}
+	before := g.Clone()
+
+	for _, tt := range []struct{ from, to, cycle string }{
+		{"c", "a", "c → a → c"},
+		{"e", "a", "e → a → c → d → e"},
+	} {
+		err := g.AddEdge(tt.from, tt.to)
+		if err == nil || !strings.Contains(err.Error(), tt.cycle) {
+			t.Errorf("AddEdge(%s, %s) = %v, want the cycle %s", tt.from, tt.to, err, tt.cycle)
+		}
+	}
+
+	// a refused edge leaves the graph as it was
+	for id, n := range g.Nodes {
+		b := before.Nodes[id]
+		if !slices.Equal(n.Children, b.Children) || n.Layer != b.Layer {
+			t.Errorf("%s changed to children %q in layer %d", id, n.Children, n.Layer)
+		}
+	}
+	checkIndex(t, g)
+	if problems := g.Validate(); len(problems) != 0 {
+		t.Errorf("Validate() = %v", problems)
+	}
+}
+
+func TestRemoveEdge(t *testing.T) {
+	g := edgeDAG(t)
+	if err := g.AddEdge("b", "c"); err != nil {
+		t.Fatal(err)
+	}
+	g.Nodes["a"].Conditions = map[string]string{"c": "lines > 0"}
+
+	if err := g.RemoveEdge("a", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if g.Nodes["a"].Condition("c") != "" {
+		t.Error("RemoveEdge kept the condition on a → c")
+	}
+	if got := g.Parents("c"); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("Parents(c) = %q, want [b]", got)
+	}
+
+	// without edges left c reads from the root again
+	if err := g.RemoveEdge("b", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if got := g.Parents("c"); !slices.Equal(got, []string{"input"}) {
+		t.Errorf("Parents(c) = %q, want [input]", got)
+	}
+	if err := g.RemoveEdge("b", "c"); err == nil {
+		t.Error("removing a missing edge succeeded")
+	}
+	checkIndex(t, g)
+}
+
+func TestAncestorsDescendants(t *testing.T) {
+	g := edgeDAG(t)
+	if err := g.AddEdge("c", "e"); err != nil {
+		t.Fatal(err)
+	}
+	if got := g.Ancestors("e"); !slices.Equal(got, []string{"a", "c", "d", "input"}) {
+		t.Errorf("Ancestors(e) = %q", got)
+	}
+	if got := g.Descendants("a"); !slices.Equal(got, []string{"c", "e"}) {
+		t.Errorf("Descendants(a) = %q", got)
+	}
+	if got := g.Descendants("input"); !slices.Equal(got, []string{"a", "b", "c", "d", "e"}) {
+		t.Errorf("Descendants(input) = %q", got)
+	}
+}
+
+func TestParentIndex(t *testing.T) {
+	g := edgeDAG(t)
+	_ = g.Parents("c") // build the index before editing
+
+	steps := []func() error{
+		func() error { return g.AddEdge("b", "c") },
+		func() error { return g.AddEdge("b", "e") },
+		func() error { _, err := g.SpliceNode("b", "c", "s", "s"); return err },
+		func() error { return g.RemoveEdge("d", "e") },
+		func() error { return g.AddNode("s", "f", "f", "", 3) },
+		func() error { return g.RemoveNode("b") },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		checkIndex(t, g)
+	}
+	if got := g.Parents("c"); !slices.Equal(got, []string{"a", "s"}) {
+		t.Errorf("Parents(c) = %q, want [a s]", got)
+	}
+
+	// edits made straight to Children show up after Reindex
+	g.Nodes["a"].Children = append(g.Nodes["a"].Children, "e")
+	g.Reindex()
+	checkIndex(t, g)
+
+	// the index can be built and read from several goroutines at once
+	g.Reindex()
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range g.Nodes {
+				g.Parents(id)
+			}
+		}()
+	}
+	wg.Wait()
+	checkIndex(t, g)
+}
@@ -0,0 +1,171 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// layoutSweeps is how many barycenter passes AutoLayout makes, alternating
+// down and up the layers.
+const layoutSweeps = 8
+
+// AutoLayout places every node by the edges alone. A node's layer is the
+// length of the longest path to it from the root, so it sits right of all
+// of its parents; nodes without a parent hang off the root in layer 1.
+// Within each layer, nodes are ordered to cut edge crossings with
+// alternating barycenter sweeps and numbered from 0. Matrix, MaxX and MaxY
+// are rebuilt to match. A graph with a cycle cannot be laid out; children
+// that are not nodes are ignored.
+func (g *DAG) AutoLayout() error {
+	ids := g.sortedIDs()
+	if cycles := g.cycles(ids); len(cycles) > 0 {
+		c := cycles[0]
+		return fmt.Errorf("cannot lay out a cycle: %s", strings.Join(append(c, c[0]), " → "))
+	}
+
+	parents := make(map[string][]string, len(ids))
+	children := make(map[string][]string, len(ids))
+	link := func(p, c string) {
+		parents[c] = append(parents[c], p)
+		children[p] = append(children[p], c)
+	}
+	for _, id := range ids {
+		for _, c := range g.Nodes[id].Children {
+			if _, ok := g.Nodes[c]; ok && c != g.Root {
+				link(id, c)
+			}
+		}
+	}
+	for _, id := range ids {
+		if id != g.Root && len(parents[id]) == 0 {
+			link(g.Root, id)
+		}
+	}
+
+	// longest path from the root
+	layer := map[string]int{g.Root: 0}
+	var layerOf func(id string) int
+	layerOf = func(id string) int {
+		if l, ok := layer[id]; ok {
+			return l
+		}
+		l := 0
+		for _, p := range parents[id] {
+			l = max(l, layerOf(p)+1)
+		}
+		layer[id] = l
+		return l
+	}
+	maxLayer := 0
+	for _, id := range ids {
+		maxLayer = max(maxLayer, layerOf(id))
+	}
+
+	// start from the order the nodes had, so a layout already free of
+	// crossings is kept
+	layers := make([][]string, maxLayer+1)
+	for _, id := range ids {
+		layers[layer[id]] = append(layers[layer[id]], id)
+	}
+	for _, ids := range layers {
+		sort.SliceStable(ids, func(i, j int) bool {
+			a, b := g.Nodes[ids[i]], g.Nodes[ids[j]]
+			if a.Layer != b.Layer {
+				return a.Layer < b.Layer
+			}
+			return a.Position < b.Position
+		})
+	}
+
+	pos := make(map[string]int, len(ids))
+	number := func() {
+		for _, ids := range layers {
+			for i, id := range ids {
+				pos[id] = i
+			}
+		}
+	}
+	number()
+
+	best, bestCrossings := cloneLayers(layers), crossings(parents, layer, pos)
+	for sweep := 0; sweep < layoutSweeps && bestCrossings > 0; sweep++ {
+		if sweep%2 == 0 {
+			for l := 1; l <= maxLayer; l++ {
+				orderByBarycenter(layers[l], parents, pos)
+				number()
+			}
+		} else {
+			for l := maxLayer - 1; l >= 1; l-- {
+				orderByBarycenter(layers[l], children, pos)
+				number()
+			}
+		}
+		if c := crossings(parents, layer, pos); c < bestCrossings {
+			best, bestCrossings = cloneLayers(layers), c
+		}
+	}
+
+	g.Matrix = make(map[Coordinate][]*Node, len(ids))
+	for l, ids := range best {
+		for i, id := range ids {
+			n := g.Nodes[id]
+			n.Layer, n.Position = l, i
+			g.addToMatrix(n)
+		}
+	}
+	g.recalculateBounds()
+	return nil
+}
+
+// orderByBarycenter sorts a layer by the mean position of each node's
+// neighbours; nodes without any keep their place.
+func orderByBarycenter(ids []string, neighbours map[string][]string, pos map[string]int) {
+	bary := make(map[string]float64, len(ids))
+	for _, id := range ids {
+		ns := neighbours[id]
+		if len(ns) == 0 {
+			bary[id] = float64(pos[id])
+			continue
+		}
+		sum := 0
+		for _, n := range ns {
+			sum += pos[n]
+		}
+		bary[id] = float64(sum) / float64(len(ns))
+	}
+	sort.SliceStable(ids, func(i, j int) bool { return bary[ids[i]] < bary[ids[j]] })
+}
+
+// crossings counts pairs of edges between the same two layers that cross.
+func crossings(parents map[string][]string, layer map[string]int, pos map[string]int) int {
+	type edge struct{ from, to string }
+	spans := make(map[[2]int][]edge)
+	for c, ps := range parents {
+		for _, p := range ps {
+			span := [2]int{layer[p], layer[c]}
+			spans[span] = append(spans[span], edge{p, c})
+		}
+	}
+
+	n := 0
+	for _, edges := range spans {
+		for i := range edges {
+			for j := i + 1; j < len(edges); j++ {
+				a, b := edges[i], edges[j]
+				if (pos[a.from]-pos[b.from])*(pos[a.to]-pos[b.to]) < 0 {
+					n++
+				}
+			}
+		}
+	}
+	return n
+}
+
+func cloneLayers(layers [][]string) [][]string {
+	out := make([][]string, len(layers))
+	for i, ids := range layers {
+		out[i] = append([]string(nil), ids...)
+	}
+	return out
+}
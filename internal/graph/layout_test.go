@@ -0,0 +1,115 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAutoLayout(t *testing.T) {
+	tests := []struct {
+		name   string
+		layers map[string]int // starting place; AutoLayout ignores it
+		edges  map[string][]string
+		want   map[string]int // node → layer after layout
+	}{
+		{
+			name:   "chain",
+			layers: map[string]int{"a": 5, "b": 1, "c": 1},
+			edges:  map[string][]string{"input": {"a"}, "a": {"b"}, "b": {"c"}},
+			want:   map[string]int{"input": 0, "a": 1, "b": 2, "c": 3},
+		},
+		{
+			name:   "fan-in sits after its deepest parent",
+			layers: map[string]int{"a": 1, "b": 1, "c": 1, "d": 1},
+			edges:  map[string][]string{"input": {"a", "b"}, "a": {"c"}, "c": {"d"}, "b": {"d"}},
+			want:   map[string]int{"a": 1, "b": 1, "c": 2, "d": 3},
+		},
+		{
+			name:   "parentless nodes start in layer 1",
+			layers: map[string]int{"a": 4, "b": 0},
+			edges:  map[string][]string{"a": {"b"}},
+			want:   map[string]int{"a": 1, "b": 2},
+		},
+		{
+			name:   "dangling children are ignored",
+			layers: map[string]int{"a": 3},
+			edges:  map[string][]string{"input": {"a"}, "a": {"ghost"}},
+			want:   map[string]int{"a": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := buildDAG(tt.layers, tt.edges)
+			if err := g.AutoLayout(); err != nil {
+				t.Fatal(err)
+			}
+			for id, layer := range tt.want {
+				if got := g.Nodes[id].Layer; got != layer {
+					t.Errorf("%s in layer %d, want %d", id, got, layer)
+				}
+			}
+			checkLayout(t, g)
+		})
+	}
+}
+
+// checkLayout asserts what every layout must hold: each layer numbered from
+// 0 without gaps, the matrix and bounds matching the nodes, and a clean
+// Validate.
+func checkLayout(t *testing.T, g *DAG) {
+	t.Helper()
+	byLayer := make(map[int][]int)
+	maxX, maxY := 0, 0
+	for _, n := range g.Nodes {
+		byLayer[n.Layer] = append(byLayer[n.Layer], n.Position)
+		maxX, maxY = max(maxX, n.Layer), max(maxY, n.Position)
+		at := g.GetNodesAtCoordinate(Coordinate{X: n.Layer, Y: n.Position})
+		if len(at) != 1 || at[0] != n {
+			t.Errorf("matrix at %d,%d holds %v, want only %s", n.Layer, n.Position, at, n.ID)
+		}
+	}
+	for layer, ps := range byLayer {
+		seen := make(map[int]bool)
+		for _, p := range ps {
+			if p < 0 || p >= len(ps) || seen[p] {
+				t.Errorf("layer %d positions %v, want 0..%d", layer, ps, len(ps)-1)
+				break
+			}
+			seen[p] = true
+		}
+	}
+	if g.MaxX != maxX || g.MaxY != maxY {
+		t.Errorf("bounds %d×%d, want %d×%d", g.MaxX, g.MaxY, maxX, maxY)
+	}
+	for _, p := range g.Validate() {
+		if p.Kind != ProblemDanglingEdge {
+			t.Errorf("after layout: %s", p)
+		}
+	}
+}
+
+func TestAutoLayoutUncrosses(t *testing.T) {
+	// a feeds d and b feeds c, but d starts above c: the edges cross
+	g := buildDAG(
+		map[string]int{"a": 1, "b": 1, "c": 2, "d": 2},
+		map[string][]string{"input": {"a", "b"}, "a": {"d"}, "b": {"c"}},
+	)
+	g.Nodes["c"].Position, g.Nodes["d"].Position = 1, 0
+	if err := g.AutoLayout(); err != nil {
+		t.Fatal(err)
+	}
+
+	a, b, c, d := g.Nodes["a"], g.Nodes["b"], g.Nodes["c"], g.Nodes["d"]
+	if (a.Position < b.Position) != (d.Position < c.Position) {
+		t.Errorf("edges still cross: a@%d b@%d, d@%d c@%d", a.Position, b.Position, d.Position, c.Position)
+	}
+	checkLayout(t, g)
+}
+
+func TestAutoLayoutCycle(t *testing.T) {
+	g := buildDAG(map[string]int{"a": 1, "b": 2}, map[string][]string{"input": {"a"}, "a": {"b"}, "b": {"a"}})
+	err := g.AutoLayout()
+	if err == nil || !strings.Contains(err.Error(), "a → b → a") {
+		t.Errorf("AutoLayout() = %v, want the cycle a → b → a", err)
+	}
+}
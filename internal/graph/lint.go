@@ -0,0 +1,57 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LintIssue is a non-fatal problem found in a node's configuration.
+type LintIssue struct {
+	NodeID  string
+	Message string
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%s: %s", i.NodeID, i.Message)
+}
+
+// shellOperators are tokens that only mean something to a shell. Passed to a
+// tool directly they arrive as literal arguments.
+var shellOperators = []string{">>", ">", "<", "2>", "&>", "||", "|", "&&", ";"}
+
+// Lint reports node configurations that will not behave as written, sorted
+// by node ID.
+func (g *DAG) Lint() []LintIssue {
+	var issues []LintIssue
+	for _, n := range g.Nodes {
+		if n.ID == g.Root {
+			continue
+		}
+		if !n.Shell {
+			if ops := ShellOperators(n.Args); len(ops) > 0 {
+				issues = append(issues, LintIssue{
+					NodeID:  n.ID,
+					Message: fmt.Sprintf("args use shell syntax (%s) but the node is not in shell mode; set \"shell\": true", strings.Join(ops, " ")),
+				})
+			}
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool { return issues[i].NodeID < issues[j].NodeID })
+	return issues
+}
+
+// ShellOperators returns the redirection, pipe and sequencing operators found
+// in args, in order of appearance.
+func ShellOperators(args string) []string {
+	var found []string
+	for _, field := range strings.Fields(args) {
+		for _, op := range shellOperators {
+			if strings.HasPrefix(field, op) {
+				found = append(found, op)
+				break
+			}
+		}
+	}
+	return found
+}
@@ -0,0 +1,55 @@
+package graph
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestShellOperators(t *testing.T) {
+	tests := []struct {
+		args string
+		want []string
+	}{
+		{"-l {{input}} -silent -o {{output}}", nil},
+		{"-l {{input}} > out.txt", []string{">"}},
+		{"{{input}} 2>/dev/null | sort -u >>all.txt", []string{"2>", "|", ">>"}},
+		{"-x a && b ; c || d &> log <in", []string{"&&", ";", "||", "&>", "<"}},
+		{"-mc 200,301 -fr 'a|b'", nil}, // only whole words starting with an operator count
+	}
+	for _, tt := range tests {
+		if got := ShellOperators(tt.args); !slices.Equal(got, tt.want) {
+			t.Errorf("ShellOperators(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	g := NewDAG()
+	for _, n := range []struct {
+		id, args string
+		shell    bool
+	}{
+		{"b", "-l {{input}} > out.txt", false},
+		{"a", "-d {{domain}} | tee subs.txt", false},
+		{"c", "-l {{input}} | sort -u", true},
+		{"d", "-l {{input}} -o {{output}}", false},
+	} {
+		if err := g.AddNode(g.Root, n.id, "httpx", n.args, 1); err != nil {
+			t.Fatal(err)
+		}
+		g.Nodes[n.id].Shell = n.shell
+	}
+
+	issues := g.Lint()
+	var got []string
+	for _, i := range issues {
+		got = append(got, i.String())
+	}
+	want := []string{
+		`a: args use shell syntax (|) but the node is not in shell mode; set "shell": true`,
+		`b: args use shell syntax (>) but the node is not in shell mode; set "shell": true`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Lint() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,593 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/* ─────────────────────────── Mermaid import ─────────────────────────── */
+
+// ParseMermaid reads a Mermaid flowchart (graph or flowchart, any direction)
+// into a workflow:
+//
+//   - A node's label names its tool, and anything after the tool word or a
+//     line break in the label is its args; a node without a label runs the
+//     tool its ID names ("subfinder-1" → subfinder). The node "input" is the
+//     root.
+//   - Every link (-->, ---, -.->, ==>, …, chained or with &) is an edge. A
+//     label on it, |text| or "-- text -->", is the edge's condition, except
+//     "parallel", which marks the child parallel, and "sequential".
+//   - subgraph … end blocks group their nodes; the Layer N and Parallel Group
+//     blocks ToMermaid writes only carry layout and are not kept.
+//   - "%% termaid:" comments, as ToMermaid writes them, restore the workflow's
+//     scope and variables, subgraph settings and every field of a node.
+//   - %% comments of the form "%% <node>.<field>: <value>" set the tool, args,
+//     in, out, parser or shell of a node, overriding its label and metadata.
+//
+// When every node has termaid metadata its stored layer and position are
+// kept; otherwise they are derived from the edges with AutoLayout, in the
+// order the nodes first appear. Styling statements are ignored.
+func ParseMermaid(src string) (*DAG, error) {
+	p := &mermaidParser{g: NewDAG(), placed: make(map[string]bool)}
+	if err := p.parse(src); err != nil {
+		return nil, err
+	}
+	return p.g, nil
+}
+
+type mermaidParser struct {
+	g       *DAG
+	line    int
+	order   int      // nodes created so far, their initial position
+	groups  []string // open subgraphs, innermost last; "" for layout blocks
+	records []mermaidRecord
+	meta    []mermaidMeta
+	placed  map[string]bool // nodes whose coordinates came from metadata
+}
+
+// mermaidRecord is a "%% termaid: <kind> [<id>] <json>" comment.
+type mermaidRecord struct {
+	line           int
+	kind, id, data string
+}
+
+// mermaidMeta is a "%% node.field: value" comment, applied once every node
+// has been read.
+type mermaidMeta struct {
+	line               int
+	node, field, value string
+}
+
+var (
+	mermaidHeaderRe    = regexp.MustCompile(`^(?:graph|flowchart)(?:\s+(?:LR|RL|TD|TB|BT))?\s*(?:;|$)`)
+	mermaidRecordRe    = regexp.MustCompile(`^%%\s*termaid:\s*(\w+)\s+(?:(\S+)\s+)?(\{.*\})\s*$`)
+	mermaidMetaRe      = regexp.MustCompile(`^%%\s*(\S+)\.(tool|args|in|out|parser|shell)\s*:\s*(.*)$`)
+	mermaidLinkRe      = regexp.MustCompile(`^<?(?:-{2,}>|-{3,}|--[ox]|={2,}>|={3,}|==[ox]|-\.+->|-\.+-|~~~)`)
+	mermaidTextRe      = regexp.MustCompile(`^<?(--|==|-\.)\s*(.+?)\s*(-{2,}>|-{3,}|={2,}>|={3,}|\.+->|\.+-)`)
+	mermaidLayoutRe    = regexp.MustCompile(`^(?:L\d+|P\d+_\d+)$`)
+	mermaidBreakRe     = regexp.MustCompile(`\\n|<br\s*/?>`)
+	mermaidEntityRe    = regexp.MustCompile(`#(\w+);`)
+	mermaidEntityEndRe = regexp.MustCompile(`#\w+$`)
+	mermaidIDSuffix    = regexp.MustCompile(`[-_]\d+$`)
+	mermaidIgnoredRe   = regexp.MustCompile(`^(?:classDef|class|style|linkStyle|click|direction|accTitle|accDescr|title)\b`)
+)
+
+// mermaidShapes pairs every node shape's opening bracket with its closing
+// ones, longest first so "([" is not read as "(".
+var mermaidShapes = []struct {
+	open  string
+	close []string
+}{
+	{"(((", []string{")))"}},
+	{"([", []string{"])"}},
+	{"((", []string{"))"}},
+	{"[[", []string{"]]"}},
+	{"[(", []string{")]"}},
+	{"[/", []string{"/]", `\]`}},
+	{`[\`, []string{`\]`, "/]"}},
+	{"{{", []string{"}}"}},
+	{"(", []string{")"}},
+	{"[", []string{"]"}},
+	{"{", []string{"}"}},
+	{">", []string{"]"}},
+}
+
+func (p *mermaidParser) parse(src string) error {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	header := false
+	frontMatter := false
+	for i, raw := range lines {
+		p.line = i + 1
+		line := strings.TrimSpace(raw)
+		switch {
+		case line == "---" && !header:
+			frontMatter = !frontMatter
+			continue
+		case frontMatter || line == "":
+			continue
+		case strings.HasPrefix(line, "%%"):
+			if m := mermaidRecordRe.FindStringSubmatch(line); m != nil {
+				p.records = append(p.records, mermaidRecord{p.line, m[1], m[2], m[3]})
+			} else if strings.HasPrefix(strings.TrimSpace(line[2:]), "termaid:") {
+				return fmt.Errorf("line %d: malformed termaid metadata", p.line)
+			} else if m := mermaidMetaRe.FindStringSubmatch(line); m != nil {
+				p.meta = append(p.meta, mermaidMeta{p.line, m[1], m[2], strings.TrimSpace(m[3])})
+			}
+			continue
+		case !header:
+			m := mermaidHeaderRe.FindString(line)
+			if m == "" {
+				return fmt.Errorf("line %d: not a Mermaid flowchart (want graph or flowchart, got %q)", p.line, line)
+			}
+			header = true
+			line = strings.TrimSpace(line[len(m):])
+		}
+
+		for _, stmt := range splitStatements(line) {
+			if err := p.statement(stmt); err != nil {
+				return fmt.Errorf("line %d: %w", p.line, err)
+			}
+		}
+	}
+	if !header {
+		return fmt.Errorf("not a Mermaid flowchart: no graph or flowchart line")
+	}
+	if len(p.groups) > 0 {
+		return fmt.Errorf("line %d: subgraph not closed with end", p.line)
+	}
+
+	for _, r := range p.records {
+		if err := p.applyRecord(r); err != nil {
+			return fmt.Errorf("line %d: %w", r.line, err)
+		}
+	}
+	for _, m := range p.meta {
+		if err := p.applyMeta(m); err != nil {
+			return fmt.Errorf("line %d: %w", m.line, err)
+		}
+	}
+	p.regroup()
+	for _, n := range p.g.Nodes {
+		for child := range n.Conditions {
+			if !slices.Contains(n.Children, child) {
+				delete(n.Conditions, child)
+			}
+		}
+	}
+
+	if len(p.placed) == 0 || len(p.placed) < len(p.g.Nodes)-1 {
+		return p.g.AutoLayout()
+	}
+	p.g.Matrix = make(map[Coordinate][]*Node, len(p.g.Nodes))
+	for _, n := range p.g.Nodes {
+		p.g.addToMatrix(n)
+	}
+	p.g.recalculateBounds()
+	return nil
+}
+
+func (p *mermaidParser) statement(stmt string) error {
+	switch {
+	case stmt == "end":
+		if len(p.groups) == 0 {
+			return fmt.Errorf("end without subgraph")
+		}
+		p.groups = p.groups[:len(p.groups)-1]
+		return nil
+	case stmt == "subgraph" || strings.HasPrefix(stmt, "subgraph "):
+		return p.subgraph(strings.TrimSpace(strings.TrimPrefix(stmt, "subgraph")))
+	case mermaidIgnoredRe.MatchString(stmt):
+		return nil
+	}
+
+	rest := stmt
+	from, rest, err := p.nodeGroup(rest)
+	if err != nil {
+		return err
+	}
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		var label string
+		if label, rest, err = parseLink(rest); err != nil {
+			return err
+		}
+		var to []string
+		if to, rest, err = p.nodeGroup(rest); err != nil {
+			return err
+		}
+		for _, f := range from {
+			for _, t := range to {
+				if err := p.edge(f, t, label); err != nil {
+					return err
+				}
+			}
+		}
+		from = to
+	}
+	return nil
+}
+
+// subgraph opens a block: "id", "id[title]", "id [title]" or a bare title.
+func (p *mermaidParser) subgraph(spec string) error {
+	id, title := spec, spec
+	if i := strings.IndexAny(spec, "[\""); i >= 0 {
+		id = strings.TrimSpace(spec[:i])
+		title = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(spec[i:]), "["), "]")
+		title = mermaidText(strings.Trim(title, `"`))
+	}
+	if id == "" || strings.ContainsAny(id, " \t") {
+		id = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return '_'
+		}, title)
+	}
+	if id == "" {
+		return fmt.Errorf("subgraph without a name")
+	}
+
+	if mermaidLayoutRe.MatchString(id) {
+		p.groups = append(p.groups, "")
+		return nil
+	}
+	if _, ok := p.g.Subgraphs[id]; !ok {
+		p.g.Subgraphs[id] = &SubgraphInfo{ID: id, Name: title, Matrix: make(map[string]Coordinate)}
+	}
+	p.groups = append(p.groups, id)
+	return nil
+}
+
+// nodeGroup reads "a", "a[label]" or "a & b[label] & …" from the front of s.
+func (p *mermaidParser) nodeGroup(s string) ([]string, string, error) {
+	var ids []string
+	for {
+		id, rest, err := p.node(strings.TrimSpace(s))
+		if err != nil {
+			return nil, "", err
+		}
+		ids = append(ids, id)
+		rest = strings.TrimSpace(rest)
+		if !strings.HasPrefix(rest, "&") {
+			return ids, rest, nil
+		}
+		s = rest[1:]
+	}
+}
+
+// node reads one node reference with its optional shape and label. A node
+// belongs to the first subgraph it is mentioned in.
+func (p *mermaidParser) node(s string) (string, string, error) {
+	end := 0
+	for end < len(s) {
+		c := s[end]
+		if c == '-' && end+1 < len(s) && (s[end+1] == '-' || s[end+1] == '.') ||
+			c == '.' && end+1 < len(s) && s[end+1] == '-' {
+			break
+		}
+		if !(c == '_' || c == '-' || c == '.' || c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= 0x80) {
+			break
+		}
+		end++
+	}
+	id, rest := s[:end], s[end:]
+	if id == "" {
+		return "", "", fmt.Errorf("expected a node at %q", truncateArgs(s))
+	}
+
+	label, hasLabel := "", false
+	for _, shape := range mermaidShapes {
+		if !strings.HasPrefix(rest, shape.open) {
+			continue
+		}
+		var err error
+		if label, rest, err = shapeLabel(rest[len(shape.open):], shape.close); err != nil {
+			return "", "", fmt.Errorf("node %s: %w", id, err)
+		}
+		hasLabel = true
+		break
+	}
+	if strings.HasPrefix(rest, ":::") { // class shorthand
+		rest = strings.TrimLeftFunc(rest[3:], func(r rune) bool { return r == '_' || r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r) })
+	}
+
+	n := p.ensure(id)
+	p.join(n)
+	if hasLabel && id != p.g.Root {
+		tool, args := labelTool(label)
+		if tool == "" {
+			return "", "", fmt.Errorf("node %s: empty label", id)
+		}
+		n.Tool, n.Args = tool, args
+	}
+	return id, rest, nil
+}
+
+// shapeLabel reads a label, quoted or not, up to one of closers.
+func shapeLabel(s string, closers []string) (string, string, error) {
+	if strings.HasPrefix(s, `"`) {
+		end := strings.Index(s[1:], `"`)
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated label")
+		}
+		label, rest := s[1:end+1], strings.TrimSpace(s[end+2:])
+		for _, c := range closers {
+			if strings.HasPrefix(rest, c) {
+				return mermaidText(label), rest[len(c):], nil
+			}
+		}
+		return "", "", fmt.Errorf("label not closed with %s", closers[0])
+	}
+
+	end, width := -1, 0
+	for _, c := range closers {
+		if i := strings.Index(s, c); i >= 0 && (end < 0 || i < end) {
+			end, width = i, len(c)
+		}
+	}
+	if end < 0 {
+		return "", "", fmt.Errorf("label not closed with %s", closers[0])
+	}
+	return mermaidText(strings.TrimSpace(s[:end])), s[end+width:], nil
+}
+
+// parseLink reads a link and its label, if any, from the front of s.
+func parseLink(s string) (label, rest string, err error) {
+	if op := mermaidLinkRe.FindString(s); op != "" {
+		rest = strings.TrimSpace(s[len(op):])
+		if strings.HasPrefix(rest, "|") {
+			end := strings.Index(rest[1:], "|")
+			if end < 0 {
+				return "", "", fmt.Errorf("unterminated link label")
+			}
+			label, rest = rest[1:end+1], rest[end+2:]
+		}
+		return mermaidText(strings.Trim(strings.TrimSpace(label), `"`)), rest, nil
+	}
+	if m := mermaidTextRe.FindStringSubmatch(s); m != nil {
+		return mermaidText(strings.Trim(m[2], `"`)), s[len(m[0]):], nil
+	}
+	return "", "", fmt.Errorf("expected a link at %q", truncateArgs(s))
+}
+
+// join puts n in the innermost open subgraph, unless one already holds it.
+func (p *mermaidParser) join(n *Node) {
+	if n.Subgraph != "" || n.ID == p.g.Root {
+		return
+	}
+	for i := len(p.groups) - 1; i >= 0; i-- {
+		if sg := p.groups[i]; sg != "" {
+			info := p.g.Subgraphs[sg]
+			n.Subgraph, n.SubX = sg, len(info.Nodes)
+			info.Nodes = append(info.Nodes, n.ID)
+			info.Matrix[n.ID] = Coordinate{X: n.SubX, Y: n.SubY}
+			return
+		}
+	}
+}
+
+// ensure returns the node id, creating it the first time it appears.
+func (p *mermaidParser) ensure(id string) *Node {
+	if n, ok := p.g.Nodes[id]; ok {
+		return n
+	}
+	n := &Node{
+		ID:       id,
+		Tool:     mermaidIDSuffix.ReplaceAllString(id, ""),
+		Children: []string{},
+		Layer:    1,
+		Position: p.order,
+	}
+	p.order++
+	p.g.Nodes[id] = n
+	p.g.addToMatrix(n)
+	p.g.updateBounds(n.Layer, n.Position)
+	return n
+}
+
+func (p *mermaidParser) edge(from, to, label string) error {
+	parent := p.g.Nodes[from]
+	if !slices.Contains(parent.Children, to) {
+		if err := p.g.AddEdge(from, to); err != nil {
+			return err
+		}
+	}
+	switch label {
+	case "", "sequential":
+	case "parallel":
+		p.g.Nodes[to].Parallel = true
+	default:
+		if parent.Conditions == nil {
+			parent.Conditions = make(map[string]string)
+		}
+		parent.Conditions[to] = label
+	}
+	return nil
+}
+
+// applyRecord applies one "%% termaid:" comment. A node's metadata replaces
+// everything its label and links said, except its ID and edges.
+func (p *mermaidParser) applyRecord(r mermaidRecord) error {
+	switch r.kind {
+	case "workflow":
+		var w struct {
+			Scope *Scope            `json:"scope"`
+			Vars  map[string]string `json:"variables"`
+		}
+		if err := json.Unmarshal([]byte(r.data), &w); err != nil {
+			return fmt.Errorf("termaid workflow: %w", err)
+		}
+		p.g.Scope, p.g.Vars = w.Scope, w.Vars
+
+	case "subgraph":
+		if r.id == "" {
+			return fmt.Errorf("termaid subgraph without an ID")
+		}
+		var sg SubgraphInfo
+		if err := json.Unmarshal([]byte(r.data), &sg); err != nil {
+			return fmt.Errorf("termaid subgraph %s: %w", r.id, err)
+		}
+		info := p.subgraphInfo(r.id)
+		info.Name, info.Description, info.Parallel, info.MaxParallel = sg.Name, sg.Description, sg.Parallel, sg.MaxParallel
+
+	case "node":
+		n, ok := p.g.Nodes[r.id]
+		if !ok || r.id == p.g.Root {
+			return fmt.Errorf("termaid metadata for unknown node %q", r.id)
+		}
+		var stored Node
+		if err := json.Unmarshal([]byte(r.data), &stored); err != nil {
+			return fmt.Errorf("termaid node %s: %w", r.id, err)
+		}
+		stored.ID, stored.Children = r.id, n.Children
+		*n = stored
+		p.placed[r.id] = true
+
+	default:
+		return fmt.Errorf("unknown termaid metadata %q", r.kind)
+	}
+	return nil
+}
+
+// subgraphInfo returns the subgraph id, creating it if needed.
+func (p *mermaidParser) subgraphInfo(id string) *SubgraphInfo {
+	info, ok := p.g.Subgraphs[id]
+	if !ok {
+		info = &SubgraphInfo{ID: id, Name: id, Matrix: make(map[string]Coordinate)}
+		p.g.Subgraphs[id] = info
+	}
+	return info
+}
+
+// regroup rebuilds every subgraph's node list from the nodes, which metadata
+// may have moved, and drops subgraphs left empty.
+func (p *mermaidParser) regroup() {
+	for _, info := range p.g.Subgraphs {
+		info.Nodes, info.Matrix = nil, make(map[string]Coordinate)
+	}
+	ids := p.g.sortedIDs()
+	sort.SliceStable(ids, func(i, j int) bool {
+		a, b := p.g.Nodes[ids[i]], p.g.Nodes[ids[j]]
+		if a.SubY != b.SubY {
+			return a.SubY < b.SubY
+		}
+		return a.SubX < b.SubX
+	})
+	for _, id := range ids {
+		n := p.g.Nodes[id]
+		if n.Subgraph == "" || id == p.g.Root {
+			continue
+		}
+		info := p.subgraphInfo(n.Subgraph)
+		info.Nodes = append(info.Nodes, id)
+		info.Matrix[id] = Coordinate{X: n.SubX, Y: n.SubY}
+	}
+	for id, info := range p.g.Subgraphs {
+		if len(info.Nodes) == 0 {
+			delete(p.g.Subgraphs, id)
+		}
+	}
+}
+
+func (p *mermaidParser) applyMeta(m mermaidMeta) error {
+	n, ok := p.g.Nodes[m.node]
+	if !ok || m.node == p.g.Root {
+		return fmt.Errorf("%%%% comment for unknown node %q", m.node)
+	}
+	switch m.field {
+	case "tool":
+		n.Tool = m.value
+	case "args":
+		n.Args = m.value
+	case "in":
+		n.In = m.value
+	case "out":
+		n.Out = m.value
+	case "parser":
+		n.Parser = m.value
+	case "shell":
+		shell, err := strconv.ParseBool(m.value)
+		if err != nil {
+			return fmt.Errorf("%s.shell: %w", m.node, err)
+		}
+		n.Shell = shell
+	}
+	return nil
+}
+
+// labelTool splits a node label into the tool, its first word, and the args:
+// the rest of the label, its lines joined by spaces.
+func labelTool(label string) (tool, args string) {
+	var parts []string
+	for _, l := range mermaidBreakRe.Split(label, -1) {
+		if l = strings.TrimSpace(l); l != "" {
+			parts = append(parts, l)
+		}
+	}
+	if len(parts) == 0 {
+		return "", ""
+	}
+	tool, first, _ := strings.Cut(parts[0], " ")
+	rest := append([]string{strings.TrimSpace(first)}, parts[1:]...)
+	return tool, strings.TrimSpace(strings.Join(rest, " "))
+}
+
+// mermaidText decodes the #name; and #123; entities Mermaid labels use for
+// characters that would end them.
+func mermaidText(s string) string {
+	return mermaidEntityRe.ReplaceAllStringFunc(s, func(e string) string {
+		name := e[1 : len(e)-1]
+		if code, err := strconv.Atoi(name); err == nil {
+			return string(rune(code))
+		}
+		switch name {
+		case "quot":
+			return `"`
+		case "amp":
+			return "&"
+		case "lt":
+			return "<"
+		case "gt":
+			return ">"
+		}
+		return e
+	})
+}
+
+// splitStatements splits a line at semicolons outside labels, leaving those
+// that end an entity.
+func splitStatements(line string) []string {
+	var stmts []string
+	depth, quoted, piped, start := 0, false, false, 0
+	for i, c := range line {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '|':
+			piped = !piped
+		case piped:
+		case c == '[' || c == '(' || c == '{':
+			depth++
+		case c == ']' || c == ')' || c == '}':
+			depth--
+		case c == ';' && depth <= 0 && !mermaidEntityEndRe.MatchString(line[:i]):
+			stmts = append(stmts, line[start:i])
+			start = i + 1
+		}
+	}
+	stmts = append(stmts, line[start:])
+
+	out := stmts[:0]
+	for _, s := range stmts {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
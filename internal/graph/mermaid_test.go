@@ -0,0 +1,296 @@
+package graph
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// roundTripDAGs builds the workflows the Mermaid round trip is checked on.
+func roundTripDAGs(t *testing.T) map[string]*DAG {
+	t.Helper()
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	chain := NewDAG()
+	must(chain.AddNode("input", "subfinder-1", "subfinder", "-d {{domain}} -silent", 1))
+	must(chain.AddNode("subfinder-1", "httpx-1", "httpx", "-l {{input}} -sc -title -json", 2))
+	must(chain.AddNode("httpx-1", "nuclei-1", "nuclei", "-l {{input}} -severity high,critical", 3))
+
+	full := NewDAG()
+	must(full.AddNode("input", "subfinder-1", "subfinder", "-d {{domain}}", 1))
+	must(full.AddNode("input", "amass-1", "amass", "enum -passive -d {{domain}}", 1))
+	must(full.AddNodeAtPosition("subfinder-1", "dnsx-1", "dnsx", "-l {{input}} -a -resp", 2, 0, "resolve", true))
+	must(full.AddNodeAtPosition("subfinder-1", "dnsx-2", "dnsx", "-l {{input}} -cname", 2, 1, "resolve", true))
+	must(full.AddEdge("amass-1", "dnsx-1"))
+	must(full.AddNode("dnsx-1", "grep-1", "grep", `-i "admin|login" -x '\.cdn\.'`, 3))
+	must(full.AddNode("dnsx-1", "httpx-1", "httpx", "-l {{input}} -json -o {{output}}", 3))
+	must(full.AddEdge("dnsx-2", "httpx-1"))
+	must(full.AddNode("httpx-1", "sh-1", "cat", `{{input}} | grep -E "200|301" > {{output}} && echo done; echo 'a#b'`, 4))
+	must(full.AddNode("httpx-1", "nuclei-1", "nuclei", "-l {{input}}", 4))
+	full.Nodes["dnsx-1"].Conditions = map[string]string{"grep-1": `value ~ /admin|login/ && lines > 0`, "httpx-1": "else"}
+	full.Nodes["httpx-1"].Conditions = map[string]string{"nuclei-1": `if(status_code == 200 || title == "a > b")`}
+	sh := full.Nodes["sh-1"]
+	timeout, retries := 30, 0
+	sh.Shell, sh.Tee, sh.Timeout, sh.Retries, sh.Backoff = true, true, &timeout, &retries, "exponential"
+	sh.OnError, sh.AcceptExit = OnErrorSkipDescendants, []int{1}
+	nuclei := full.Nodes["nuclei-1"]
+	nuclei.In, nuclei.Out, nuclei.Parser, nuclei.CacheTTL = "urls", "findings", "nuclei", "12h"
+	nuclei.Shard = ShardSpec{Lines: 500}
+	nuclei.SecretEnv = map[string]string{"PDCP_API_KEY": "pdcp"}
+	nuclei.Limits = ResourceLimits{MemoryMB: 2048, OpenFiles: 4096}
+	full.Subgraphs["resolve"].Description = "DNS resolution"
+	full.Subgraphs["resolve"].MaxParallel = 2
+	full.Scope = &Scope{Include: []string{"*.example.com", "10.0.0.0/8"}, ExcludePaths: []string{"^/logout"}, Ports: []int{80, 443}}
+	full.Vars = map[string]string{"threads": "50", "wordlist": "{{wordlists}}/dns.txt"}
+
+	return map[string]*DAG{"root only": NewDAG(), "chain": chain, "full": full}
+}
+
+func TestMermaidRoundTrip(t *testing.T) {
+	for name, g := range roundTripDAGs(t) {
+		t.Run(name, func(t *testing.T) {
+			src := g.ToMermaid()
+			got, err := ParseMermaid(src)
+			if err != nil {
+				t.Fatalf("ParseMermaid: %v\n%s", err, src)
+			}
+
+			if !slices.Equal(slices.Sorted(maps.Keys(got.Nodes)), slices.Sorted(maps.Keys(g.Nodes))) {
+				t.Fatalf("nodes = %v, want %v", slices.Sorted(maps.Keys(got.Nodes)), slices.Sorted(maps.Keys(g.Nodes)))
+			}
+			for id, want := range g.Nodes {
+				if a, b := nodeJSON(got.Nodes[id]), nodeJSON(want); a != b {
+					t.Errorf("node %s:\n got %s\nwant %s", id, a, b)
+				}
+			}
+
+			if a, b := jsonOf(got.Scope), jsonOf(g.Scope); a != b {
+				t.Errorf("scope = %s, want %s", a, b)
+			}
+			if !maps.Equal(got.Vars, g.Vars) {
+				t.Errorf("vars = %v, want %v", got.Vars, g.Vars)
+			}
+			if got.MaxX != g.MaxX || got.MaxY != g.MaxY {
+				t.Errorf("bounds = %d×%d, want %d×%d", got.MaxX, got.MaxY, g.MaxX, g.MaxY)
+			}
+			if len(got.Subgraphs) != len(g.Subgraphs) {
+				t.Errorf("subgraphs = %v, want %v", slices.Sorted(maps.Keys(got.Subgraphs)), slices.Sorted(maps.Keys(g.Subgraphs)))
+			}
+			for id, want := range g.Subgraphs {
+				sg, ok := got.Subgraphs[id]
+				if !ok {
+					continue
+				}
+				if sg.Name != want.Name || sg.Description != want.Description || sg.Parallel != want.Parallel || sg.MaxParallel != want.MaxParallel {
+					t.Errorf("subgraph %s = %+v, want %+v", id, *sg, *want)
+				}
+				if !slices.Equal(sorted(sg.Nodes), sorted(want.Nodes)) {
+					t.Errorf("subgraph %s nodes = %v, want %v", id, sg.Nodes, want.Nodes)
+				}
+			}
+
+			// and the chart it makes is the same again
+			if again := got.ToMermaid(); sortedLines(again) != sortedLines(src) {
+				t.Errorf("second round differs:\n%s\n---\n%s", src, again)
+			}
+		})
+	}
+}
+
+// nodeJSON is n with empty collections normalised and children sorted, so
+// nodes that mean the same compare equal.
+func nodeJSON(n *Node) string {
+	cp := *n
+	cp.Children = sorted(cp.Children)
+	if len(cp.Conditions) == 0 {
+		cp.Conditions = nil
+	}
+	return jsonOf(cp)
+}
+
+func jsonOf(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// sortedLines compares charts whose map-ordered parts come out in any order.
+func sortedLines(s string) string {
+	lines := strings.Split(s, "\n")
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+func TestParseMermaid(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		edges map[string][]string // node → children
+		check func(t *testing.T, g *DAG)
+	}{
+		{
+			name:  "labels name the tool and args",
+			src:   "flowchart TD\n  input --> s1[\"subfinder -d {{domain}}\"]\n  s1 --> h[httpx<br/>-sc -title]",
+			edges: map[string][]string{"input": {"s1"}, "s1": {"h"}},
+			check: func(t *testing.T, g *DAG) {
+				if n := g.Nodes["s1"]; n.Tool != "subfinder" || n.Args != "-d {{domain}}" {
+					t.Errorf("s1 = %s %q", n.Tool, n.Args)
+				}
+				if n := g.Nodes["h"]; n.Tool != "httpx" || n.Args != "-sc -title" {
+					t.Errorf("h = %s %q", n.Tool, n.Args)
+				}
+			},
+		},
+		{
+			name:  "a node without a label runs the tool its ID names",
+			src:   "graph LR\n  input --> subfinder-1 --> httpx_2",
+			edges: map[string][]string{"input": {"subfinder-1"}, "subfinder-1": {"httpx_2"}},
+			check: func(t *testing.T, g *DAG) {
+				if g.Nodes["subfinder-1"].Tool != "subfinder" || g.Nodes["httpx_2"].Tool != "httpx" {
+					t.Errorf("tools = %s, %s", g.Nodes["subfinder-1"].Tool, g.Nodes["httpx_2"].Tool)
+				}
+			},
+		},
+		{
+			name:  "ampersands and chains fan out and in",
+			src:   "graph LR\n  input --> a & b --> c",
+			edges: map[string][]string{"input": {"a", "b"}, "a": {"c"}, "b": {"c"}},
+			check: func(t *testing.T, g *DAG) {
+				if g.Nodes["c"].Layer != 2 {
+					t.Errorf("c in layer %d, want 2", g.Nodes["c"].Layer)
+				}
+			},
+		},
+		{
+			name:  "link labels are conditions, except parallel and sequential",
+			src:   "graph LR\n  input --> a\n  a -->|\"lines > 10\"| b\n  a -- else --> c\n  a -.->|parallel| d\n  a -->|sequential| e",
+			edges: map[string][]string{"input": {"a"}, "a": {"b", "c", "d", "e"}},
+			check: func(t *testing.T, g *DAG) {
+				want := map[string]string{"b": "lines > 10", "c": "else"}
+				if !maps.Equal(g.Nodes["a"].Conditions, want) {
+					t.Errorf("conditions = %v, want %v", g.Nodes["a"].Conditions, want)
+				}
+				if !g.Nodes["d"].Parallel || g.Nodes["e"].Parallel {
+					t.Errorf("parallel d=%v e=%v", g.Nodes["d"].Parallel, g.Nodes["e"].Parallel)
+				}
+			},
+		},
+		{
+			name:  "entities decode",
+			src:   "graph LR\n  input --> g[\"grep #quot;a#124;b#quot; #35;x\"]",
+			edges: map[string][]string{"input": {"g"}},
+			check: func(t *testing.T, g *DAG) {
+				if got := g.Nodes["g"].Args; got != `"a|b" #x` {
+					t.Errorf("args = %q", got)
+				}
+			},
+		},
+		{
+			name:  "subgraphs group nodes, layout blocks do not",
+			src:   "graph LR\n  subgraph recon[Recon]\n    a\n    subgraph L1[\"Layer 1\"]\n      b\n    end\n  end\n  input --> a & b",
+			edges: map[string][]string{"input": {"a", "b"}},
+			check: func(t *testing.T, g *DAG) {
+				sg, ok := g.Subgraphs["recon"]
+				if !ok || sg.Name != "Recon" || !slices.Equal(sorted(sg.Nodes), []string{"a", "b"}) {
+					t.Errorf("subgraphs = %+v", g.Subgraphs)
+				}
+				if _, ok := g.Subgraphs["L1"]; ok {
+					t.Error("layout block kept as a subgraph")
+				}
+			},
+		},
+		{
+			name:  "field comments override labels",
+			src:   "graph LR\n  input --> a[nmap -sV]\n  %% a.args: -p- {{input}}\n  %% a.shell: true\n  %% a.parser: naabu",
+			edges: map[string][]string{"input": {"a"}},
+			check: func(t *testing.T, g *DAG) {
+				if n := g.Nodes["a"]; n.Args != "-p- {{input}}" || !n.Shell || n.Parser != "naabu" {
+					t.Errorf("a = %+v", *n)
+				}
+			},
+		},
+		{
+			name:  "front matter, styles and semicolons",
+			src:   "---\ntitle: x\n---\ngraph LR;\n  input --> a; a --> b\n  classDef hot fill:#f00;\n  style a fill:#f9f\n  class b hot",
+			edges: map[string][]string{"input": {"a"}, "a": {"b"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := ParseMermaid(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for id, n := range g.Nodes {
+				if want := tt.edges[id]; !slices.Equal(sorted(n.Children), sorted(want)) {
+					t.Errorf("%s → %v, want %v", id, n.Children, want)
+				}
+			}
+			if problems := g.Validate(); len(problems) > 0 {
+				t.Errorf("parsed graph has problems: %v", problems)
+			}
+			if tt.check != nil {
+				tt.check(t, g)
+			}
+		})
+	}
+}
+
+func TestParseMermaidErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"not a flowchart", "sequenceDiagram\n  a->>b: hi", "not a Mermaid flowchart"},
+		{"empty", "%% nothing", "no graph or flowchart line"},
+		{"unclosed subgraph", "graph LR\n  subgraph x\n  a", "not closed"},
+		{"end without subgraph", "graph LR\n  end", "end without subgraph"},
+		{"unterminated label", "graph LR\n  a[\"open", "unterminated label"},
+		{"cycle", "graph LR\n  input --> a --> b --> a", "cycle"},
+		{"edge into the root", "graph LR\n  a --> input", "into input"},
+		{"bad metadata", "graph LR\n  input --> a\n  %% termaid: node a {bad}", "termaid node a"},
+		{"metadata for a missing node", "graph LR\n  %% termaid: node ghost {\"tool\":\"x\"}", "unknown node"},
+		{"field comment for a missing node", "graph LR\n  %% ghost.tool: x", "unknown node"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseMermaid(tt.src)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseMermaid error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestToMermaidSubgraphOrder(t *testing.T) {
+	g := NewDAG()
+	for i, sg := range []string{"web", "dns", "alpha", "ports"} {
+		if err := g.AddNodeAtPosition("input", sg+"-1", "cat", "", 1, i, sg, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := g.ToMermaid()
+	for _, prefix := range []string{"subgraph ", "termaid: subgraph "} {
+		var at []int
+		for _, sg := range []string{"alpha", "dns", "ports", "web"} {
+			at = append(at, strings.Index(want, prefix+sg))
+		}
+		if !slices.IsSorted(at) || at[0] < 0 {
+			t.Errorf("%q lines not in ID order:\n%s", prefix, want)
+		}
+	}
+	for range 20 {
+		if got := g.ToMermaid(); got != want {
+			t.Fatalf("ToMermaid changed between calls:\n%s\nthen\n%s", want, got)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package graph
 
 import (
+	"encoding/json"
 	"fmt"
+	"reflect"
 	"sort"
 	"strings"
 )
@@ -20,19 +22,22 @@ func (g *DAG) ToMermaid() string {
 	// Generate edges
 	g.generateEdges(&b)
 
+	// Embed everything the labels leave out
+	g.generateMetadata(&b)
+
 	return b.String()
 }
 
 // generateSubgraphs creates subgraph definitions for parallel execution groups
 func (g *DAG) generateSubgraphs(b *strings.Builder) {
-	for sgID, sg := range g.Subgraphs {
-		if len(sg.Nodes) > 0 {
+	for _, sgID := range g.subgraphIDs() {
+		if sg := g.Subgraphs[sgID]; len(sg.Nodes) > 0 {
 			fmt.Fprintf(b, "  subgraph %s[\"%s\"]\n", sgID, sg.Name)
 			
 			// Sort nodes by subgraph coordinates
 			nodes := g.GetSubgraphNodes(sgID)
 			for _, node := range nodes {
-				fmt.Fprintf(b, "    %s[\"%s\\n%s\"]\n", node.ID, node.Tool, truncateArgs(node.Args))
+				fmt.Fprintf(b, "    %s[\"%s\\n%s\"]\n", node.ID, node.Tool, mermaidLabel(truncateArgs(node.Args)))
 			}
 			
 			b.WriteString("  end\n")
@@ -60,7 +65,7 @@ func (g *DAG) generateLayers(b *strings.Builder) {
 					node := nodes[0]
 					if node.Subgraph == "" { // Only render if not in a subgraph
 						fmt.Fprintf(b, "    %s[\"%s\\n%s\"]\n", 
-							node.ID, node.Tool, truncateArgs(node.Args))
+							node.ID, node.Tool, mermaidLabel(truncateArgs(node.Args)))
 					}
 				} else if len(nodes) > 1 {
 					// Multiple nodes at same position (parallel)
@@ -68,7 +73,7 @@ func (g *DAG) generateLayers(b *strings.Builder) {
 					for _, node := range nodes {
 						if node.Subgraph == "" {
 							fmt.Fprintf(b, "      %s[\"%s\\n%s\"]\n", 
-								node.ID, node.Tool, truncateArgs(node.Args))
+								node.ID, node.Tool, mermaidLabel(truncateArgs(node.Args)))
 						}
 					}
 					b.WriteString("    end\n")
@@ -101,7 +106,9 @@ func (g *DAG) generateEdges(b *strings.Builder) {
 			if child, exists := g.Nodes[childID]; exists {
 				// Style edge based on relationship type
 				edgeStyle := "-->"
-				if child.Parallel && len(node.Children) > 1 {
+				if cond := node.Condition(childID); cond != "" {
+					edgeStyle = fmt.Sprintf("-->|\"%s\"|", mermaidLabel(cond))
+				} else if child.Parallel && len(node.Children) > 1 {
 					edgeStyle = "-.->|parallel|"
 				} else if child.Layer == node.Layer + 1 {
 					edgeStyle = "-->|sequential|"
@@ -113,6 +120,109 @@ func (g *DAG) generateEdges(b *strings.Builder) {
 	}
 }
 
+// generateMetadata writes the workflow, its subgraphs and every node as
+// "%% termaid:" comments, which Mermaid viewers skip and ParseMermaid reads
+// back, so the chart alone can recreate the workflow.
+func (g *DAG) generateMetadata(b *strings.Builder) {
+	b.WriteString("\n")
+
+	workflow := struct {
+		Scope *Scope            `json:"scope"`
+		Vars  map[string]string `json:"variables"`
+	}{g.Scope, g.Vars}
+	if data := metadataJSON(workflow); data != "{}" {
+		fmt.Fprintf(b, "  %%%% termaid: workflow %s\n", data)
+	}
+
+	for _, id := range g.subgraphIDs() {
+		sg := *g.Subgraphs[id]
+		sg.ID, sg.Nodes, sg.Matrix = "", nil, nil // the nodes say where they belong
+		fmt.Fprintf(b, "  %%%% termaid: subgraph %s %s\n", id, metadataJSON(sg))
+	}
+
+	var nodes []*Node
+	for _, n := range g.Nodes {
+		if n.ID != g.Root {
+			nodes = append(nodes, n)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Layer != nodes[j].Layer {
+			return nodes[i].Layer < nodes[j].Layer
+		}
+		if nodes[i].Position != nodes[j].Position {
+			return nodes[i].Position < nodes[j].Position
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+	for _, n := range nodes {
+		cp := *n
+		cp.ID, cp.Children = "", nil // the edges say where it leads
+		fmt.Fprintf(b, "  %%%% termaid: node %s %s\n", n.ID, metadataJSON(cp))
+	}
+}
+
+// metadataJSON marshals v as one line of JSON without the fields that hold
+// their zero value. A pointer field set to 0 is not zero and is kept.
+func metadataJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "{}"
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return "{}"
+	}
+	zero := make(map[string]any)
+	if data, err := json.Marshal(reflect.Zero(reflect.TypeOf(v)).Interface()); err == nil {
+		_ = json.Unmarshal(data, &zero)
+	}
+	for k, f := range fields {
+		switch f := f.(type) {
+		case nil:
+			delete(fields, k)
+		case string, bool, float64:
+			if (f == "" || f == false || f == 0.0) && zero[k] != nil {
+				delete(fields, k)
+			}
+		case map[string]any:
+			if len(f) == 0 {
+				delete(fields, k)
+			}
+		case []any:
+			if len(f) == 0 {
+				delete(fields, k)
+			}
+		}
+	}
+	var out strings.Builder
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false) // keep > and & in args readable
+	if err := enc.Encode(fields); err != nil {
+		return "{}"
+	}
+	return strings.TrimSpace(out.String())
+}
+
+// subgraphIDs returns the IDs of g's subgraphs in order, so they render
+// the same way every time.
+func (g *DAG) subgraphIDs() []string {
+	ids := make([]string, 0, len(g.Subgraphs))
+	for id := range g.Subgraphs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// mermaidLabel escapes text for use inside a quoted Mermaid label.
+func mermaidLabel(s string) string {
+	s = strings.ReplaceAll(s, `"`, "#quot;")
+	s = strings.ReplaceAll(s, "|", "#124;")
+	s = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(s)
+	return s
+}
+
 // truncateArgs shortens long argument strings for display
 func truncateArgs(args string) string {
 	if len(args) > 30 {
@@ -131,17 +241,34 @@ func (g *DAG) ToJSON() string {
 	b.WriteString(fmt.Sprintf("    \"max_y\": %d\n", g.MaxY))
 	b.WriteString("  },\n")
 	
+	if g.Scope != nil {
+		if data, err := json.Marshal(g.Scope); err == nil {
+			fmt.Fprintf(&b, "  \"scope\": %s,\n", data)
+		}
+	}
+
+	if len(g.Vars) > 0 {
+		if data, err := json.Marshal(g.Vars); err == nil {
+			fmt.Fprintf(&b, "  \"variables\": %s,\n", data)
+		}
+	}
+
 	// Export subgraphs
 	if len(g.Subgraphs) > 0 {
 		b.WriteString("  \"subgraphs\": [\n")
 		first := true
-		for _, sg := range g.Subgraphs {
+		for _, id := range g.subgraphIDs() {
+			sg := g.Subgraphs[id]
 			if !first {
 				b.WriteString(",\n")
 			}
 			first = false
-			fmt.Fprintf(&b, "    {\"id\":\"%s\",\"name\":\"%s\",\"parallel\":%t,\"nodes\":%s}",
-				sg.ID, escapeJSON(sg.Name), sg.Parallel, stringArrayJSON(sg.Nodes))
+			maxParallel := ""
+			if sg.MaxParallel > 0 {
+				maxParallel = fmt.Sprintf(",\"max_parallel\":%d", sg.MaxParallel)
+			}
+			fmt.Fprintf(&b, "    {\"id\":\"%s\",\"name\":\"%s\",\"parallel\":%t%s,\"nodes\":%s}",
+				sg.ID, escapeJSON(sg.Name), sg.Parallel, maxParallel, stringArrayJSON(sg.Nodes))
 		}
 		b.WriteString("\n  ],\n")
 	}
@@ -178,14 +305,99 @@ func (g *DAG) ToJSON() string {
 		}
 		
 		fmt.Fprintf(&b,
-			"    {\"id\":\"%s\",\"tool\":\"%s\",\"args\":\"%s\",\"children\":%s,\"layer\":%d,\"position\":%d,\"parallel\":%t%s}",
+			"    {\"id\":\"%s\",\"tool\":\"%s\",\"args\":\"%s\",\"children\":%s,\"layer\":%d,\"position\":%d,\"parallel\":%t%s%s}",
 			n.ID, n.Tool, escapeJSON(n.Args), childrenJSON(n.Children), 
-			n.Layer, n.Position, n.Parallel, subgraphStr)
+			n.Layer, n.Position, n.Parallel, subgraphStr, nodeOptionsJSON(n))
 	}
 	b.WriteString("\n  ]\n}")
 	return b.String()
 }
+
+// nodeOptionsJSON emits the optional per-node execution settings that are
+// only written when they differ from their defaults.
+func nodeOptionsJSON(n *Node) string {
+	var b strings.Builder
+	if n.Tee {
+		b.WriteString(",\"tee\":true")
+	}
+	if n.Shell {
+		b.WriteString(",\"shell\":true")
+	}
+	if n.In != "" {
+		fmt.Fprintf(&b, ",\"in\":\"%s\"", escapeJSON(n.In))
+	}
+	if n.Out != "" {
+		fmt.Fprintf(&b, ",\"out\":\"%s\"", escapeJSON(n.Out))
+	}
+	if n.Parser != "" {
+		fmt.Fprintf(&b, ",\"parser\":\"%s\"", escapeJSON(n.Parser))
+	}
+	if n.Timeout != nil {
+		fmt.Fprintf(&b, ",\"timeout\":%d", *n.Timeout)
+	}
+	if n.Retries != nil {
+		fmt.Fprintf(&b, ",\"retries\":%d", *n.Retries)
+	}
+	if n.Backoff != "" {
+		fmt.Fprintf(&b, ",\"backoff\":\"%s\"", escapeJSON(n.Backoff))
+	}
+	if n.BackoffDelay != nil {
+		fmt.Fprintf(&b, ",\"backoff_delay\":%d", *n.BackoffDelay)
+	}
+	if n.CacheTTL != "" {
+		fmt.Fprintf(&b, ",\"cache_ttl\":\"%s\"", escapeJSON(n.CacheTTL))
+	}
+	if n.OnError != "" {
+		fmt.Fprintf(&b, ",\"on_error\":\"%s\"", escapeJSON(n.OnError))
+	}
+	if len(n.AcceptExit) > 0 {
+		codes := make([]string, len(n.AcceptExit))
+		for i, c := range n.AcceptExit {
+			codes[i] = fmt.Sprint(c)
+		}
+		fmt.Fprintf(&b, ",\"accept_exit\":[%s]", strings.Join(codes, ","))
+	}
+	if len(n.Conditions) > 0 {
+		keys := make([]string, 0, len(n.Conditions))
+		for k := range n.Conditions {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b.WriteString(",\"conditions\":{")
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(&b, "\"%s\":\"%s\"", escapeJSON(k), escapeJSON(n.Conditions[k]))
+		}
+		b.WriteString("}")
+	}
+	if len(n.SecretEnv) > 0 {
+		if data, err := json.Marshal(n.SecretEnv); err == nil {
+			fmt.Fprintf(&b, ",\"secret_env\":%s", data)
+		}
+	}
+	if len(n.SecretFiles) > 0 {
+		if data, err := json.Marshal(n.SecretFiles); err == nil {
+			fmt.Fprintf(&b, ",\"secret_files\":%s", data)
+		}
+	}
+	if n.Limits.Set() {
+		if data, err := json.Marshal(n.Limits); err == nil {
+			fmt.Fprintf(&b, ",\"limits\":%s", data)
+		}
+	}
+	switch {
+	case n.Shard.Lines > 0:
+		fmt.Fprintf(&b, ",\"shard\":{\"lines\":%d}", n.Shard.Lines)
+	case n.Shard.Chunks > 1:
+		fmt.Fprintf(&b, ",\"shard\":{\"chunks\":%d}", n.Shard.Chunks)
+	}
+	return b.String()
+}
+
 func escapeJSON(s string) string { 
+	s = strings.ReplaceAll(s, `\`, `\\`)
 	s = strings.ReplaceAll(s, `"`, `\"`)
 	s = strings.ReplaceAll(s, "\n", "\\n")
 	s = strings.ReplaceAll(s, "\r", "\\r")
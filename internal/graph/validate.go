@@ -0,0 +1,211 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kinds of Problem.
+const (
+	ProblemDuplicateID  = "duplicate-id"  // two nodes share an ID
+	ProblemDanglingEdge = "dangling-edge" // a child that is not a node
+	ProblemCycle        = "cycle"         // nodes that are their own ancestors
+	ProblemOrphan       = "orphan"        // a node input never reaches
+	ProblemLayerOrder   = "layer-order"   // a child not to the right of its parent
+)
+
+// Problem is a structural fault that keeps a workflow from running as drawn.
+type Problem struct {
+	NodeID  string
+	Kind    string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.NodeID, p.Kind, p.Message)
+}
+
+// Warning reports whether p only concerns how the workflow is drawn. Nodes
+// run by their edges, so a child left of its parent still runs after it.
+func (p Problem) Warning() bool {
+	return p.Kind == ProblemLayerOrder
+}
+
+// Errors returns the problems that are not warnings.
+func Errors(problems []Problem) []Problem {
+	var errs []Problem
+	for _, p := range problems {
+		if !p.Warning() {
+			errs = append(errs, p)
+		}
+	}
+	return errs
+}
+
+// ValidationError is returned in place of running a graph with problems.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = p.String()
+	}
+	return fmt.Sprintf("invalid workflow (%d problems):\n  %s", len(e.Problems), strings.Join(lines, "\n  "))
+}
+
+// Validate reports every structural problem in g, sorted by node ID: nodes
+// sharing an ID, children that do not exist, cycles, nodes the root never
+// reaches and children placed in the same or an earlier layer than a parent.
+// Nodes without a parent hang off the root, as they do when run. Misplaced
+// layers are only warnings; see Errors for the problems that stop a run.
+func (g *DAG) Validate() []Problem {
+	var problems []Problem
+	add := func(id, kind, format string, args ...any) {
+		problems = append(problems, Problem{NodeID: id, Kind: kind, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// loaders place every node they read in the matrix, so a node listed
+	// twice shows up there twice even though Nodes keeps only one
+	seen := make(map[string]int)
+	for _, nodes := range g.Matrix {
+		for _, n := range nodes {
+			seen[n.ID]++
+		}
+	}
+	for id, count := range seen {
+		if count > 1 {
+			add(id, ProblemDuplicateID, "defined %d times; only the last one is kept", count)
+		}
+	}
+
+	ids := g.sortedIDs()
+	parents := make(map[string][]string)
+	for _, id := range ids {
+		for _, c := range g.Nodes[id].Children {
+			child, ok := g.Nodes[c]
+			switch {
+			case !ok:
+				add(id, ProblemDanglingEdge, "child %q does not exist", c)
+				continue
+			case c == g.Root:
+				add(id, ProblemCycle, "edge back into %s", g.Root)
+				continue
+			}
+			parents[c] = append(parents[c], id)
+			if c != id && child.Layer <= g.Nodes[id].Layer {
+				add(c, ProblemLayerOrder, "in layer %d, not after its parent %s in layer %d", child.Layer, id, g.Nodes[id].Layer)
+			}
+		}
+	}
+	for _, id := range ids {
+		if id != g.Root && len(parents[id]) == 0 && g.Nodes[id].Layer < 1 {
+			add(id, ProblemLayerOrder, "in layer %d, not after %s", g.Nodes[id].Layer, g.Root)
+		}
+	}
+
+	for _, cycle := range g.cycles(ids) {
+		add(cycle[0], ProblemCycle, "%s", strings.Join(append(cycle, cycle[0]), " → "))
+	}
+
+	// reachability as the scheduler sees it: parentless nodes hang off the root
+	reached := map[string]bool{g.Root: true}
+	queue := []string{g.Root}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		next := g.Nodes[id].Children
+		if id == g.Root {
+			next = append([]string(nil), next...)
+			for _, n := range ids {
+				if n != g.Root && len(parents[n]) == 0 {
+					next = append(next, n)
+				}
+			}
+		}
+		for _, c := range next {
+			if _, ok := g.Nodes[c]; ok && !reached[c] {
+				reached[c] = true
+				queue = append(queue, c)
+			}
+		}
+	}
+	for _, id := range ids {
+		if !reached[id] {
+			add(id, ProblemOrphan, "unreachable from %s; its parents %s never run", g.Root, strings.Join(parents[id], ", "))
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].NodeID < problems[j].NodeID })
+	return problems
+}
+
+// cycles returns the cycle closed by each back edge of a depth-first walk,
+// without repeats, each starting at its smallest node ID.
+func (g *DAG) cycles(ids []string) [][]string {
+	const (
+		unvisited = iota
+		active
+		done
+	)
+	state := make(map[string]int)
+	var stack []string
+	var found [][]string
+	keys := make(map[string]bool)
+
+	var visit func(id string)
+	visit = func(id string) {
+		state[id] = active
+		stack = append(stack, id)
+		for _, c := range g.Nodes[id].Children {
+			if _, ok := g.Nodes[c]; !ok || c == g.Root {
+				continue
+			}
+			switch state[c] {
+			case unvisited:
+				visit(c)
+			case active:
+				start := len(stack) - 1
+				for stack[start] != c {
+					start--
+				}
+				cycle := rotateToMin(append([]string(nil), stack[start:]...))
+				if key := strings.Join(cycle, "\x00"); !keys[key] {
+					keys[key] = true
+					found = append(found, cycle)
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[id] = done
+	}
+
+	for _, id := range ids {
+		if state[id] == unvisited {
+			visit(id)
+		}
+	}
+	return found
+}
+
+func rotateToMin(cycle []string) []string {
+	first := 0
+	for i, id := range cycle {
+		if id < cycle[first] {
+			first = i
+		}
+	}
+	return append(cycle[first:], cycle[:first]...)
+}
+
+// sortedIDs returns the node IDs in lexical order.
+func (g *DAG) sortedIDs() []string {
+	ids := make([]string, 0, len(g.Nodes))
+	for id := range g.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
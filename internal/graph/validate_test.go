@@ -0,0 +1,138 @@
+package graph
+
+import (
+	"slices"
+	"sort"
+	"testing"
+)
+
+// buildDAG makes a graph from node → children, placing each node at the
+// given layer; edges are written straight into Children, as loaders do, so
+// broken graphs can be built too.
+func buildDAG(layers map[string]int, edges map[string][]string) *DAG {
+	g := NewDAG()
+	pos := make(map[int]int)
+	for _, id := range sorted(keys(layers)) {
+		n := &Node{ID: id, Tool: id, Children: []string{}, Layer: layers[id], Position: pos[layers[id]]}
+		pos[layers[id]]++
+		g.Nodes[id] = n
+		g.addToMatrix(n)
+	}
+	for from, to := range edges {
+		g.Nodes[from].Children = append(g.Nodes[from].Children, to...)
+	}
+	g.recalculateBounds()
+	return g
+}
+
+func keys(m map[string]int) []string {
+	var ks []string
+	for k := range m {
+		ks = append(ks, k)
+	}
+	return ks
+}
+
+func sorted(s []string) []string {
+	s = slices.Clone(s)
+	sort.Strings(s)
+	if len(s) == 0 {
+		return nil
+	}
+	return s
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		layers map[string]int
+		edges  map[string][]string
+		want   []string // "node kind", sorted by node
+	}{
+		{
+			name:   "valid diamond",
+			layers: map[string]int{"a": 1, "b": 1, "c": 2},
+			edges:  map[string][]string{"input": {"a", "b"}, "a": {"c"}, "b": {"c"}},
+		},
+		{
+			name:   "parentless nodes hang off the root",
+			layers: map[string]int{"a": 1, "b": 2},
+			edges:  map[string][]string{"a": {"b"}},
+		},
+		{
+			name:   "dangling child",
+			layers: map[string]int{"a": 1},
+			edges:  map[string][]string{"input": {"a"}, "a": {"ghost"}},
+			want:   []string{"a " + ProblemDanglingEdge},
+		},
+		{
+			name:   "child in its parent's layer",
+			layers: map[string]int{"a": 1, "b": 1},
+			edges:  map[string][]string{"input": {"a"}, "a": {"b"}},
+			want:   []string{"b " + ProblemLayerOrder},
+		},
+		{
+			name:   "parentless node in layer 0",
+			layers: map[string]int{"a": 0},
+			want:   []string{"a " + ProblemLayerOrder},
+		},
+		{
+			name:   "edge back into the root",
+			layers: map[string]int{"a": 1},
+			edges:  map[string][]string{"input": {"a"}, "a": {"input"}},
+			want:   []string{"a " + ProblemCycle},
+		},
+		{
+			name:   "cycle cut off from the root",
+			layers: map[string]int{"a": 1, "b": 2, "c": 3},
+			edges:  map[string][]string{"input": {"a"}, "b": {"c"}, "c": {"b"}},
+			want:   []string{"b " + ProblemCycle, "b " + ProblemOrphan, "b " + ProblemLayerOrder, "c " + ProblemOrphan},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, p := range buildDAG(tt.layers, tt.edges).Validate() {
+				got = append(got, p.NodeID+" "+p.Kind)
+			}
+			if !slices.Equal(sorted(got), sorted(tt.want)) {
+				t.Errorf("Validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDuplicateID(t *testing.T) {
+	g := buildDAG(map[string]int{"a": 1}, map[string][]string{"input": {"a"}})
+	// a loader that read "a" twice placed both copies
+	g.addToMatrix(&Node{ID: "a", Layer: 2})
+
+	problems := g.Validate()
+	if len(problems) != 1 || problems[0].Kind != ProblemDuplicateID || problems[0].NodeID != "a" {
+		t.Errorf("Validate() = %v, want one duplicate-id for a", problems)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	// c sits left of its parent b and d closes a cycle with e
+	g := buildDAG(map[string]int{"a": 1, "b": 2, "c": 1, "d": 3, "e": 4},
+		map[string][]string{"input": {"a", "d"}, "a": {"b"}, "b": {"c"}, "d": {"e"}, "e": {"d"}})
+
+	var warnings []string
+	for _, p := range g.Validate() {
+		if p.Warning() {
+			warnings = append(warnings, p.NodeID+" "+p.Kind)
+		}
+	}
+	if want := []string{"c " + ProblemLayerOrder, "d " + ProblemLayerOrder}; !slices.Equal(warnings, want) {
+		t.Errorf("warnings = %v, want %v", warnings, want)
+	}
+
+	errs := Errors(g.Validate())
+	if len(errs) != 1 || errs[0].Kind != ProblemCycle {
+		t.Errorf("Errors() = %v, want only the cycle", errs)
+	}
+	if errs := Errors(buildDAG(map[string]int{"a": 2, "b": 1}, map[string][]string{"input": {"a"}, "a": {"b"}}).Validate()); errs != nil {
+		t.Errorf("Errors() of a misdrawn graph = %v", errs)
+	}
+}
@@ -0,0 +1,655 @@
+package pipeline
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/MKlolbullen/termaid/internal/graph"
+)
+
+/* ─────────────────────────── Built-in Nodes ─────────────────────────── */
+
+// Builtin is a node kind termaid runs in-process on the records of its input
+// instead of executing a tool, so it needs nothing on PATH. A node uses one
+// by naming it as its tool, prefixed with BuiltinPrefix so it never takes
+// the place of a binary of the same name; its args configure it.
+type Builtin struct {
+	Name  string
+	Desc  string
+	In    string   // port type read
+	Out   string   // port type written
+	Usage string   // the args it takes
+	Def   []string // default args
+
+	hidden  bool // inserted by termaid, not picked from the catalog
+	compile func(node *graph.Node, args, parents []string) (transform, error)
+}
+
+// BuiltinPrefix starts the tool name of every built-in node: "builtin:grep"
+// filters in-process, "grep" runs grep.
+const BuiltinPrefix = "builtin:"
+
+// ConvertTool is the built-in node that turns its parent's output from the
+// node's In type into its Out type. InsertConversions adds one wherever two
+// connected nodes disagree on the data type.
+const ConvertTool = BuiltinPrefix + "convert"
+
+// transform produces a built-in node's output values from its input.
+type transform func(in builtinInput) []string
+
+// builtinInput is what a built-in node reads: the records of its merged
+// input and, for set operations, which values each parent contributed.
+type builtinInput struct {
+	records []DataRecord
+	parents []string
+	values  func(parent string) map[string]bool
+}
+
+var builtins = map[string]Builtin{}
+
+func init() {
+	for _, b := range []Builtin{
+		{Name: ConvertTool, Desc: "Convert between data types", hidden: true, compile: compileConvert},
+		{Name: BuiltinPrefix + "dedupe", Desc: "Drop duplicate records", In: PortAny, Out: PortAny,
+			Usage: "[FIELD]", compile: compileDedupe},
+		{Name: BuiltinPrefix + "grep", Desc: "Keep records matching a regex", In: PortAny, Out: PortAny,
+			Usage: "[-i] [-v] PATTERN... [-x PATTERN]...", compile: compileGrep},
+		{Name: BuiltinPrefix + "filter", Desc: "Keep records a condition holds for", In: PortAny, Out: PortAny,
+			Usage: "CONDITION", Def: []string{"value", "~", "/./"}, compile: compileFilter},
+		{Name: BuiltinPrefix + "extract", Desc: "Extract one field of each record", In: PortAny, Out: PortAny,
+			Usage: "FIELD", Def: []string{"url"}, compile: compileExtract},
+		{Name: BuiltinPrefix + "unfurl", Desc: "Extract parts of URLs", In: PortURLs, Out: PortAny,
+			Usage: "[-u] domains|apexes|paths|keys|values|keypairs|schemes|ports", Def: []string{"-u", "domains"}, compile: compileUnfurl},
+		{Name: BuiltinPrefix + "sort", Desc: "Sort records", In: PortAny, Out: PortAny,
+			Usage: "[-r] [-u]", compile: compileSort},
+		{Name: BuiltinPrefix + "sortuniq", Desc: "Sort records and drop duplicates", In: PortAny, Out: PortAny,
+			Usage: "[-r]", compile: compileSortUniq},
+		{Name: BuiltinPrefix + "head", Desc: "Keep the first N records", In: PortAny, Out: PortAny,
+			Usage: "[N]", Def: []string{"10"}, compile: compileHead},
+		{Name: BuiltinPrefix + "union", Desc: "Records from any parent", In: PortAny, Out: PortAny,
+			compile: compileUnion},
+		{Name: BuiltinPrefix + "intersect", Desc: "Records every parent produced", In: PortAny, Out: PortAny,
+			compile: compileIntersect},
+		{Name: BuiltinPrefix + "difference", Desc: "Records of one parent no other produced", In: PortAny, Out: PortAny,
+			Usage: "[NODE]", compile: compileDifference},
+	} {
+		builtins[b.Name] = b
+	}
+}
+
+// Builtins lists the built-in node kinds the builder offers, by name.
+func Builtins() []Builtin {
+	var list []Builtin
+	for _, b := range builtins {
+		if !b.hidden {
+			list = append(list, b)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// IsBuiltin reports whether tool names a built-in node kind.
+func IsBuiltin(tool string) bool {
+	_, ok := builtins[tool]
+	return ok
+}
+
+// builtinFor returns the built-in kind a node runs, if any. Shell nodes
+// always run their command line.
+func builtinFor(node *graph.Node) (Builtin, bool) {
+	if node.Shell {
+		return Builtin{}, false
+	}
+	b, ok := builtins[node.Tool]
+	return b, ok
+}
+
+/* ─── kinds ─── */
+
+func compileConvert(node *graph.Node, _, _ []string) (transform, error) {
+	chain, ok := Bridge(node.In, node.Out)
+	if !ok {
+		return nil, fmt.Errorf("cannot convert %s into %s", node.In, node.Out)
+	}
+	return func(in builtinInput) []string {
+		var out []string
+		for _, rec := range in.records {
+			if v, ok := convertValue(rec.Value, chain); ok {
+				out = append(out, v)
+			}
+		}
+		return unique(out)
+	}, nil
+}
+
+func compileDedupe(_ *graph.Node, args, _ []string) (transform, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("takes at most one field")
+	}
+	return func(in builtinInput) []string {
+		seen := make(map[string]bool)
+		var out []string
+		for _, rec := range in.records {
+			key := rec.Value
+			if len(args) == 1 {
+				if v, ok := recordField(rec, args[0]); ok {
+					key = v
+				}
+			}
+			if !seen[key] {
+				seen[key] = true
+				out = append(out, rec.Value)
+			}
+		}
+		return out
+	}, nil
+}
+
+func compileGrep(_ *graph.Node, args, _ []string) (transform, error) {
+	var flags string
+	var invert bool
+	var include, exclude []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-i":
+			flags = "(?i)"
+		case "-v":
+			invert = true
+		case "-x":
+			if i+1 == len(args) {
+				return nil, fmt.Errorf("-x needs a pattern")
+			}
+			i++
+			exclude = append(exclude, args[i])
+		default:
+			include = append(include, args[i])
+		}
+	}
+	if invert {
+		include, exclude = nil, append(exclude, include...)
+	}
+	if len(include)+len(exclude) == 0 {
+		return nil, fmt.Errorf("needs a pattern")
+	}
+
+	inc, err := compilePatterns(flags, include)
+	if err != nil {
+		return nil, err
+	}
+	exc, err := compilePatterns(flags, exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(in builtinInput) []string {
+		var out []string
+		for _, rec := range in.records {
+			if (len(inc) == 0 || matchesAny(inc, rec.Value)) && !matchesAny(exc, rec.Value) {
+				out = append(out, rec.Value)
+			}
+		}
+		return out
+	}, nil
+}
+
+func compilePatterns(flags string, patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(flags + unquote(p))
+		if err != nil {
+			return nil, fmt.Errorf("bad regex %q: %w", p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func matchesAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileFilter keeps the records an edge-condition expression holds for,
+// each record judged on its own: "status_code == 200 && value ~ /admin/".
+func compileFilter(_ *graph.Node, args, _ []string) (transform, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("needs a condition")
+	}
+	cond, err := parseCondition(strings.Join(args, " "))
+	if err != nil {
+		return nil, err
+	}
+	if cond.isElse {
+		return nil, fmt.Errorf("else means nothing here")
+	}
+
+	return func(in builtinInput) []string {
+		var out []string
+		for _, rec := range in.records {
+			one := []DataRecord{rec}
+			if cond.eval(conditionInput{lines: 1, records: func() []DataRecord { return one }}) {
+				out = append(out, rec.Value)
+			}
+		}
+		return out
+	}, nil
+}
+
+func compileExtract(_ *graph.Node, args, _ []string) (transform, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("needs exactly one field")
+	}
+	return func(in builtinInput) []string {
+		var out []string
+		for _, rec := range in.records {
+			if v, ok := recordField(rec, args[0]); ok && v != "" {
+				out = append(out, v)
+			}
+		}
+		return out
+	}, nil
+}
+
+// unfurlModes pull one part, or several, out of a URL.
+var unfurlModes = map[string]func(u *url.URL) []string{
+	"domains": func(u *url.URL) []string { return []string{u.Hostname()} },
+	"apexes": func(u *url.URL) []string {
+		if apex, ok := apexDomain(u.Hostname()); ok {
+			return []string{apex}
+		}
+		return nil
+	},
+	"paths":   func(u *url.URL) []string { return []string{u.EscapedPath()} },
+	"schemes": func(u *url.URL) []string { return []string{u.Scheme} },
+	"ports":   func(u *url.URL) []string { return []string{u.Port()} },
+	"keys": func(u *url.URL) []string {
+		var keys []string
+		for k := range u.Query() {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return keys
+	},
+	"values": func(u *url.URL) []string {
+		var values []string
+		for _, vs := range u.Query() {
+			values = append(values, vs...)
+		}
+		sort.Strings(values)
+		return values
+	},
+	"keypairs": func(u *url.URL) []string {
+		var pairs []string
+		for k, vs := range u.Query() {
+			for _, v := range vs {
+				pairs = append(pairs, k+"="+v)
+			}
+		}
+		sort.Strings(pairs)
+		return pairs
+	},
+}
+
+// unfurlAliases are other spellings of the modes: domain and host for
+// domains, params for keys, and apex, path, scheme and port for their plurals.
+var unfurlAliases = map[string]string{
+	"host": "domains", "domain": "domains", "apex": "apexes", "path": "paths",
+	"params": "keys", "scheme": "schemes", "port": "ports",
+}
+
+func compileUnfurl(_ *graph.Node, args, _ []string) (transform, error) {
+	uniq := false
+	var mode string
+	for _, a := range args {
+		switch {
+		case a == "-u":
+			uniq = true
+		case mode != "":
+			return nil, fmt.Errorf("takes one mode")
+		default:
+			mode = a
+		}
+	}
+	if m, ok := unfurlAliases[mode]; ok {
+		mode = m
+	}
+	part, ok := unfurlModes[mode]
+	if !ok {
+		return nil, fmt.Errorf("unknown mode %q", mode)
+	}
+
+	return func(in builtinInput) []string {
+		var out []string
+		for _, rec := range in.records {
+			raw := rec.Value
+			if strings.HasPrefix(raw, "{") {
+				if v, ok := recordField(rec, "url"); ok {
+					raw = v
+				}
+			}
+			if !strings.Contains(raw, "://") {
+				raw = "http://" + raw
+			}
+			u, err := url.Parse(raw)
+			if err != nil || u.Host == "" {
+				continue
+			}
+			for _, v := range part(u) {
+				if v != "" {
+					out = append(out, v)
+				}
+			}
+		}
+		if uniq {
+			out = unique(out)
+		}
+		return out
+	}, nil
+}
+
+func compileSort(_ *graph.Node, args, _ []string) (transform, error) {
+	var reverse, uniq bool
+	for _, a := range args {
+		switch a {
+		case "-r":
+			reverse = true
+		case "-u":
+			uniq = true
+		default:
+			return nil, fmt.Errorf("unknown flag %q", a)
+		}
+	}
+	return func(in builtinInput) []string {
+		out := values(in.records)
+		if uniq {
+			out = unique(out)
+		}
+		sort.Strings(out)
+		if reverse {
+			sort.Sort(sort.Reverse(sort.StringSlice(out)))
+		}
+		return out
+	}, nil
+}
+
+func compileSortUniq(node *graph.Node, args, _ []string) (transform, error) {
+	return compileSort(node, append([]string{"-u"}, args...), nil)
+}
+
+func compileHead(_ *graph.Node, args, _ []string) (transform, error) {
+	if len(args) == 2 && args[0] == "-n" {
+		args = args[1:]
+	}
+	n := 10
+	if len(args) == 1 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 0 {
+			return nil, fmt.Errorf("bad count %q", args[0])
+		}
+	} else if len(args) > 1 {
+		return nil, fmt.Errorf("takes one count")
+	}
+
+	return func(in builtinInput) []string {
+		out := values(in.records)
+		return out[:min(n, len(out))]
+	}, nil
+}
+
+func compileUnion(_ *graph.Node, _, _ []string) (transform, error) {
+	return func(in builtinInput) []string { return unique(values(in.records)) }, nil
+}
+
+func compileIntersect(_ *graph.Node, _, _ []string) (transform, error) {
+	return func(in builtinInput) []string {
+		var out []string
+		for _, v := range unique(values(in.records)) {
+			all := true
+			for _, p := range in.parents {
+				if !in.values(p)[v] {
+					all = false
+					break
+				}
+			}
+			if all {
+				out = append(out, v)
+			}
+		}
+		return out
+	}, nil
+}
+
+func compileDifference(_ *graph.Node, args, parents []string) (transform, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("takes at most one node")
+	}
+	if len(args) == 1 && !slices.Contains(parents, args[0]) {
+		return nil, fmt.Errorf("%s is not a parent (have %s)", args[0], strings.Join(parents, ", "))
+	}
+	return func(in builtinInput) []string {
+		if len(in.parents) == 0 {
+			return nil
+		}
+		from := in.parents[0]
+		if len(args) == 1 {
+			from = args[0]
+		}
+
+		var out []string
+		for _, v := range unique(values(in.records)) {
+			if !in.values(from)[v] {
+				continue
+			}
+			elsewhere := false
+			for _, p := range in.parents {
+				if p != from && in.values(p)[v] {
+					elsewhere = true
+					break
+				}
+			}
+			if !elsewhere {
+				out = append(out, v)
+			}
+		}
+		return out
+	}, nil
+}
+
+func values(records []DataRecord) []string {
+	out := make([]string, len(records))
+	for i, rec := range records {
+		out[i] = rec.Value
+	}
+	return out
+}
+
+// unique drops repeated values, keeping the first of each.
+func unique(in []string) []string {
+	seen := make(map[string]bool, len(in))
+	var out []string
+	for _, v := range in {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+/* ─── execution ─── */
+
+// compileBuiltin expands a built-in node's args and compiles them. parents
+// are the node's parents in the workflow.
+func compileBuiltin(node *graph.Node, b Builtin, parents []string, vars map[string]string) (transform, error) {
+	args, _, err := expandArgs(splitWords(node.Args), vars, nil)
+	if err != nil {
+		return nil, err
+	}
+	fn, err := b.compile(node, args, parents)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name, err)
+	}
+	return fn, nil
+}
+
+// runBuiltin runs a built-in node in-process and records its output like a
+// tool's.
+func (s *scheduler) runBuiltin(node *graph.Node, b Builtin, inputs []string, catName, catDir, inputPath string) {
+	start := time.Now()
+	s.out <- Status{Type: StatusStart, Category: catName, Tool: node.ID}
+	if err := s.df.SetNodeState(node.ID, NodeRunning); err != nil {
+		log.Debug("Failed to checkpoint node state", "node", node.ID, "error", err)
+	}
+
+	outputFile := filepath.Join(catDir, fmt.Sprintf("%s-%d.txt", node.ID, start.Unix()))
+	in, out, err := s.applyBuiltin(node, b, inputs, inputPath, outputFile)
+	if err != nil {
+		s.out <- Status{Type: StatusError, Category: catName, Tool: node.ID, Err: err}
+		s.df.RecordNodeOutput(node.ID, node.Tool, start, time.Now(), 1, nil, err.Error())
+		return
+	}
+
+	s.df.RecordNodeOutput(node.ID, node.Tool, start, time.Now(), 0, []string{outputFile}, "")
+	meta := map[string]string{
+		"builtin":     b.Name,
+		"records_in":  strconv.Itoa(in),
+		"records_out": strconv.Itoa(out),
+	}
+	if b.Name == ConvertTool {
+		meta["conversion"] = node.In + " → " + node.Out
+	}
+	s.df.AnnotateNode(node.ID, meta)
+	s.out <- Status{Type: StatusFinish, Category: catName, Tool: node.ID}
+
+	if err := s.df.ProcessNodeOutputs(node.ID); err != nil {
+		log.Debug("Failed to process node outputs", "node", node.ID, "error", err)
+	}
+}
+
+// applyBuiltin reads the node's input, transforms it and writes the result,
+// one value per line.
+func (s *scheduler) applyBuiltin(node *graph.Node, b Builtin, inputs []string, inputPath, outputFile string) (in, out int, err error) {
+	fn, err := compileBuiltin(node, b, s.parents[node.ID], nodeVars(s.vars, node.ID, inputPath, outputFile))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// a single parent's records keep the type its output port declares
+	source := node.ID
+	if len(inputs) == 1 {
+		source = inputs[0]
+	}
+	records, err := s.df.parseFile(inputPath, source)
+	if err != nil {
+		return 0, 0, err
+	}
+	records = s.df.parentRecords(records, inputs)
+
+	result := fn(builtinInput{
+		records: records,
+		parents: inputs,
+		values:  s.df.parentValues(records),
+	})
+
+	f, err := os.Create(outputFile)
+	if err != nil {
+		return len(records), 0, err
+	}
+	w := bufio.NewWriter(f)
+	for _, v := range result {
+		fmt.Fprintln(w, v)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return len(records), 0, err
+	}
+	return len(records), len(result), f.Close()
+}
+
+// parentRecords swaps each input record for the one a parent produced with
+// the same value, so fields a parser found survive the merged input file,
+// which keeps only values.
+func (df *DataFlow) parentRecords(input []DataRecord, parents []string) []DataRecord {
+	byValue := make(map[string]DataRecord, len(input))
+	for _, p := range parents {
+		for _, file := range df.outputFiles(p) {
+			recs, err := df.parseFile(file, p)
+			if err != nil {
+				continue
+			}
+			for _, rec := range recs {
+				if _, seen := byValue[rec.Value]; !seen {
+					byValue[rec.Value] = rec
+				}
+			}
+		}
+	}
+
+	out := make([]DataRecord, len(input))
+	for i, rec := range input {
+		if full, ok := byValue[rec.Value]; ok {
+			rec = full
+		}
+		out[i] = rec
+	}
+	return out
+}
+
+// outputFiles returns the files nodeID wrote.
+func (df *DataFlow) outputFiles(nodeID string) []string {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+
+	if out, ok := df.NodeOutputs[nodeID]; ok {
+		return append([]string(nil), out.OutputFiles...)
+	}
+	return nil
+}
+
+// parentValues returns a lookup of the values each parent produced, limited
+// to those that made it into the node's (scoped) input. Parents are read
+// once, on first use.
+func (df *DataFlow) parentValues(input []DataRecord) func(parent string) map[string]bool {
+	allowed := make(map[string]bool, len(input))
+	for _, rec := range input {
+		allowed[rec.Value] = true
+	}
+
+	loaded := make(map[string]map[string]bool)
+	return func(parent string) map[string]bool {
+		if vals, ok := loaded[parent]; ok {
+			return vals
+		}
+
+		vals := make(map[string]bool)
+		for _, file := range df.outputFiles(parent) {
+			recs, err := df.parseFile(file, parent)
+			if err != nil {
+				continue
+			}
+			for _, rec := range recs {
+				if allowed[rec.Value] {
+					vals[rec.Value] = true
+				}
+			}
+		}
+		loaded[parent] = vals
+		return vals
+	}
+}
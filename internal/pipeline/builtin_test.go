@@ -0,0 +1,157 @@
+package pipeline
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/MKlolbullen/termaid/internal/graph"
+)
+
+func TestBuiltins(t *testing.T) {
+	urls := []string{
+		"https://a.example.com/admin?id=1&q=x",
+		"https://b.example.com:8443/login",
+		"https://a.example.com/admin?id=1&q=x",
+		"http://c.example.org/",
+	}
+	// which parent produced each value, for the set operations
+	byParent := map[string][]string{
+		"subfinder": {"a.example.com", "b.example.com", "c.example.com"},
+		"amass":     {"b.example.com", "c.example.com", "d.example.com"},
+		"crtsh":     {"c.example.com"},
+	}
+	hosts := unique(append(append(slices.Clone(byParent["subfinder"]), byParent["amass"]...), byParent["crtsh"]...))
+
+	tests := []struct {
+		name    string
+		tool    string
+		args    string
+		parents []string
+		in      []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "dedupe", tool: "dedupe", in: urls, want: []string{urls[0], urls[1], urls[3]}},
+		{name: "dedupe by field", tool: "dedupe", args: "status", in: []string{`{"status":1,"n":1}`, `{"status":1,"n":2}`, `{"status":2}`},
+			want: []string{`{"status":1,"n":1}`, `{"status":2}`}},
+		{name: "grep", tool: "grep", args: "admin", in: urls, want: []string{urls[0], urls[2]}},
+		{name: "grep case-insensitive", tool: "grep", args: "-i ADMIN", in: urls, want: []string{urls[0], urls[2]}},
+		{name: "grep invert", tool: "grep", args: "-v example.com", in: urls, want: []string{urls[3]}},
+		{name: "grep exclude", tool: "grep", args: "example -x login -x org", in: urls, want: []string{urls[0], urls[2]}},
+		{name: "grep quoted pattern with a space", tool: "grep", args: `"a b"`, in: []string{"a b", "ab"}, want: []string{"a b"}},
+		{name: "grep without a pattern", tool: "grep", args: "-i", wantErr: true},
+		{name: "grep bad regex", tool: "grep", args: "(", wantErr: true},
+		{name: "filter", tool: "filter", args: `value ~ /login|org/`, in: urls, want: []string{urls[1], urls[3]}},
+		{name: "filter json field", tool: "filter", args: "status_code >= 400", in: []string{`{"status_code":200}`, `{"status_code":404}`},
+			want: []string{`{"status_code":404}`}},
+		{name: "filter else", tool: "filter", args: "else", wantErr: true},
+		{name: "extract", tool: "extract", args: "url", in: []string{`{"url":"https://a"}`, `{"host":"b"}`}, want: []string{"https://a"}},
+		{name: "extract two fields", tool: "extract", args: "url host", wantErr: true},
+		{name: "unfurl domains", tool: "unfurl", args: "-u domains", in: urls, want: []string{"a.example.com", "b.example.com", "c.example.org"}},
+		{name: "unfurl apexes", tool: "unfurl", args: "-u apex", in: urls, want: []string{"example.com", "example.org"}},
+		{name: "unfurl keys", tool: "unfurl", args: "-u keys", in: urls, want: []string{"id", "q"}},
+		{name: "unfurl keypairs", tool: "unfurl", args: "keypairs", in: urls[:1], want: []string{"id=1", "q=x"}},
+		{name: "unfurl ports", tool: "unfurl", args: "ports", in: urls, want: []string{"8443"}},
+		{name: "unfurl unknown mode", tool: "unfurl", args: "fragments", wantErr: true},
+		{name: "sort", tool: "sort", in: []string{"b", "a", "b"}, want: []string{"a", "b", "b"}},
+		{name: "sort reverse unique", tool: "sort", args: "-r -u", in: []string{"b", "a", "b"}, want: []string{"b", "a"}},
+		{name: "sortuniq", tool: "sortuniq", in: []string{"b", "a", "b"}, want: []string{"a", "b"}},
+		{name: "sort unknown flag", tool: "sort", args: "-n", wantErr: true},
+		{name: "head", tool: "head", args: "2", in: urls, want: urls[:2]},
+		{name: "head -n", tool: "head", args: "-n 1", in: urls, want: urls[:1]},
+		{name: "head more than there is", tool: "head", args: "10", in: urls[:1], want: urls[:1]},
+		{name: "head bad count", tool: "head", args: "-1", wantErr: true},
+		{name: "union", tool: "union", parents: []string{"subfinder", "amass"}, in: hosts,
+			want: hosts},
+		{name: "intersect", tool: "intersect", parents: []string{"subfinder", "amass", "crtsh"}, in: hosts,
+			want: []string{"c.example.com"}},
+		{name: "difference of the first parent", tool: "difference", parents: []string{"subfinder", "amass"}, in: hosts,
+			want: []string{"a.example.com"}},
+		{name: "difference of a named parent", tool: "difference", args: "amass", parents: []string{"subfinder", "amass"}, in: hosts,
+			want: []string{"d.example.com"}},
+		{name: "difference of a node that is not a parent", tool: "difference", args: "crtsh", parents: []string{"subfinder", "amass"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &graph.Node{ID: tt.tool + "-1", Tool: BuiltinPrefix + tt.tool, Args: tt.args}
+			fn, err := compileBuiltin(node, builtins[node.Tool], tt.parents, nil)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("compiled %s %q, want an error", tt.tool, tt.args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			records := make([]DataRecord, len(tt.in))
+			for i, v := range tt.in {
+				records[i] = DataRecord{Value: v}
+			}
+			got := fn(builtinInput{
+				records: records,
+				parents: tt.parents,
+				values: func(parent string) map[string]bool {
+					vals := make(map[string]bool)
+					for _, v := range byParent[parent] {
+						vals[v] = true
+					}
+					return vals
+				},
+			})
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("%s %q = %q, want %q", tt.tool, tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	node := &graph.Node{ID: "convert-1", Tool: ConvertTool, In: PortURLs, Out: PortHosts}
+	fn, err := compileBuiltin(node, builtins[ConvertTool], nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fn(builtinInput{records: []DataRecord{
+		{Value: "https://a.example.com/x"},
+		{Value: "http://a.example.com:8080/"},
+		{Value: "https://b.example.com"},
+	}})
+	if want := []string{"a.example.com", "b.example.com"}; !slices.Equal(got, want) {
+		t.Errorf("convert urls → hosts = %q, want %q", got, want)
+	}
+}
+
+func TestSchedulerBuiltins(t *testing.T) {
+	g := testDAG(t,
+		emits(t, "subfinder", []string{"input"}, "a.example.com", "b.example.com", "c.example.com"),
+		emits(t, "amass", []string{"input"}, "b.example.com", "d.example.com"),
+		testNode{id: "both", tool: "builtin:intersect", parents: []string{"subfinder", "amass"}},
+		testNode{id: "only-amass", tool: "builtin:difference", args: "amass", parents: []string{"subfinder", "amass"}},
+		testNode{id: "first", tool: "builtin:head", args: "1", parents: []string{"both"}},
+		// without the prefix head is the binary
+		testNode{id: "head", tool: "head", args: "-n 2 {{input}}", parents: []string{"subfinder"}},
+	)
+
+	df, _, err := runTestDAG(t, t.TempDir(), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for node, want := range map[string][]string{
+		"both":       {"b.example.com"},
+		"only-amass": {"d.example.com"},
+		"first":      {"b.example.com"},
+		"head":       {"a.example.com", "b.example.com"},
+	} {
+		if got := readLines(t, df, node); !slices.Equal(got, want) {
+			t.Errorf("%s wrote %q, want %q", node, got, want)
+		}
+	}
+	if meta := df.NodeOutputs["both"].Metadata; meta["builtin"] != "builtin:intersect" || meta["records_in"] != "4" {
+		t.Errorf("both metadata = %v", meta)
+	}
+	if _, ok := builtinFor(&graph.Node{Tool: "builtin:head", Shell: true}); ok {
+		t.Error("a shell node ran as a built-in")
+	}
+}
@@ -0,0 +1,158 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+/* ─────────────────────────── Result Cache ───────────────────────────── */
+
+// DefaultCacheTTL is how long a cached result stays valid for nodes that do
+// not set their own cache_ttl.
+const DefaultCacheTTL = 24 * time.Hour
+
+// Cache stores successful tool outputs keyed by what produced them: the tool
+// binary, its resolved arguments and the contents of its input file.
+type Cache struct {
+	Dir string
+}
+
+// cacheEntry is the metadata kept next to each cached output.
+type cacheEntry struct {
+	Key     string    `json:"key"`
+	NodeID  string    `json:"node_id"`
+	Tool    string    `json:"tool"`
+	Args    []string  `json:"args"`
+	Created time.Time `json:"created"`
+}
+
+// NewCache opens (creating if needed) a cache rooted at dir.
+func NewCache(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &Cache{Dir: dir}, nil
+}
+
+// cacheKey hashes the binary, the arguments with run-specific paths left as
+// placeholders, and the bytes of the input file.
+func cacheKey(tool *Tool, keyArgs []string, inputPath string) (string, error) {
+	h := sha256.New()
+
+	bin := tool.Command
+	if p, err := exec.LookPath(tool.Command); err == nil {
+		bin = p
+	}
+	fmt.Fprintf(h, "%s\x00shell=%t\x00stdin=%t\x00", bin, tool.Shell, tool.Stdin)
+	for _, a := range keyArgs {
+		fmt.Fprintf(h, "%s\x00", a)
+	}
+
+	f, err := os.Open(inputPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// restore copies a cached output younger than ttl into dst.
+func (c *Cache) restore(key string, ttl time.Duration, dst string) bool {
+	if c == nil || ttl <= 0 {
+		return false
+	}
+
+	data, err := os.ReadFile(filepath.Join(c.Dir, key, "entry.json"))
+	if err != nil {
+		return false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || time.Since(entry.Created) > ttl {
+		return false
+	}
+
+	return copyFile(filepath.Join(c.Dir, key, "output"), dst) == nil
+}
+
+// store saves src as the cached output for key. Both files are written
+// under temporary names and renamed into place, output first, so a restore
+// running alongside never reads half an entry.
+func (c *Cache) store(key string, tool *Tool, keyArgs []string, src string) error {
+	if c == nil {
+		return nil
+	}
+
+	dir := filepath.Join(c.Dir, key)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := replaceFile(filepath.Join(dir, "output"), func(tmp string) error {
+		return copyFile(src, tmp)
+	}); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(cacheEntry{
+		Key:     key,
+		NodeID:  tool.Name,
+		Tool:    tool.Command,
+		Args:    keyArgs,
+		Created: time.Now(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return replaceFile(filepath.Join(dir, "entry.json"), func(tmp string) error {
+		return os.WriteFile(tmp, data, 0o644)
+	})
+}
+
+// replaceFile has write fill a temporary file next to dst, then renames it
+// over dst.
+func replaceFile(dst string, write func(tmp string) error) error {
+	f, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+"-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	f.Close()
+
+	if err := write(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
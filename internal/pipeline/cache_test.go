@@ -0,0 +1,202 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/MKlolbullen/termaid/internal/graph"
+)
+
+func TestCacheKey(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.txt")
+	other := filepath.Join(dir, "other.txt")
+	if err := os.WriteFile(input, []byte("a.example.com\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(other, []byte("b.example.com\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	key := func(tool Tool, args []string, path string) string {
+		t.Helper()
+		k, err := cacheKey(&tool, args, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	cat := Tool{Name: "a", Command: "cat"}
+	base := key(cat, []string{"{{input}}"}, input)
+
+	// the node ID and where the input lives do not matter, only its bytes
+	renamed := cat
+	renamed.Name = "b"
+	copied := filepath.Join(dir, "copy.txt")
+	if err := copyFile(input, copied); err != nil {
+		t.Fatal(err)
+	}
+	if got := key(renamed, []string{"{{input}}"}, copied); got != base {
+		t.Errorf("same tool, args and input gave key %s, want %s", got, base)
+	}
+
+	shell := cat
+	shell.Shell = true
+	for name, got := range map[string]string{
+		"args":    key(cat, []string{"-n", "{{input}}"}, input),
+		"input":   key(cat, []string{"{{input}}"}, other),
+		"command": key(Tool{Name: "a", Command: "head"}, []string{"{{input}}"}, input),
+		"shell":   key(shell, []string{"{{input}}"}, input),
+	} {
+		if got == base {
+			t.Errorf("changing the %s kept the key", name)
+		}
+	}
+
+	if _, err := cacheKey(&cat, nil, filepath.Join(dir, "missing")); err == nil {
+		t.Error("cacheKey of a missing input succeeded")
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	cache, err := NewCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "out.txt")
+	if err := os.WriteFile(src, []byte("a.example.com\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tool := &Tool{Name: "a", Command: "cat"}
+	if err := cache.store("k", tool, []string{"{{input}}"}, src); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(dir, "restored.txt")
+	if !cache.restore("k", time.Hour, dst) {
+		t.Fatal("fresh entry was not restored")
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "a.example.com\n" {
+		t.Errorf("restored %q", data)
+	}
+	if cache.restore("k", 0, dst) {
+		t.Error("restored with caching off")
+	}
+	if cache.restore("missing", time.Hour, dst) {
+		t.Error("restored an entry that was never stored")
+	}
+	var none *Cache
+	if none.restore("k", time.Hour, dst) || none.store("k", tool, nil, src) != nil {
+		t.Error("a nil cache is not a no-op")
+	}
+
+	// age the entry past its lifetime
+	old := time.Now().Add(-2 * time.Hour)
+	if err := replaceFile(filepath.Join(cache.Dir, "k", "entry.json"), func(tmp string) error {
+		return os.WriteFile(tmp, []byte(`{"key":"k","created":"`+old.Format(time.RFC3339)+`"}`), 0o644)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if cache.restore("k", time.Hour, dst) {
+		t.Error("restored an entry older than the TTL")
+	}
+	if !cache.restore("k", 3*time.Hour, dst) {
+		t.Error("a longer TTL did not accept the same entry")
+	}
+}
+
+func TestNodeCacheTTL(t *testing.T) {
+	s := &scheduler{cache: &Cache{Dir: t.TempDir()}, cacheTTL: DefaultCacheTTL}
+	tests := []struct {
+		node graph.Node
+		want time.Duration
+	}{
+		{graph.Node{}, DefaultCacheTTL},
+		{graph.Node{CacheTTL: "6h"}, 6 * time.Hour},
+		{graph.Node{CacheTTL: "off"}, 0},
+		{graph.Node{CacheTTL: "0"}, 0},
+		{graph.Node{CacheTTL: "soon"}, DefaultCacheTTL},
+	}
+	for _, tt := range tests {
+		if got := s.nodeCacheTTL(&tt.node); got != tt.want {
+			t.Errorf("nodeCacheTTL(cache_ttl=%q) = %v, want %v", tt.node.CacheTTL, got, tt.want)
+		}
+	}
+
+	s.cache = nil // --no-cache
+	if got := s.nodeCacheTTL(&graph.Node{}); got != 0 {
+		t.Errorf("nodeCacheTTL without a cache = %v", got)
+	}
+}
+
+func TestSchedulerCache(t *testing.T) {
+	cacheDir := t.TempDir()
+	g := testDAG(t,
+		emits(t, "cached", []string{"input"}, "a.example.com"),
+		emits(t, "fresh", []string{"input"}, "b.example.com"),
+	)
+	g.Nodes["fresh"].CacheTTL = "off"
+
+	// two runs in separate work directories sharing one cache
+	run := func() map[string][]StatusUpdateType {
+		t.Helper()
+		df, err := NewDataFlow(t.TempDir(), "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := df.CreateSeedFile(); err != nil {
+			t.Fatal(err)
+		}
+		statuses, err := collect(func(out chan<- Status) error {
+			return runDataFlow(context.Background(), df, g, RunOptions{Concurrency: 2, CacheDir: cacheDir}, out)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := readLines(t, df, "cached"); !slices.Equal(got, []string{"a.example.com"}) {
+			t.Errorf("cached read %q", got)
+		}
+		return events(statuses)
+	}
+
+	run()
+	second := run()
+	if !slices.Equal(second["cached"], []StatusUpdateType{StatusCached}) {
+		t.Errorf("cached reported %v on the second run, want a cache hit", second["cached"])
+	}
+	if !slices.Equal(second["fresh"], []StatusUpdateType{StatusStart, StatusFinish}) {
+		t.Errorf("fresh reported %v on the second run, want it to run again", second["fresh"])
+	}
+}
+
+func TestRunDAGCachesByDefault(t *testing.T) {
+	workdir := t.TempDir()
+	g := testDAG(t, emits(t, "hosts", []string{"input"}, "a.example.com"))
+
+	run := func(opts RunOptions) []StatusUpdateType {
+		t.Helper()
+		statuses, err := collect(func(out chan<- Status) error {
+			return RunDAG(context.Background(), "example.com", workdir, g, opts, out)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return events(statuses)["hosts"]
+	}
+
+	ran := []StatusUpdateType{StatusStart, StatusFinish}
+	if got := run(RunOptions{}); !slices.Equal(got, ran) {
+		t.Errorf("first run reported %v, want %v", got, ran)
+	}
+	if got := run(RunOptions{}); !slices.Equal(got, []StatusUpdateType{StatusCached}) {
+		t.Errorf("second run reported %v, want a cache hit", got)
+	}
+	if got := run(RunOptions{NoCache: true}); !slices.Equal(got, ran) {
+		t.Errorf("run with NoCache reported %v, want %v", got, ran)
+	}
+}
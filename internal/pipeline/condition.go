@@ -0,0 +1,287 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/* ─────────────────────────── Edge Conditions ────────────────────────── */
+
+// condition is a compiled edge condition. The syntax is a set of clauses
+// joined by && and ||, with && binding tighter:
+//
+//	exit == 0                 exit code of the parent
+//	lines > 100               lines in the parent's output
+//	empty, !empty             output has no lines
+//	value ~ /admin/           any record's value matches the regex
+//	type == url               any record's type, source or metadata field
+//	status_code == 200        any JSON-lines record field (dotted paths allowed)
+//	else                      taken when no other condition on the parent is
+//
+// An optional if(...) wrapper is accepted, so the editor's
+// "if(http_status == 200)" form works as written.
+type condition struct {
+	src    string
+	isElse bool
+	anyOf  [][]clause // OR of ANDs
+}
+
+type clause struct {
+	negate bool
+	field  string // exit, lines, empty or a record field
+	op     string // ==, !=, >, >=, <, <=, ~
+	value  string
+	num    float64
+	isNum  bool
+	re     *regexp.Regexp
+}
+
+// conditionInput is what a condition is evaluated against. Records are
+// loaded only if a clause needs them.
+type conditionInput struct {
+	exitCode int
+	lines    int
+	records  func() []DataRecord
+}
+
+var clauseRe = regexp.MustCompile(`^(!?)\s*([A-Za-z_][\w.\-]*)\s*(?:(==|!=|>=|<=|=~|~|>|<)\s*(.+))?$`)
+
+func parseCondition(src string) (*condition, error) {
+	expr := strings.TrimSpace(src)
+	if strings.HasPrefix(expr, "if(") && strings.HasSuffix(expr, ")") {
+		expr = strings.TrimSpace(expr[3 : len(expr)-1])
+	}
+
+	c := &condition{src: src}
+	if expr == "else" {
+		c.isElse = true
+		return c, nil
+	}
+
+	for _, group := range splitUnquoted(expr, "||") {
+		var all []clause
+		for _, part := range splitUnquoted(group, "&&") {
+			cl, err := parseClause(strings.TrimSpace(part))
+			if err != nil {
+				return nil, fmt.Errorf("condition %q: %w", src, err)
+			}
+			all = append(all, cl)
+		}
+		c.anyOf = append(c.anyOf, all)
+	}
+
+	return c, nil
+}
+
+func parseClause(s string) (clause, error) {
+	m := clauseRe.FindStringSubmatch(s)
+	if m == nil {
+		return clause{}, fmt.Errorf("cannot parse %q", s)
+	}
+
+	cl := clause{negate: m[1] == "!", field: m[2], op: m[3], value: unquote(strings.TrimSpace(m[4]))}
+	if cl.op == "=~" {
+		cl.op = "~"
+	}
+
+	switch {
+	case cl.op == "" && cl.field != "empty":
+		return clause{}, fmt.Errorf("%q needs a comparison", s)
+	case cl.op != "" && cl.field == "empty":
+		return clause{}, fmt.Errorf("empty takes no comparison")
+	case cl.op == "~":
+		re, err := regexp.Compile(cl.value)
+		if err != nil {
+			return clause{}, fmt.Errorf("bad regex in %q: %w", s, err)
+		}
+		cl.re = re
+	case cl.op != "":
+		if n, err := strconv.ParseFloat(cl.value, 64); err == nil {
+			cl.num, cl.isNum = n, true
+		}
+	}
+
+	if (cl.field == "exit" || cl.field == "lines") && !cl.isNum {
+		return clause{}, fmt.Errorf("%s must be compared with a number", cl.field)
+	}
+
+	return cl, nil
+}
+
+// unquote strips a matching pair of double quotes, single quotes or slashes
+// around a value.
+func unquote(v string) string {
+	if len(v) >= 2 {
+		first, last := v[0], v[len(v)-1]
+		if first == last && (first == '"' || first == '\'' || first == '/') {
+			return v[1 : len(v)-1]
+		}
+	}
+	return v
+}
+
+// splitUnquoted splits s around every sep that is not inside "...", '...'
+// or a /regex/, keeping the quotes on the parts. A / opens a regex only at
+// the start of a word, so paths and URLs stay plain text; a quote that is
+// never closed is an ordinary character.
+func splitUnquoted(s string, seps ...string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); {
+		if end := quotedEnd(s, i); end > i {
+			i = end
+			continue
+		}
+		sep := ""
+		for _, c := range seps {
+			if strings.HasPrefix(s[i:], c) {
+				sep = c
+				break
+			}
+		}
+		if sep == "" {
+			i++
+			continue
+		}
+		parts = append(parts, s[start:i])
+		i += len(sep)
+		start = i
+	}
+	return append(parts, s[start:])
+}
+
+// quotedEnd returns the index just past the quoted span that opens at s[i],
+// or i when none does. A backslash escapes the next character.
+func quotedEnd(s string, i int) int {
+	q := s[i]
+	switch {
+	case q == '"' || q == '\'':
+	case q == '/' && (i == 0 || strings.IndexByte(" \t(!~=<>&|", s[i-1]) >= 0):
+	default:
+		return i
+	}
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case q:
+			return j + 1
+		}
+	}
+	return i
+}
+
+func (c *condition) eval(in conditionInput) bool {
+	for _, all := range c.anyOf {
+		ok := true
+		for _, cl := range all {
+			if !cl.eval(in) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (cl clause) eval(in conditionInput) bool {
+	var ok bool
+	switch cl.field {
+	case "empty":
+		ok = in.lines == 0
+	case "exit":
+		ok = cl.compare(strconv.Itoa(in.exitCode))
+	case "lines":
+		ok = cl.compare(strconv.Itoa(in.lines))
+	default:
+		for _, rec := range in.records() {
+			if v, found := recordField(rec, cl.field); found && cl.compare(v) {
+				ok = true
+				break
+			}
+		}
+	}
+	return ok != cl.negate
+}
+
+func (cl clause) compare(v string) bool {
+	if cl.op == "~" {
+		return cl.re.MatchString(v)
+	}
+
+	if cl.isNum {
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			switch cl.op {
+			case "==":
+				return n == cl.num
+			case "!=":
+				return n != cl.num
+			case ">":
+				return n > cl.num
+			case ">=":
+				return n >= cl.num
+			case "<":
+				return n < cl.num
+			case "<=":
+				return n <= cl.num
+			}
+		}
+	}
+
+	switch cl.op {
+	case "==":
+		return v == cl.value
+	case "!=":
+		return v != cl.value
+	}
+	return false
+}
+
+// recordField looks a field up on a record: its own fields first, then its
+// metadata, then the top level (or a dotted path) of a JSON-lines value.
+func recordField(rec DataRecord, field string) (string, bool) {
+	switch field {
+	case "value":
+		return rec.Value, true
+	case "type":
+		return rec.Type, true
+	case "source":
+		return rec.Source, true
+	}
+	if v, ok := rec.Metadata[field]; ok {
+		return v, true
+	}
+
+	if !strings.HasPrefix(rec.Value, "{") {
+		return "", false
+	}
+	var obj any
+	if err := json.Unmarshal([]byte(rec.Value), &obj); err != nil {
+		return "", false
+	}
+	for _, key := range strings.Split(field, ".") {
+		m, ok := obj.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		if obj, ok = m[key]; !ok {
+			return "", false
+		}
+	}
+
+	switch v := obj.(type) {
+	case string:
+		return v, true
+	case nil:
+		return "", false
+	default:
+		b, _ := json.Marshal(v)
+		return string(b), true
+	}
+}
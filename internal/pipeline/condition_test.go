@@ -0,0 +1,98 @@
+package pipeline
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseConditionErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		ok   bool
+	}{
+		{"exit", "exit == 0", true},
+		{"if wrapper", "if(status_code == 200)", true},
+		{"else", "else", true},
+		{"empty", "!empty", true},
+		{"and or", "exit == 0 && lines > 10 || empty", true},
+		{"regex", "value ~ /admin|login/", true},
+		{"no comparison", "status_code", false},
+		{"empty with comparison", "empty == 1", false},
+		{"exit not a number", "exit == zero", false},
+		{"bad regex", "value ~ /(/", false},
+		{"garbage", "== 200", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseCondition(tt.src)
+			if (err == nil) != tt.ok {
+				t.Errorf("parseCondition(%q) error = %v, want ok %v", tt.src, err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestConditionEval(t *testing.T) {
+	records := []DataRecord{
+		{Value: "https://a.example.com/admin", Type: "url", Source: "katana"},
+		{Value: `{"url":"https://b.example.com","status_code":200,"tech":{"name":"nginx"}}`, Type: "url"},
+		{Value: "c.example.com", Type: "domain", Metadata: map[string]string{"status": "404"}},
+	}
+	tests := []struct {
+		name  string
+		src   string
+		exit  int
+		lines int
+		want  bool
+	}{
+		{"exit zero", "exit == 0", 0, 3, true},
+		{"exit nonzero", "exit != 0", 0, 3, false},
+		{"lines above", "lines > 2", 0, 3, true},
+		{"lines at most", "lines <= 2", 0, 3, false},
+		{"empty", "empty", 0, 0, true},
+		{"not empty", "!empty", 0, 3, true},
+		{"regex on value", "value ~ /admin/", 0, 3, true},
+		{"regex with pipe", "value ~ /nothing|admin/", 0, 3, true},
+		{"quoted pipes stay in the value", `value == "a||b"`, 0, 3, false},
+		{"type", "type == domain", 0, 3, true},
+		{"json field", "status_code == 200", 0, 3, true},
+		{"json dotted path", "tech.name == nginx", 0, 3, true},
+		{"metadata", "status == 404", 0, 3, true},
+		{"missing field", "title == x", 0, 3, false},
+		{"negated clause", "!type == ip", 0, 3, true},
+		{"and binds tighter", "exit == 1 && lines > 0 || type == url", 0, 3, true},
+		{"and fails", "exit == 0 && type == ip", 0, 3, false},
+		{"if wrapper", "if(status_code >= 200)", 0, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseCondition(tt.src)
+			if err != nil {
+				t.Fatalf("parseCondition(%q): %v", tt.src, err)
+			}
+			in := conditionInput{exitCode: tt.exit, lines: tt.lines, records: func() []DataRecord { return records }}
+			if got := c.eval(in); got != tt.want {
+				t.Errorf("eval(%q) = %v, want %v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitUnquoted(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"a || b", []string{"a ", " b"}},
+		{"value ~ /a||b/ || c", []string{"value ~ /a||b/ ", " c"}},
+		{`x == "a||b" || y == 'c||d'`, []string{`x == "a||b" `, ` y == 'c||d'`}},
+		{"url == http://a||b", []string{"url == http://a", "b"}},
+		{`x == "open || y`, []string{`x == "open `, " y"}},
+	}
+	for _, tt := range tests {
+		if got := splitUnquoted(tt.in, "||"); !slices.Equal(got, tt.want) {
+			t.Errorf("splitUnquoted(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package pipeline
+
+import (
+	"context"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+/* ─────────────────────────── Run Control ────────────────────────────── */
+
+// Controller pauses, resumes and stops a running pipeline. While paused no
+// new node is started; running tools can optionally be frozen as well. A nil
+// *Controller is valid and never pauses.
+type Controller struct {
+	mu        sync.Mutex
+	cancel    context.CancelFunc
+	paused    bool
+	suspended bool                  // running process groups were sent SIGSTOP
+	resumed   chan struct{}         // closed when the current pause ends
+	procs     map[*exec.Cmd]string  // running tool → node ID, for logging
+	timeouts  map[*toolTimeout]bool // time limits of running attempts
+}
+
+// toolTimeout is one attempt's time limit. Its clock stops while the run's
+// tools are frozen.
+type toolTimeout struct {
+	timer *time.Timer
+	left  time.Duration // time remaining when the clock last stopped or started
+	since time.Time     // when the clock last started
+}
+
+// NewController derives a cancellable context for a run and the handle that
+// controls it.
+func NewController(parent context.Context) (context.Context, *Controller) {
+	ctx, cancel := context.WithCancel(parent)
+	return ctx, &Controller{
+		cancel:   cancel,
+		procs:    make(map[*exec.Cmd]string),
+		timeouts: make(map[*toolTimeout]bool),
+	}
+}
+
+// Pause stops new nodes from starting. With suspend set, tools that are
+// already running are frozen until Resume.
+func (c *Controller) Pause(suspend bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.paused {
+		c.paused = true
+		c.resumed = make(chan struct{})
+	}
+	if suspend && !c.suspended {
+		c.suspended = true
+		for cmd, id := range c.procs {
+			if err := suspendProcess(cmd); err != nil {
+				log.Debug("Failed to suspend tool", "tool", id, "error", err)
+			}
+		}
+		for t := range c.timeouts {
+			if t.timer.Stop() {
+				t.left -= time.Since(t.since)
+			} else {
+				t.left = 0 // already expired
+			}
+		}
+	}
+}
+
+// Resume continues frozen tools and lets pending nodes start again.
+func (c *Controller) Resume() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.suspended {
+		c.suspended = false
+		for cmd, id := range c.procs {
+			if err := resumeProcess(cmd); err != nil {
+				log.Debug("Failed to resume tool", "tool", id, "error", err)
+			}
+		}
+		for t := range c.timeouts {
+			if t.left > 0 {
+				t.since = time.Now()
+				t.timer.Reset(t.left)
+			}
+		}
+	}
+	if c.paused {
+		c.paused = false
+		close(c.resumed)
+	}
+}
+
+// Stop cancels the run and kills every running tool's process group right
+// away, so nothing outlives a caller that exits straight after.
+func (c *Controller) Stop() {
+	if c == nil {
+		return
+	}
+	c.cancel()
+	c.Resume()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for cmd, id := range c.procs {
+		if err := killProcess(cmd); err != nil {
+			log.Debug("Failed to kill tool", "tool", id, "error", err)
+		}
+	}
+}
+
+// Paused reports whether the run is currently paused.
+func (c *Controller) Paused() bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+// wait blocks while the run is paused.
+func (c *Controller) wait(ctx context.Context) error {
+	if c == nil {
+		return ctx.Err()
+	}
+	c.mu.Lock()
+	paused, resumed := c.paused, c.resumed
+	c.mu.Unlock()
+
+	if paused {
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+		}
+	}
+	return ctx.Err()
+}
+
+// withTimeout is context.WithTimeout for one attempt of a tool, except that
+// the clock stops while Pause has the run's tools frozen, so a frozen tool
+// does not time out. The context's cause is context.DeadlineExceeded when the
+// time runs out.
+func (c *Controller) withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if c == nil {
+		return context.WithTimeout(ctx, d)
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	t := &toolTimeout{left: d, since: time.Now()}
+
+	c.mu.Lock()
+	t.timer = time.AfterFunc(d, func() { cancel(context.DeadlineExceeded) })
+	if c.suspended {
+		t.timer.Stop()
+	}
+	c.timeouts[t] = true
+	c.mu.Unlock()
+
+	return ctx, func() {
+		c.mu.Lock()
+		t.timer.Stop()
+		delete(c.timeouts, t)
+		c.mu.Unlock()
+		cancel(context.Canceled)
+	}
+}
+
+// track registers a started tool so pause and resume can reach it. A tool
+// that starts while the run is frozen is frozen straight away. Tools are keyed
+// by process, since runs over several targets start the same node more than
+// once.
+func (c *Controller) track(id string, cmd *exec.Cmd) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.procs[cmd] = id
+	if c.suspended {
+		if err := suspendProcess(cmd); err != nil {
+			log.Debug("Failed to suspend tool", "tool", id, "error", err)
+		}
+	}
+}
+
+func (c *Controller) untrack(cmd *exec.Cmd) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.procs, cmd)
+}
@@ -0,0 +1,126 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitAsync calls ctl.wait in the background and delivers its result.
+func waitAsync(ctx context.Context, ctl *Controller) <-chan error {
+	res := make(chan error, 1)
+	go func() { res <- ctl.wait(ctx) }()
+	return res
+}
+
+func TestControllerPauseResume(t *testing.T) {
+	ctx, ctl := NewController(context.Background())
+	defer ctl.Stop()
+
+	if err := ctl.wait(ctx); err != nil {
+		t.Fatalf("wait before any pause = %v", err)
+	}
+
+	ctl.Pause(false)
+	ctl.Pause(false) // pausing twice needs a single resume
+	if !ctl.Paused() {
+		t.Fatal("Paused() = false after Pause")
+	}
+	res := waitAsync(ctx, ctl)
+	select {
+	case err := <-res:
+		t.Fatalf("wait returned %v while paused", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	ctl.Resume()
+	select {
+	case err := <-res:
+		if err != nil {
+			t.Errorf("wait after Resume = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("wait still blocked after Resume")
+	}
+	if ctl.Paused() {
+		t.Error("Paused() = true after Resume")
+	}
+	ctl.Resume() // resuming a running run is a no-op
+}
+
+func TestControllerStop(t *testing.T) {
+	ctx, ctl := NewController(context.Background())
+	ctl.Pause(false)
+	res := waitAsync(ctx, ctl)
+
+	ctl.Stop()
+	select {
+	case err := <-res:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("wait after Stop = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Stop did not release a paused waiter")
+	}
+	if ctl.Paused() {
+		t.Error("a stopped run still reports paused")
+	}
+	if err := ctl.wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait on a stopped run = %v", err)
+	}
+}
+
+func TestControllerNil(t *testing.T) {
+	var ctl *Controller
+	ctl.Pause(true)
+	ctl.Resume()
+	ctl.Stop()
+	ctl.track("x", nil)
+	ctl.untrack(nil)
+	if ctl.Paused() {
+		t.Error("nil controller reports paused")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := ctl.wait(ctx); err != nil {
+		t.Errorf("nil controller wait = %v", err)
+	}
+	cancel()
+	if err := ctl.wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("nil controller wait after cancel = %v", err)
+	}
+}
+
+func TestSchedulerPause(t *testing.T) {
+	g := testDAG(t, emits(t, "a", []string{"input"}, "a.example.com"))
+	df, err := NewDataFlow(t.TempDir(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := df.CreateSeedFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, ctl := NewController(context.Background())
+	ctl.Pause(false)
+	out := make(chan Status, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- runDataFlow(ctx, df, g, RunOptions{Concurrency: 1, Control: ctl, NoCache: true}, out)
+	}()
+
+	select {
+	case st := <-out:
+		t.Fatalf("%s reported %v while the run was paused", st.Tool, st.Type)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	ctl.Resume()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if st := <-out; st.Type != StatusStart {
+		t.Errorf("first status after resume = %v, want start", st.Type)
+	}
+}
@@ -6,9 +6,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/MKlolbullen/termaid/internal/graph"
 )
 
 // DataFlow manages file-based data flow between workflow nodes
@@ -17,6 +21,17 @@ type DataFlow struct {
 	RunID       string
 	NodeOutputs map[string]*NodeOutput
 	GlobalState *GlobalState
+
+	mu      sync.Mutex        // guards NodeOutputs and GlobalState across concurrent nodes; never held for file I/O
+	cpMu    sync.Mutex        // serialises checkpoint writes
+	cpSeq   uint64            // last checkpoint snapshot taken; guarded by mu
+	cpSaved uint64            // last snapshot on disk; guarded by cpMu
+	auditMu sync.Mutex        // serialises appends to the scope audit file
+	scope   *scopeRules       // filters node inputs; nil allows everything
+	types   map[string]string // node ID → type of the data it writes
+	parsers map[string]Parser // node ID → parser of its output
+	graph   *graph.DAG        // workflow whose edges feed node inputs; nil takes parent IDs as given
+	redact  *strings.Replacer // hides secret values in what the run writes to disk; nil hides nothing
 }
 
 // NodeOutput represents the output from a single tool execution
@@ -31,18 +46,38 @@ type NodeOutput struct {
 	Metadata    map[string]string `json:"metadata"`
 	LineCount   int               `json:"line_count"`
 	FileSize    int64             `json:"file_size"`
-	Format      string            `json:"format"` // txt, json, csv, xml
+	Format      string            `json:"format"`                // txt, json, csv, xml
+	Termination Termination       `json:"termination,omitempty"` // how the tool was stopped, if not by exiting
 }
 
+// Termination says how a failed tool process ended when that is more than a
+// plain non-zero exit
+type Termination string
+
+const (
+	TermTimeout        Termination = "timeout"
+	TermCancelled      Termination = "cancelled"
+	TermKilled         Termination = "killed (SIGKILL)" // SIGKILL from outside termaid: the OOM killer, a user, …
+	TermCPULimit       Termination = "cpu-limit"
+	TermMemoryLimit    Termination = "memory-limit"
+	TermOpenFilesLimit Termination = "open-files-limit"
+	TermFileSizeLimit  Termination = "file-size-limit"
+)
+
 // GlobalState tracks the overall workflow execution state
 type GlobalState struct {
-	RunID        string                 `json:"run_id"`
-	StartTime    time.Time              `json:"start_time"`
-	Domain       string                 `json:"domain"`
-	WorkflowPath string                 `json:"workflow_path"`
-	NodeStates   map[string]NodeStatus  `json:"node_states"`
-	DataLinks    map[string][]string    `json:"data_links"` // node_id -> input_files
-	Statistics   *ExecutionStatistics   `json:"statistics"`
+	RunID        string                `json:"run_id"`
+	StartTime    time.Time             `json:"start_time"`
+	Domain       string                `json:"domain"`
+	WorkflowPath string                `json:"workflow_path"`
+	NodeStates   map[string]NodeStatus `json:"node_states"`
+	DataLinks    map[string][]string   `json:"data_links"`             // node_id -> input_files
+	CachedNodes  map[string]string     `json:"cached_nodes,omitempty"` // node_id -> cache key
+	Status       RunStatus             `json:"status,omitempty"`       // overall outcome once the run ends
+	StatusReason string                `json:"status_reason,omitempty"`
+	Scope        *graph.Scope          `json:"scope,omitempty"` // scope enforced on node inputs
+	Vars         map[string]string     `json:"vars,omitempty"`  // run-time variable overrides
+	Statistics   *ExecutionStatistics  `json:"statistics"`
 }
 
 // NodeStatus tracks individual node execution status
@@ -56,15 +91,29 @@ const (
 	NodeSkipped
 )
 
+// RunStatus is the overall outcome of a run, worked out from the error
+// policies of the nodes that failed
+type RunStatus string
+
+const (
+	RunSucceeded RunStatus = "succeeded" // every node that ran succeeded
+	RunPartial   RunStatus = "partial"   // some nodes failed but none that mattered
+	RunFailed    RunStatus = "failed"    // a required-for-success node did not succeed
+	RunAborted   RunStatus = "aborted"   // an abort-workflow node failed
+	RunCancelled RunStatus = "cancelled" // stopped from outside
+)
+
 // ExecutionStatistics provides workflow execution metrics
 type ExecutionStatistics struct {
-	TotalNodes       int           `json:"total_nodes"`
-	CompletedNodes   int           `json:"completed_nodes"`
-	FailedNodes      int           `json:"failed_nodes"`
-	TotalResults     int           `json:"total_results"`
-	UniqueResults    int           `json:"unique_results"`
-	ExecutionTime    time.Duration `json:"execution_time"`
-	ParallelEfficiency float64     `json:"parallel_efficiency"`
+	TotalNodes         int           `json:"total_nodes"`
+	CompletedNodes     int           `json:"completed_nodes"`
+	FailedNodes        int           `json:"failed_nodes"`
+	CacheHits          int           `json:"cache_hits"`
+	ScopeDropped       int           `json:"scope_dropped"` // records kept out of node inputs by the scope
+	TotalResults       int           `json:"total_results"`
+	UniqueResults      int           `json:"unique_results"`
+	ExecutionTime      time.Duration `json:"execution_time"`
+	ParallelEfficiency float64       `json:"parallel_efficiency"`
 }
 
 // DataProcessor handles different data formats and transformations
@@ -103,9 +152,21 @@ type DataRecord struct {
 	Metadata   map[string]string `json:"metadata"`
 }
 
+// checkpoint is the on-disk form of a run's progress. It is rewritten after
+// every node transition so an interrupted run can be resumed.
+type checkpoint struct {
+	GlobalState *GlobalState           `json:"global_state"`
+	NodeOutputs map[string]*NodeOutput `json:"node_outputs"`
+}
+
+const checkpointFile = "state.json"
+
 // NewDataFlow creates a new data flow manager
 func NewDataFlow(workDir, domain string) (*DataFlow, error) {
-	runID := fmt.Sprintf("run-%d", time.Now().Unix())
+	runID, err := claimRunID(workDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create run directory: %w", err)
+	}
 	
 	df := &DataFlow{
 		WorkDir:     workDir,
@@ -121,11 +182,7 @@ func NewDataFlow(workDir, domain string) (*DataFlow, error) {
 		},
 	}
 	
-	// Create run-specific directory
 	runDir := filepath.Join(workDir, runID)
-	if err := os.MkdirAll(runDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create run directory: %w", err)
-	}
 	
 	// Create subdirectories for organization
 	dirs := []string{"raw", "processed", "merged", "analysis", "logs"}
@@ -138,6 +195,29 @@ func NewDataFlow(workDir, domain string) (*DataFlow, error) {
 	return df, nil
 }
 
+// claimRunID creates a fresh run directory and returns its name. Runs started
+// in the same second (several targets at once) get a numeric suffix.
+func claimRunID(workDir string) (string, error) {
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return "", err
+	}
+
+	base := fmt.Sprintf("run-%d", time.Now().Unix())
+	for i := 1; ; i++ {
+		runID := base
+		if i > 1 {
+			runID = fmt.Sprintf("%s-%d", base, i)
+		}
+		err := os.Mkdir(filepath.Join(workDir, runID), 0755)
+		if err == nil {
+			return runID, nil
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+	}
+}
+
 // CreateSeedFile creates the initial input file with the target domain
 func (df *DataFlow) CreateSeedFile() (string, error) {
 	seedPath := filepath.Join(df.WorkDir, df.RunID, "raw", "00-seed.txt")
@@ -148,6 +228,7 @@ func (df *DataFlow) CreateSeedFile() (string, error) {
 	}
 	
 	// Create seed node output record
+	df.mu.Lock()
 	df.NodeOutputs["seed"] = &NodeOutput{
 		NodeID:      "seed",
 		Tool:        "input",
@@ -160,46 +241,243 @@ func (df *DataFlow) CreateSeedFile() (string, error) {
 		Format:      "txt",
 		Metadata:    map[string]string{"type": "domain", "source": "user_input"},
 	}
-	
+	cp := df.snapshot()
+	df.mu.Unlock()
+	if err := df.saveCheckpoint(cp); err != nil {
+		return "", err
+	}
+
 	return seedPath, nil
 }
 
-// PrepareNodeInput prepares input files for a node based on its parents
+// LoadDataFlow restores an interrupted run from its checkpoint
+func LoadDataFlow(workDir, runID string) (*DataFlow, error) {
+	data, err := os.ReadFile(filepath.Join(workDir, runID, checkpointFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	if cp.GlobalState == nil || cp.GlobalState.RunID != runID {
+		return nil, fmt.Errorf("checkpoint does not belong to run %s", runID)
+	}
+
+	df := &DataFlow{
+		WorkDir:     workDir,
+		RunID:       runID,
+		NodeOutputs: cp.NodeOutputs,
+		GlobalState: cp.GlobalState,
+	}
+	if df.NodeOutputs == nil {
+		df.NodeOutputs = make(map[string]*NodeOutput)
+	}
+	if df.GlobalState.NodeStates == nil {
+		df.GlobalState.NodeStates = make(map[string]NodeStatus)
+	}
+	if df.GlobalState.DataLinks == nil {
+		df.GlobalState.DataLinks = make(map[string][]string)
+	}
+
+	// Only completed nodes carry over; everything else runs again
+	stats := &ExecutionStatistics{}
+	for _, state := range df.GlobalState.NodeStates {
+		if state == NodeCompleted {
+			stats.CompletedNodes++
+		}
+	}
+	df.GlobalState.Statistics = stats
+
+	return df, nil
+}
+
+// NodeState returns the recorded state of a node
+func (df *DataFlow) NodeState(nodeID string) NodeStatus {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+
+	return df.GlobalState.NodeStates[nodeID]
+}
+
+// SetRunStatus records the overall outcome of the run and why
+func (df *DataFlow) SetRunStatus(status RunStatus, reason string) error {
+	df.mu.Lock()
+	df.GlobalState.Status = status
+	df.GlobalState.StatusReason = reason
+	cp := df.snapshot()
+	df.mu.Unlock()
+
+	return df.saveCheckpoint(cp)
+}
+
+// RunStatus returns the overall outcome recorded for the run, if any
+func (df *DataFlow) RunStatus() RunStatus {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+
+	return df.GlobalState.Status
+}
+
+// SetNodeState records a node transition and checkpoints the run
+func (df *DataFlow) SetNodeState(nodeID string, state NodeStatus) error {
+	df.mu.Lock()
+	df.GlobalState.NodeStates[nodeID] = state
+	cp := df.snapshot()
+	df.mu.Unlock()
+
+	return df.saveCheckpoint(cp)
+}
+
+// ReusableOutput returns the output of a node that already completed in this
+// run, provided all of its output files are still on disk
+func (df *DataFlow) ReusableOutput(nodeID string) (*NodeOutput, bool) {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+
+	if df.GlobalState.NodeStates[nodeID] != NodeCompleted {
+		return nil, false
+	}
+	nodeOutput, exists := df.NodeOutputs[nodeID]
+	if !exists || len(nodeOutput.OutputFiles) == 0 {
+		return nil, false
+	}
+	for _, file := range nodeOutput.OutputFiles {
+		if _, err := os.Stat(file); err != nil {
+			return nil, false
+		}
+	}
+	return nodeOutput, true
+}
+
+// conditionInput collects what edge conditions leaving nodeID are evaluated
+// against. A node without recorded output counts as failed and empty.
+func (df *DataFlow) conditionInput(nodeID string) conditionInput {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+
+	nodeOutput, exists := df.NodeOutputs[nodeID]
+	if !exists {
+		return conditionInput{exitCode: 1, records: func() []DataRecord { return nil }}
+	}
+
+	files := append([]string(nil), nodeOutput.OutputFiles...)
+	var records []DataRecord
+	loaded := false
+
+	return conditionInput{
+		exitCode: nodeOutput.ExitCode,
+		lines:    nodeOutput.LineCount,
+		records: func() []DataRecord {
+			if !loaded {
+				loaded = true
+				for _, file := range files {
+					if recs, err := df.parseFile(file, nodeID); err == nil {
+						records = append(records, recs...)
+					}
+				}
+			}
+			return records
+		},
+	}
+}
+
+// PrepareNodeInput prepares input files for a node based on its parents.
+// parentIDs are the parents whose edge was taken; with a workflow set they
+// are checked against its edges and read in the graph's order.
 func (df *DataFlow) PrepareNodeInput(nodeID string, parentIDs []string, layer int) (string, error) {
+	// the lock covers the lookups only; files are read and written outside
+	// it so nodes preparing their input at once do not queue up
+	df.mu.Lock()
+	parentIDs, err := df.inputParents(nodeID, parentIDs)
+	outputs := make(map[string][]string, len(parentIDs))
+	for _, id := range parentIDs {
+		if out, ok := df.NodeOutputs[id]; ok {
+			outputs[id] = append([]string(nil), out.OutputFiles...)
+		}
+	}
+	df.mu.Unlock()
+
+	if err != nil {
+		return "", err
+	}
 	if len(parentIDs) == 0 {
 		return "", fmt.Errorf("no parent nodes specified for %s", nodeID)
 	}
 	
 	// For single parent, use its output directly
 	if len(parentIDs) == 1 {
-		parentOutput, exists := df.NodeOutputs[parentIDs[0]]
+		files, exists := outputs[parentIDs[0]]
 		if !exists {
 			return "", fmt.Errorf("parent node %s has no output", parentIDs[0])
 		}
 		
-		if len(parentOutput.OutputFiles) == 0 {
+		if len(files) == 0 {
 			return "", fmt.Errorf("parent node %s has no output files", parentIDs[0])
 		}
 		
 		// Use the merged output if available, otherwise the first output file
-		for _, file := range parentOutput.OutputFiles {
+		inputFile := files[0]
+		for _, file := range files {
 			if strings.Contains(file, "merged") {
-				df.GlobalState.DataLinks[nodeID] = []string{file}
-				return file, nil
+				inputFile = file
+				break
 			}
 		}
 		
-		inputFile := parentOutput.OutputFiles[0]
-		df.GlobalState.DataLinks[nodeID] = []string{inputFile}
-		return inputFile, nil
+		df.linkInputs(nodeID, []string{inputFile})
+		return df.scopedInput(nodeID, parentIDs[0], inputFile, layer)
 	}
 	
 	// For multiple parents, merge their outputs
-	return df.mergeParentOutputs(nodeID, parentIDs, layer)
+	return df.mergeParentOutputs(nodeID, parentIDs, outputs, layer)
 }
 
-// mergeParentOutputs combines outputs from multiple parent nodes
-func (df *DataFlow) mergeParentOutputs(nodeID string, parentIDs []string, layer int) (string, error) {
+// linkInputs records the files nodeID's input was made from
+func (df *DataFlow) linkInputs(nodeID string, files []string) {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+	df.GlobalState.DataLinks[nodeID] = files
+}
+
+// setGraph makes g the workflow whose edges PrepareNodeInput follows.
+func (df *DataFlow) setGraph(g *graph.DAG) {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+	df.graph = g
+}
+
+// inputParents returns the parents of nodeID in the workflow that are among
+// taken, with the root read as "seed". Any taken ID that is not a parent is
+// an error.
+func (df *DataFlow) inputParents(nodeID string, taken []string) ([]string, error) {
+	if df.graph == nil {
+		return taken, nil
+	}
+
+	var ids []string
+	for _, p := range df.graph.Parents(nodeID) {
+		if p == df.graph.Root {
+			p = "seed"
+		}
+		if slices.Contains(taken, p) {
+			ids = append(ids, p)
+		}
+	}
+	if len(ids) != len(taken) {
+		for _, p := range taken {
+			if !slices.Contains(ids, p) {
+				return nil, fmt.Errorf("%s is not a parent of %s", p, nodeID)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// mergeParentOutputs combines outputs from multiple parent nodes; outputs
+// holds the files each parent wrote
+func (df *DataFlow) mergeParentOutputs(nodeID string, parentIDs []string, outputs map[string][]string, layer int) (string, error) {
 	mergedPath := filepath.Join(df.WorkDir, df.RunID, "merged", 
 		fmt.Sprintf("L%02d-%s-input.txt", layer, nodeID))
 	
@@ -207,12 +485,7 @@ func (df *DataFlow) mergeParentOutputs(nodeID string, parentIDs []string, layer
 	var inputFiles []string
 	
 	for _, parentID := range parentIDs {
-		parentOutput, exists := df.NodeOutputs[parentID]
-		if !exists {
-			continue
-		}
-		
-		for _, outputFile := range parentOutput.OutputFiles {
+		for _, outputFile := range outputs[parentID] {
 			inputFiles = append(inputFiles, outputFile)
 			records, err := df.parseFile(outputFile, parentID)
 			if err != nil {
@@ -222,8 +495,8 @@ func (df *DataFlow) mergeParentOutputs(nodeID string, parentIDs []string, layer
 		}
 	}
 	
-	// Deduplicate and sort records
-	uniqueRecords := df.deduplicateRecords(allRecords)
+	// Deduplicate, scope and sort records
+	uniqueRecords := df.scopeRecords(nodeID, df.deduplicateRecords(allRecords))
 	sort.Slice(uniqueRecords, func(i, j int) bool {
 		return uniqueRecords[i].Value < uniqueRecords[j].Value
 	})
@@ -241,15 +514,21 @@ func (df *DataFlow) mergeParentOutputs(nodeID string, parentIDs []string, layer
 	}
 	writer.Flush()
 	
-	df.GlobalState.DataLinks[nodeID] = inputFiles
+	df.linkInputs(nodeID, inputFiles)
 	return mergedPath, nil
 }
 
 // RecordNodeOutput records the output from a completed node
 func (df *DataFlow) RecordNodeOutput(nodeID, tool string, startTime, endTime time.Time, 
 	exitCode int, outputFiles []string, errorLog string) error {
-	
-	// Calculate file statistics
+	return df.recordOutput(nodeID, tool, startTime, endTime, exitCode, exitCode == 0, outputFiles, errorLog)
+}
+
+// recordOutput is RecordNodeOutput with success decided by the caller, for
+// tools whose accepted exit codes include non-zero ones
+func (df *DataFlow) recordOutput(nodeID, tool string, startTime, endTime time.Time,
+	exitCode int, ok bool, outputFiles []string, errorLog string) error {
+	// Calculate file statistics before taking the lock
 	var totalSize int64
 	var totalLines int
 	var format string
@@ -283,36 +562,94 @@ func (df *DataFlow) RecordNodeOutput(nodeID, tool string, startTime, endTime tim
 		Metadata:    make(map[string]string),
 	}
 	
-	// Store node output
+	// Store node output and update global state
+	df.mu.Lock()
 	df.NodeOutputs[nodeID] = nodeOutput
-	
-	// Update global state
-	if exitCode == 0 {
+	if ok {
 		df.GlobalState.NodeStates[nodeID] = NodeCompleted
 		df.GlobalState.Statistics.CompletedNodes++
 	} else {
 		df.GlobalState.NodeStates[nodeID] = NodeFailed
 		df.GlobalState.Statistics.FailedNodes++
 	}
-	
+	cp := df.snapshot()
+	df.mu.Unlock()
+	if err := df.saveCheckpoint(cp); err != nil {
+		return err
+	}
+
 	// Create analysis summary
-	if err := df.createNodeAnalysis(nodeOutput); err != nil {
+	if err := df.createNodeAnalysis(nodeOutput, ok); err != nil {
 		return fmt.Errorf("failed to create node analysis: %w", err)
 	}
 	
 	return nil
 }
 
+// AnnotateNode merges extra metadata into a node's recorded output
+func (df *DataFlow) AnnotateNode(nodeID string, meta map[string]string) {
+	df.mu.Lock()
+	nodeOutput, exists := df.NodeOutputs[nodeID]
+	if !exists {
+		df.mu.Unlock()
+		return
+	}
+	for k, v := range meta {
+		nodeOutput.Metadata[k] = v
+	}
+	cp := df.snapshot()
+	df.mu.Unlock()
+
+	_ = df.saveCheckpoint(cp)
+}
+
+// RecordTermination notes how a node's tool process was stopped
+func (df *DataFlow) RecordTermination(nodeID string, term Termination) {
+	df.mu.Lock()
+	if nodeOutput, exists := df.NodeOutputs[nodeID]; exists {
+		nodeOutput.Termination = term
+	}
+	cp := df.snapshot()
+	df.mu.Unlock()
+
+	_ = df.saveCheckpoint(cp)
+}
+
+// RecordCacheHit marks a node whose output was restored from the cache
+func (df *DataFlow) RecordCacheHit(nodeID, key string) {
+	df.mu.Lock()
+	if nodeOutput, exists := df.NodeOutputs[nodeID]; exists {
+		nodeOutput.Metadata["cache"] = "hit"
+		nodeOutput.Metadata["cache_key"] = key
+	}
+	if df.GlobalState.CachedNodes == nil {
+		df.GlobalState.CachedNodes = make(map[string]string)
+	}
+	df.GlobalState.CachedNodes[nodeID] = key
+	df.GlobalState.Statistics.CacheHits++
+	cp := df.snapshot()
+	df.mu.Unlock()
+
+	_ = df.saveCheckpoint(cp)
+}
+
 // ProcessNodeOutputs processes and validates all output files for a node
 func (df *DataFlow) ProcessNodeOutputs(nodeID string) error {
+	df.mu.Lock()
 	nodeOutput, exists := df.NodeOutputs[nodeID]
+	var outputFiles []string
+	if exists {
+		outputFiles = append(outputFiles, nodeOutput.OutputFiles...)
+	}
+	df.mu.Unlock()
+
 	if !exists {
 		return fmt.Errorf("no output recorded for node %s", nodeID)
 	}
 	
 	var processedFiles []string
 	
-	for _, outputFile := range nodeOutput.OutputFiles {
+	for _, outputFile := range outputFiles {
 		// Parse and validate the file
 		records, err := df.parseFile(outputFile, nodeID)
 		if err != nil {
@@ -334,13 +671,18 @@ func (df *DataFlow) ProcessNodeOutputs(nodeID string) error {
 	}
 	
 	// Update node output with processed files
+	df.mu.Lock()
 	nodeOutput.Metadata["processed_files"] = strings.Join(processedFiles, ",")
+	df.mu.Unlock()
 	
 	return nil
 }
 
 // GetLatestOutput returns the most recent output file for a node
 func (df *DataFlow) GetLatestOutput(nodeID string) (string, error) {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+
 	nodeOutput, exists := df.NodeOutputs[nodeID]
 	if !exists {
 		return "", fmt.Errorf("no output for node %s", nodeID)
@@ -356,6 +698,9 @@ func (df *DataFlow) GetLatestOutput(nodeID string) (string, error) {
 
 // CreateExecutionReport generates a comprehensive execution report
 func (df *DataFlow) CreateExecutionReport() error {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+
 	reportPath := filepath.Join(df.WorkDir, df.RunID, "execution-report.json")
 	
 	// Update final statistics
@@ -391,6 +736,10 @@ func (df *DataFlow) CreateExecutionReport() error {
 // Helper methods
 
 func (df *DataFlow) parseFile(filePath, sourceNode string) ([]DataRecord, error) {
+	if records, ok, err := df.parseWith(filePath, sourceNode); ok {
+		return records, err
+	}
+
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, err
@@ -408,7 +757,7 @@ func (df *DataFlow) parseFile(filePath, sourceNode string) ([]DataRecord, error)
 		
 		record := DataRecord{
 			Value:      line,
-			Type:       df.inferDataType(line),
+			Type:       df.recordType(sourceNode, line),
 			Source:     sourceNode,
 			Timestamp:  time.Now(),
 			Confidence: 1.0,
@@ -526,6 +875,53 @@ func (df *DataFlow) detectFormat(filePath string) string {
 	}
 }
 
+// checkpointData is a marshalled copy of the run's state, taken under df.mu
+// and written out after it is released
+type checkpointData struct {
+	seq  uint64
+	data []byte
+	err  error
+}
+
+// snapshot marshals the run's state for saveCheckpoint; callers hold df.mu
+func (df *DataFlow) snapshot() checkpointData {
+	df.cpSeq++
+	data, err := json.MarshalIndent(checkpoint{
+		GlobalState: df.GlobalState,
+		NodeOutputs: df.NodeOutputs,
+	}, "", "  ")
+	if err != nil {
+		err = fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+	return checkpointData{seq: df.cpSeq, data: data, err: err}
+}
+
+// saveCheckpoint atomically rewrites the run's state file with cp. Callers
+// do not hold df.mu; a snapshot older than the one on disk is dropped, so
+// concurrent nodes never roll the file back.
+func (df *DataFlow) saveCheckpoint(cp checkpointData) error {
+	if cp.err != nil {
+		return cp.err
+	}
+
+	df.cpMu.Lock()
+	defer df.cpMu.Unlock()
+	if cp.seq <= df.cpSaved {
+		return nil
+	}
+
+	path := filepath.Join(df.WorkDir, df.RunID, checkpointFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, cp.data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	df.cpSaved = cp.seq
+	return nil
+}
+
 func (df *DataFlow) writeJSONRecords(records []DataRecord, outputPath string) error {
 	data, err := json.MarshalIndent(records, "", "  ")
 	if err != nil {
@@ -535,7 +931,9 @@ func (df *DataFlow) writeJSONRecords(records []DataRecord, outputPath string) er
 	return os.WriteFile(outputPath, data, 0644)
 }
 
-func (df *DataFlow) createNodeAnalysis(nodeOutput *NodeOutput) error {
+// createNodeAnalysis writes the node's summary; ok is whether its exit code
+// counted as success, accept_exit included
+func (df *DataFlow) createNodeAnalysis(nodeOutput *NodeOutput, ok bool) error {
 	analysisPath := filepath.Join(df.WorkDir, df.RunID, "analysis", 
 		fmt.Sprintf("%s-analysis.json", nodeOutput.NodeID))
 	
@@ -548,7 +946,7 @@ func (df *DataFlow) createNodeAnalysis(nodeOutput *NodeOutput) error {
 		"total_lines":  nodeOutput.LineCount,
 		"total_size":   nodeOutput.FileSize,
 		"format":       nodeOutput.Format,
-		"success":      nodeOutput.ExitCode == 0,
+		"success":      ok,
 		"generated_at": time.Now().Format(time.RFC3339),
 	}
 	
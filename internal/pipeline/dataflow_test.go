@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/MKlolbullen/termaid/internal/graph"
+)
+
+func TestCheckpointKeepsNewest(t *testing.T) {
+	df, err := NewDataFlow(t.TempDir(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// two nodes snapshot in order but their writes land the other way round
+	df.mu.Lock()
+	older := df.snapshot()
+	df.GlobalState.NodeStates["a"] = NodeCompleted
+	newer := df.snapshot()
+	df.mu.Unlock()
+
+	if err := df.saveCheckpoint(newer); err != nil {
+		t.Fatal(err)
+	}
+	if err := df.saveCheckpoint(older); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadDataFlow(df.WorkDir, df.RunID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.GlobalState.NodeStates["a"]; got != NodeCompleted {
+		t.Errorf("a state = %v on disk, want the newer snapshot's completed", got)
+	}
+}
+
+func TestInputParents(t *testing.T) {
+	df, err := NewDataFlow(t.TempDir(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// without a workflow the taken parents are read as given
+	if got, err := df.inputParents("c", []string{"b", "a"}); err != nil || !slices.Equal(got, []string{"b", "a"}) {
+		t.Errorf("inputParents without a graph = %q, %v", got, err)
+	}
+
+	g := graph.NewDAG()
+	for _, id := range []string{"a", "b"} {
+		if err := g.AddNode(g.Root, id, id, "", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := g.AddNode("a", "c", "c", "", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.AddEdge("b", "c"); err != nil {
+		t.Fatal(err)
+	}
+	df.setGraph(g)
+
+	tests := []struct {
+		node  string
+		taken []string
+		want  []string
+		err   bool
+	}{
+		{"c", []string{"b", "a"}, []string{"a", "b"}, false}, // graph order, not the caller's
+		{"c", []string{"b"}, []string{"b"}, false},
+		{"a", []string{"seed"}, []string{"seed"}, false},
+		{"c", []string{"a", "seed"}, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := df.inputParents(tt.node, tt.taken)
+		if (err != nil) != tt.err || !slices.Equal(got, tt.want) {
+			t.Errorf("inputParents(%s, %q) = %q, %v; want %q", tt.node, tt.taken, got, err, tt.want)
+		}
+	}
+}
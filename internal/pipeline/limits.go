@@ -0,0 +1,99 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+)
+
+/* ─────────────────────────── Concurrency Limits ─────────────────────── */
+
+// limiter grants run slots against a global cap plus any number of keyed caps
+// (per tool, per subgraph). A node takes every slot it needs at once or none,
+// so a node blocked on its tool cap never holds a global slot.
+type limiter struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	global int
+	used   int
+	caps   map[string]int // key → max concurrent holders
+	inUse  map[string]int
+}
+
+func newLimiter(global int, caps map[string]int) *limiter {
+	if global < 1 {
+		global = 1
+	}
+	l := &limiter{
+		global: global,
+		caps:   caps,
+		inUse:  make(map[string]int),
+	}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire blocks until a global slot and a slot under every capped key are
+// free, or ctx ends.
+func (l *limiter) acquire(ctx context.Context, keys []string) error {
+	stop := context.AfterFunc(ctx, func() {
+		l.mu.Lock()
+		l.cond.Broadcast()
+		l.mu.Unlock()
+	})
+	defer stop()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for !l.fits(keys) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		l.cond.Wait()
+	}
+
+	l.used++
+	for _, k := range keys {
+		l.inUse[k]++
+	}
+	return nil
+}
+
+func (l *limiter) release(keys []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.used--
+	for _, k := range keys {
+		l.inUse[k]--
+	}
+	l.cond.Broadcast()
+}
+
+// width is the most holders of keys the caps allow at once, however many
+// hold slots now.
+func (l *limiter) width(keys []string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := l.global
+	for _, k := range keys {
+		if max, ok := l.caps[k]; ok {
+			n = min(n, max)
+		}
+	}
+	return n
+}
+
+// fits reports whether one more holder of keys stays within every cap.
+func (l *limiter) fits(keys []string) bool {
+	if l.used >= l.global {
+		return false
+	}
+	for _, k := range keys {
+		if max, ok := l.caps[k]; ok && l.inUse[k] >= max {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MKlolbullen/termaid/internal/graph"
+)
+
+// peaks runs one holder per entry of holders through l, each keeping its
+// slot briefly, and returns the most that ever held each key at once. The
+// global count is reported under "".
+func peaks(t *testing.T, l *limiter, holders [][]string) map[string]int {
+	t.Helper()
+	var (
+		mu   sync.Mutex
+		now  = make(map[string]int)
+		peak = make(map[string]int)
+		wg   sync.WaitGroup
+	)
+	bump := func(keys []string, d int) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, k := range append([]string{""}, keys...) {
+			now[k] += d
+			peak[k] = max(peak[k], now[k])
+		}
+	}
+	for _, keys := range holders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.acquire(context.Background(), keys); err != nil {
+				t.Error(err)
+				return
+			}
+			bump(keys, 1)
+			time.Sleep(10 * time.Millisecond)
+			bump(keys, -1)
+			l.release(keys)
+		}()
+	}
+	wg.Wait()
+	return peak
+}
+
+func TestLimiterCaps(t *testing.T) {
+	tool := []string{"tool:nuclei"}
+	sub := []string{"tool:httpx", "subgraph:web"}
+	other := []string{"tool:dnsx"}
+
+	var holders [][]string
+	for range 6 {
+		holders = append(holders, tool, sub, other)
+	}
+	l := newLimiter(4, map[string]int{"tool:nuclei": 1, "subgraph:web": 2})
+	peak := peaks(t, l, holders)
+
+	want := map[string]int{"": 4, "tool:nuclei": 1, "subgraph:web": 2}
+	for k, limit := range want {
+		if peak[k] > limit {
+			t.Errorf("%q peaked at %d holders, cap is %d", k, peak[k], limit)
+		}
+	}
+	// uncapped keys only answer to the global cap, and it was reached
+	if peak[""] != 4 {
+		t.Errorf("global peak = %d, want the cap of 4 used", peak[""])
+	}
+	if l.used != 0 {
+		t.Errorf("%d global slots still held after every release", l.used)
+	}
+	for k, n := range l.inUse {
+		if n != 0 {
+			t.Errorf("%d slots under %q still held after every release", n, k)
+		}
+	}
+}
+
+func TestLimiterMinimum(t *testing.T) {
+	if peak := peaks(t, newLimiter(0, nil), [][]string{nil, nil, nil}); peak[""] != 1 {
+		t.Errorf("a zero global cap let %d run at once, want 1", peak[""])
+	}
+}
+
+func TestLimiterWidth(t *testing.T) {
+	l := newLimiter(4, map[string]int{"tool:nuclei": 1, "subgraph:web": 2})
+	for _, tt := range []struct {
+		keys []string
+		want int
+	}{
+		{[]string{"tool:httpx"}, 4},
+		{[]string{"tool:httpx", "subgraph:web"}, 2},
+		{[]string{"tool:nuclei", "subgraph:web"}, 1},
+	} {
+		if got := l.width(tt.keys); got != tt.want {
+			t.Errorf("width(%q) = %d, want %d", tt.keys, got, tt.want)
+		}
+	}
+}
+
+func TestLimiterCancel(t *testing.T) {
+	l := newLimiter(2, map[string]int{"tool:nuclei": 1})
+	if err := l.acquire(context.Background(), []string{"tool:nuclei"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second nuclei waits on its tool cap without taking a global slot
+	ctx, cancel := context.WithCancel(context.Background())
+	res := make(chan error, 1)
+	go func() { res <- l.acquire(ctx, []string{"tool:nuclei"}) }()
+	if err := l.acquire(context.Background(), []string{"tool:httpx"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	select {
+	case err := <-res:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("blocked acquire returned %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cancelling did not wake a blocked acquire")
+	}
+	if l.used != 2 || l.inUse["tool:nuclei"] != 1 {
+		t.Errorf("cancelled acquire kept a slot: used=%d inUse=%v", l.used, l.inUse)
+	}
+}
+
+func TestRunLimits(t *testing.T) {
+	g := graph.NewDAG()
+	g.Subgraphs["web"] = &graph.SubgraphInfo{ID: "web", MaxParallel: 2}
+	g.Subgraphs["dns"] = &graph.SubgraphInfo{ID: "dns"}
+
+	got := runLimits(g, map[string]int{"nuclei": 1, "httpx": 0})
+	want := map[string]int{"tool:nuclei": 1, "subgraph:web": 2}
+	if !maps.Equal(got, want) {
+		t.Errorf("runLimits = %v, want %v", got, want)
+	}
+
+	if keys := limitKeys(&graph.Node{Tool: "httpx", Subgraph: "web"}); !slices.Equal(keys, []string{"tool:httpx", "subgraph:web"}) {
+		t.Errorf("limitKeys = %q", keys)
+	}
+	if keys := limitKeys(&graph.Node{Tool: "httpx"}); !slices.Equal(keys, []string{"tool:httpx"}) {
+		t.Errorf("limitKeys outside a subgraph = %q", keys)
+	}
+}
@@ -0,0 +1,223 @@
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+/* ─────────────────────────── Output Capture ─────────────────────────── */
+
+// lineWriter is an io.Writer that hands every complete line to fn. A trailing
+// partial line is held back until more data arrives or Flush is called.
+type lineWriter struct {
+	mu  sync.Mutex
+	buf []byte
+	fn  func(line string)
+}
+
+func newLineWriter(fn func(line string)) *lineWriter {
+	return &lineWriter{fn: fn}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.fn(string(bytes.TrimRight(w.buf[:i], "\r")))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush emits any buffered partial line.
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) > 0 {
+		w.fn(string(w.buf))
+		w.buf = nil
+	}
+}
+
+// cappedWriter passes at most left bytes on to w. The write that would go
+// over the cap fails and calls exceeded once, so a tool whose stdout is its
+// result is held to the same file size limit as files it writes itself.
+type cappedWriter struct {
+	w        io.Writer
+	left     int64
+	exceeded func()
+	hit      bool
+}
+
+func (c *cappedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) <= c.left {
+		n, err := c.w.Write(p)
+		c.left -= int64(n)
+		return n, err
+	}
+
+	n, _ := c.w.Write(p[:c.left])
+	c.left = 0
+	if !c.hit {
+		c.hit = true
+		c.exceeded()
+	}
+	return n, errFileSizeLimit
+}
+
+var errFileSizeLimit = errors.New("output exceeds the file size limit")
+
+/* ─────────────────────────── Live Output ────────────────────────────── */
+
+const (
+	outputInterval   = 250 * time.Millisecond // how often batched lines are sent
+	progressInterval = 2 * time.Second        // how often progress is reported
+	maxBatchLines    = 20                     // lines per stream per batch; the rest are dropped
+)
+
+// liveOutput turns the lines a running tool prints into batched StatusOutput
+// events and periodic StatusProgress events. Tools never wait on the bus:
+// lines are buffered up to maxBatchLines per interval and counted beyond that,
+// and a batch the bus has no room for is folded into the next one.
+type liveOutput struct {
+	mu       sync.Mutex
+	emit     func(Status) bool // reports whether the bus took the event
+	start    time.Time
+	batch    map[string][]string // stream → lines waiting to be sent
+	dropped  map[string]int      // stream → lines skipped since the last batch
+	outLines int
+	errLines int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newLiveOutput(emit func(Status) bool) *liveOutput {
+	l := &liveOutput{
+		emit:    emit,
+		start:   time.Now(),
+		batch:   make(map[string][]string),
+		dropped: make(map[string]int),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go l.loop()
+	return l
+}
+
+// line records one line printed on stream ("stdout" or "stderr").
+func (l *liveOutput) line(stream, line string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if stream == "stderr" {
+		l.errLines++
+	} else {
+		l.outLines++
+	}
+	if len(l.batch[stream]) < maxBatchLines {
+		l.batch[stream] = append(l.batch[stream], line)
+	} else {
+		l.dropped[stream]++
+	}
+}
+
+// Close sends whatever is still batched plus a final progress event.
+func (l *liveOutput) Close() {
+	close(l.stop)
+	<-l.done
+}
+
+func (l *liveOutput) loop() {
+	defer close(l.done)
+
+	tick := time.NewTicker(outputInterval)
+	defer tick.Stop()
+	lastProgress := time.Now()
+
+	for {
+		select {
+		case <-l.stop:
+			l.flush()
+			l.progress()
+			return
+		case <-tick.C:
+			l.flush()
+			// progress is only the latest count, so a refused one is simply
+			// tried again next tick
+			if time.Since(lastProgress) >= progressInterval && l.progress() {
+				lastProgress = time.Now()
+			}
+		}
+	}
+}
+
+func (l *liveOutput) flush() {
+	l.mu.Lock()
+	batch, dropped := l.batch, l.dropped
+	l.batch, l.dropped = make(map[string][]string), make(map[string]int)
+	l.mu.Unlock()
+
+	for _, stream := range []string{"stdout", "stderr"} {
+		if len(batch[stream]) == 0 && dropped[stream] == 0 {
+			continue
+		}
+		if !l.emit(Status{Type: StatusOutput, Stream: stream, Lines: batch[stream], Dropped: dropped[stream]}) {
+			l.requeue(stream, batch[stream], dropped[stream])
+		}
+	}
+}
+
+// requeue puts a batch the bus refused in front of the lines collected since,
+// keeping at most maxBatchLines and counting the rest as dropped.
+func (l *liveOutput) requeue(stream string, lines []string, dropped int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lines = append(lines, l.batch[stream]...)
+	if len(lines) > maxBatchLines {
+		dropped += len(lines) - maxBatchLines
+		lines = lines[:maxBatchLines]
+	}
+	l.batch[stream] = lines
+	l.dropped[stream] += dropped
+}
+
+func (l *liveOutput) progress() bool {
+	l.mu.Lock()
+	st := Status{
+		Type:     StatusProgress,
+		OutLines: l.outLines,
+		ErrLines: l.errLines,
+		Elapsed:  time.Since(l.start),
+	}
+	l.mu.Unlock()
+
+	return l.emit(st)
+}
+
+// send puts st on out. StatusOutput and StatusProgress are dropped when out
+// is full, so a slow reader never holds up a tool's live output; every other
+// event waits for room.
+func send(out chan<- Status, st Status) bool {
+	if st.Type != StatusOutput && st.Type != StatusProgress {
+		out <- st
+		return true
+	}
+	select {
+	case out <- st:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,141 @@
+package pipeline
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	w := newLineWriter(func(line string) { lines = append(lines, line) })
+
+	for _, chunk := range []string{"one\r\ntw", "o\n", "", "\nthr", "ee"} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"one", "two", ""}; !slices.Equal(lines, want) {
+		t.Fatalf("before Flush got %q, want %q", lines, want)
+	}
+
+	w.Flush()
+	w.Flush() // nothing left to emit
+	if want := []string{"one", "two", "", "three"}; !slices.Equal(lines, want) {
+		t.Errorf("after Flush got %q, want %q", lines, want)
+	}
+}
+
+// numbered returns lines "<prefix>1" … "<prefix>n".
+func numbered(prefix string, n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("%s%d", prefix, i+1)
+	}
+	return lines
+}
+
+func TestLiveOutputBatches(t *testing.T) {
+	var sent []Status
+	l := newLiveOutput(func(st Status) bool {
+		sent = append(sent, st)
+		return true
+	})
+	for _, line := range numbered("out", maxBatchLines+5) {
+		l.line("stdout", line)
+	}
+	l.line("stderr", "warning")
+	l.Close()
+
+	var out, errs []string
+	dropped := 0
+	for _, st := range sent[:len(sent)-1] {
+		if st.Type != StatusOutput {
+			t.Fatalf("got %v before the final progress", st.Type)
+		}
+		if st.Stream == "stderr" {
+			errs = append(errs, st.Lines...)
+		} else {
+			out = append(out, st.Lines...)
+			dropped += st.Dropped
+		}
+	}
+	if want := numbered("out", maxBatchLines); !slices.Equal(out, want) || dropped != 5 {
+		t.Errorf("stdout sent %q with %d dropped, want the first %d lines and 5 dropped", out, dropped, maxBatchLines)
+	}
+	if !slices.Equal(errs, []string{"warning"}) {
+		t.Errorf("stderr sent %q", errs)
+	}
+	last := sent[len(sent)-1]
+	if last.Type != StatusProgress || last.OutLines != maxBatchLines+5 || last.ErrLines != 1 {
+		t.Errorf("final progress = %+v, want every line counted", last)
+	}
+}
+
+func TestLiveOutputRequeue(t *testing.T) {
+	// built by hand so no ticker flushes behind the test's back
+	accept := false
+	var sent []Status
+	l := &liveOutput{
+		emit: func(st Status) bool {
+			if accept {
+				sent = append(sent, st)
+			}
+			return accept
+		},
+		batch:   make(map[string][]string),
+		dropped: make(map[string]int),
+	}
+
+	for _, line := range numbered("a", 15) {
+		l.line("stdout", line)
+	}
+	l.flush() // refused: kept for the next batch
+	for _, line := range numbered("b", 10) {
+		l.line("stdout", line)
+	}
+	accept = true
+	l.flush()
+
+	if len(sent) != 1 {
+		t.Fatalf("sent %d batches, want the refused one folded into one", len(sent))
+	}
+	want := append(numbered("a", 15), numbered("b", 5)...)
+	if !slices.Equal(sent[0].Lines, want) || sent[0].Dropped != 5 {
+		t.Errorf("sent %q with %d dropped, want the oldest %d lines and 5 dropped", sent[0].Lines, sent[0].Dropped, maxBatchLines)
+	}
+
+	l.flush()
+	if len(sent) != 1 {
+		t.Errorf("an empty flush sent %+v", sent[1:])
+	}
+}
+
+func TestSend(t *testing.T) {
+	out := make(chan Status, 1)
+	out <- Status{Type: StatusStart}
+
+	// live output and progress give up on a full bus
+	for _, typ := range []StatusUpdateType{StatusOutput, StatusProgress} {
+		if send(out, Status{Type: typ}) {
+			t.Errorf("send(%v) on a full bus reported success", typ)
+		}
+	}
+
+	// lifecycle events wait for room
+	done := make(chan bool)
+	go func() { done <- send(out, Status{Type: StatusFinish}) }()
+	select {
+	case <-done:
+		t.Fatal("send(StatusFinish) did not wait for room")
+	case <-time.After(50 * time.Millisecond):
+	}
+	<-out
+	if !<-done {
+		t.Error("send(StatusFinish) reported failure")
+	}
+	if st := <-out; st.Type != StatusFinish {
+		t.Errorf("bus holds %v, want the finish event", st.Type)
+	}
+}
@@ -0,0 +1,374 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MKlolbullen/termaid/internal/graph"
+)
+
+/* ─────────────────────────── Output Parsers ─────────────────────────── */
+
+// parsers is the registry of structured output parsers, keyed by format. A
+// node selects one with "parser" (filled from the catalog); its records then
+// carry the tool's rich fields in Metadata, and the value passed on
+// downstream is the one the parser picks out of each result.
+var parsers = NewDataProcessor()
+
+// NewDataProcessor returns a processor with the built-in tool parsers
+// registered.
+func NewDataProcessor() *DataProcessor {
+	dp := &DataProcessor{
+		parsers:    make(map[string]Parser),
+		validators: make(map[string]Validator),
+		formatters: make(map[string]Formatter),
+	}
+	for _, p := range []Parser{nucleiParser, httpxParser, ffufParser, naabuParser, dnsxParser, katanaParser} {
+		dp.RegisterParser(p)
+	}
+	return dp
+}
+
+// RegisterParser adds p under its format, replacing any parser there.
+func (dp *DataProcessor) RegisterParser(p Parser) {
+	dp.parsers[p.GetFormat()] = p
+}
+
+// Parser returns the parser registered for format.
+func (dp *DataProcessor) Parser(format string) (Parser, bool) {
+	p, ok := dp.parsers[format]
+	return p, ok
+}
+
+// Formats lists the registered parser formats.
+func (dp *DataProcessor) Formats() []string {
+	formats := make([]string, 0, len(dp.parsers))
+	for f := range dp.parsers {
+		formats = append(formats, f)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// RegisterParser makes p available to nodes as parser p.GetFormat().
+func RegisterParser(p Parser) { parsers.RegisterParser(p) }
+
+/* ─── JSON tool output ─── */
+
+// jsonParser reads the JSON a tool writes, one object per line or, when
+// results is set, a single document holding them all (ffuf -of json). Lines
+// that are not JSON become plain records, so the same tool run without its
+// JSON flag still parses.
+type jsonParser struct {
+	format  string
+	typ     string                          // record type of every value
+	value   func(obj map[string]any) string // the value passed downstream
+	fields  map[string][]string             // metadata key → JSON paths, first found wins
+	results string                          // key of the result list in a whole-file document
+}
+
+func (p *jsonParser) GetFormat() string { return p.format }
+
+func (p *jsonParser) Parse(path string) ([]DataRecord, error) {
+	if p.results != "" {
+		if records, ok, err := p.parseDocument(path); ok || err != nil {
+			return records, err
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []DataRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024) // nuclei responses can be long
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var obj map[string]any
+		if !strings.HasPrefix(line, "{") || json.Unmarshal([]byte(line), &obj) != nil {
+			records = append(records, p.record(line, nil))
+			continue
+		}
+		if rec, ok := p.fromObject(obj); ok {
+			records = append(records, rec)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// parseDocument reads path as one JSON document with a result list. ok is
+// false when it is not one, so the file is read line by line instead.
+func (p *jsonParser) parseDocument(path string) (records []DataRecord, ok bool, err error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	var doc map[string]any
+	if json.Unmarshal(raw, &doc) != nil {
+		return nil, false, nil
+	}
+	list, isList := doc[p.results].([]any)
+	if !isList {
+		return nil, false, nil
+	}
+
+	for _, item := range list {
+		if obj, isObj := item.(map[string]any); isObj {
+			if rec, ok := p.fromObject(obj); ok {
+				records = append(records, rec)
+			}
+		}
+	}
+	return records, true, nil
+}
+
+// fromObject turns one JSON result into a record; results without a value,
+// like progress lines, are dropped.
+func (p *jsonParser) fromObject(obj map[string]any) (DataRecord, bool) {
+	value := p.value(obj)
+	if value == "" {
+		return DataRecord{}, false
+	}
+
+	meta := make(map[string]string, len(p.fields)+1)
+	meta["parser"] = p.format
+	for key, paths := range p.fields {
+		if v, ok := jsonField(obj, paths...); ok {
+			meta[key] = v
+		}
+	}
+	return p.record(value, meta), true
+}
+
+func (p *jsonParser) record(value string, meta map[string]string) DataRecord {
+	if meta == nil {
+		meta = map[string]string{"parser": p.format}
+	}
+	return DataRecord{
+		Value:      value,
+		Type:       p.typ,
+		Timestamp:  time.Now(),
+		Confidence: 1.0,
+		Metadata:   meta,
+	}
+}
+
+// jsonField returns the first of paths (dotted for nested objects) present
+// in obj, as a string: lists are joined with commas, and whole numbers lose
+// their decimal point.
+func jsonField(obj map[string]any, paths ...string) (string, bool) {
+	for _, path := range paths {
+		var v any = obj
+		found := true
+		for _, key := range strings.Split(path, ".") {
+			m, ok := v.(map[string]any)
+			if !ok {
+				found = false
+				break
+			}
+			if v, ok = m[key]; !ok {
+				found = false
+				break
+			}
+		}
+		if found && v != nil {
+			return jsonString(v), true
+		}
+	}
+	return "", false
+}
+
+func jsonString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, e := range v {
+			if e != nil {
+				parts = append(parts, jsonString(e))
+			}
+		}
+		return strings.Join(parts, ",")
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// valueOf picks the first of paths present in a result as its value.
+func valueOf(paths ...string) func(map[string]any) string {
+	return func(obj map[string]any) string {
+		v, _ := jsonField(obj, paths...)
+		return v
+	}
+}
+
+/* ─── tools ─── */
+
+var nucleiParser = &jsonParser{
+	format: "nuclei",
+	typ:    "finding",
+	value:  valueOf("matched-at", "host"),
+	fields: map[string][]string{
+		"template-id":       {"template-id", "templateID"},
+		"severity":          {"info.severity"},
+		"name":              {"info.name"},
+		"tags":              {"info.tags"},
+		"matched-at":        {"matched-at", "matched"},
+		"matcher-name":      {"matcher-name"},
+		"extracted-results": {"extracted-results"},
+		"host":              {"host"},
+		"ip":                {"ip"},
+		"protocol":          {"type"},
+	},
+}
+
+var httpxParser = &jsonParser{
+	format: "httpx",
+	typ:    "url",
+	value:  valueOf("url"),
+	fields: map[string][]string{
+		"status_code":    {"status_code", "status-code"},
+		"title":          {"title"},
+		"tech":           {"tech", "technologies"},
+		"webserver":      {"webserver"},
+		"content_length": {"content_length", "content-length"},
+		"content_type":   {"content_type", "content-type"},
+		"cdn":            {"cdn"},
+		"cdn_name":       {"cdn_name"},
+		"host":           {"input"},
+		"ip":             {"host"},
+		"port":           {"port"},
+		"scheme":         {"scheme"},
+		"final_url":      {"final_url"},
+	},
+}
+
+var ffufParser = &jsonParser{
+	format: "ffuf",
+	typ:    "url",
+	value:  valueOf("url"),
+	fields: map[string][]string{
+		"status":       {"status"},
+		"length":       {"length"},
+		"words":        {"words"},
+		"lines":        {"lines"},
+		"content_type": {"content-type"},
+		"redirect":     {"redirectlocation"},
+		"fuzz":         {"input.FUZZ"},
+		"host":         {"host"},
+	},
+	results: "results",
+}
+
+var naabuParser = &jsonParser{
+	format: "naabu",
+	typ:    "port",
+	value: func(obj map[string]any) string {
+		host, ok := jsonField(obj, "host", "ip")
+		port, hasPort := jsonField(obj, "port.Port", "port")
+		if !ok || !hasPort {
+			return ""
+		}
+		return hostPort(host, port)
+	},
+	fields: map[string][]string{
+		"host":     {"host"},
+		"ip":       {"ip"},
+		"port":     {"port.Port", "port"}, // older naabu nests the port in an object
+		"protocol": {"protocol", "port.Protocol"},
+		"tls":      {"tls", "port.TLS"},
+	},
+}
+
+var dnsxParser = &jsonParser{
+	format: "dnsx",
+	typ:    "domain",
+	value:  valueOf("host"),
+	fields: map[string][]string{
+		"a":           {"a"},
+		"aaaa":        {"aaaa"},
+		"cname":       {"cname"},
+		"mx":          {"mx"},
+		"ns":          {"ns"},
+		"txt":         {"txt"},
+		"status_code": {"status_code"},
+		"resolver":    {"resolver"},
+	},
+}
+
+var katanaParser = &jsonParser{
+	format: "katana",
+	typ:    "url",
+	value:  valueOf("request.endpoint", "endpoint"),
+	fields: map[string][]string{
+		"method":       {"request.method"},
+		"tag":          {"request.tag"},
+		"attribute":    {"request.attribute"},
+		"found_at":     {"request.source"},
+		"status_code":  {"response.status_code"},
+		"content_type": {"response.headers.content_type", "response.headers.Content-Type"},
+	},
+}
+
+func hostPort(host, port string) string {
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return host + ":" + port
+}
+
+/* ─── DataFlow integration ─── */
+
+// setParsers remembers which parser reads each node's output. Unknown
+// parsers are an error.
+func (df *DataFlow) setParsers(g *graph.DAG) error {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+
+	df.parsers = make(map[string]Parser)
+	for id, n := range g.Nodes {
+		if n.Parser == "" {
+			continue
+		}
+		p, ok := parsers.Parser(n.Parser)
+		if !ok {
+			return fmt.Errorf("node %s: unknown parser %q (have %s)", id, n.Parser, strings.Join(parsers.Formats(), ", "))
+		}
+		df.parsers[id] = p
+	}
+	return nil
+}
+
+// parseWith reads filePath with the parser of sourceNode, if it has one.
+func (df *DataFlow) parseWith(filePath, sourceNode string) ([]DataRecord, bool, error) {
+	p, ok := df.parsers[sourceNode]
+	if !ok {
+		return nil, false, nil
+	}
+	records, err := p.Parse(filePath)
+	for i := range records {
+		records[i].Source = sourceNode
+		if records[i].Type == "" {
+			records[i].Type = df.recordType(sourceNode, records[i].Value)
+		}
+	}
+	return records, true, err
+}
@@ -0,0 +1,119 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParsers(t *testing.T) {
+	tests := []struct {
+		format string
+		output string
+		values []string
+		meta   map[string]string // checked on the first record
+	}{
+		{
+			format: "httpx",
+			output: `{"url":"https://a.example.com","input":"a.example.com","host":"93.184.216.34","port":"443","status_code":200,"title":"Home","tech":["nginx","PHP"]}` + "\n" +
+				`{"url":"http://b.example.com","status_code":301}` + "\n",
+			values: []string{"https://a.example.com", "http://b.example.com"},
+			meta:   map[string]string{"status_code": "200", "tech": "nginx,PHP", "host": "a.example.com", "ip": "93.184.216.34", "parser": "httpx"},
+		},
+		{
+			format: "httpx",
+			output: "https://a.example.com [200] [Home]\n\n# comment\n",
+			values: []string{"https://a.example.com [200] [Home]"},
+			meta:   map[string]string{"parser": "httpx"},
+		},
+		{
+			format: "dnsx",
+			output: `{"host":"api.example.com","a":["93.184.216.34","93.184.216.35"],"status_code":"NOERROR"}` + "\n",
+			values: []string{"api.example.com"},
+			meta:   map[string]string{"a": "93.184.216.34,93.184.216.35", "status_code": "NOERROR"},
+		},
+		{
+			format: "nuclei",
+			output: `{"template-id":"tech-detect","info":{"name":"Tech","severity":"info","tags":["tech"]},"matched-at":"https://a.example.com","host":"a.example.com","type":"http"}` + "\n" +
+				`{"progress":"50%"}` + "\n",
+			values: []string{"https://a.example.com"},
+			meta:   map[string]string{"template-id": "tech-detect", "severity": "info", "tags": "tech", "protocol": "http"},
+		},
+		{
+			format: "naabu",
+			output: `{"host":"a.example.com","ip":"93.184.216.34","port":8080,"protocol":"tcp"}` + "\n" +
+				`{"ip":"2001:db8::1","port":{"Port":443,"Protocol":"tcp"}}` + "\n",
+			values: []string{"a.example.com:8080", "[2001:db8::1]:443"},
+			meta:   map[string]string{"port": "8080", "protocol": "tcp"},
+		},
+		{
+			format: "ffuf",
+			output: `{"commandline":"ffuf","results":[{"url":"https://a.example.com/admin","status":403,"length":12,"input":{"FUZZ":"admin"}},{"url":"https://a.example.com/login","status":200}]}`,
+			values: []string{"https://a.example.com/admin", "https://a.example.com/login"},
+			meta:   map[string]string{"status": "403", "fuzz": "admin", "length": "12"},
+		},
+		{
+			format: "katana",
+			output: `{"request":{"method":"GET","endpoint":"https://a.example.com/js/app.js","source":"https://a.example.com"},"response":{"status_code":200}}` + "\n",
+			values: []string{"https://a.example.com/js/app.js"},
+			meta:   map[string]string{"method": "GET", "found_at": "https://a.example.com", "status_code": "200"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out.txt")
+			if err := os.WriteFile(path, []byte(tt.output), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			p, ok := parsers.Parser(tt.format)
+			if !ok {
+				t.Fatalf("no %s parser", tt.format)
+			}
+			records, err := p.Parse(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(records) != len(tt.values) {
+				t.Fatalf("got %d records, want %d: %+v", len(records), len(tt.values), records)
+			}
+			for i, rec := range records {
+				if rec.Value != tt.values[i] {
+					t.Errorf("record %d value = %q, want %q", i, rec.Value, tt.values[i])
+				}
+			}
+			for key, want := range tt.meta {
+				if got := records[0].Metadata[key]; got != want {
+					t.Errorf("metadata %s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSchedulerParser(t *testing.T) {
+	probe := emits(t, "probe", []string{"input"},
+		`{"url":"https://a.example.com","status_code":200}`,
+		`{"url":"https://b.example.com","status_code":403}`,
+		`{"url":"https://c.example.com","status_code":200}`,
+	)
+	g := testDAG(t,
+		probe,
+		testNode{id: "ok", tool: "builtin:filter", args: "status_code == 200", parents: []string{"probe"}},
+		copies("urls", "probe"),
+	)
+	g.Nodes["probe"].Parser = "httpx"
+
+	df, _, err := runTestDAG(t, t.TempDir(), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the parser's fields reach the filter, and children see its values
+	if got, want := readLines(t, df, "ok"), []string{"https://a.example.com", "https://c.example.com"}; !slices.Equal(got, want) {
+		t.Errorf("ok wrote %q, want %q", got, want)
+	}
+	if got := readLines(t, df, "urls"); len(got) != 3 || got[1] != "https://b.example.com" {
+		t.Errorf("urls read %q, want the three URLs", got)
+	}
+}
@@ -4,29 +4,48 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/charmbracelet/log"
+
+	"github.com/MKlolbullen/termaid/internal/graph"
+	"github.com/MKlolbullen/termaid/internal/secrets"
 )
 
 /* ─────────────────────────── Config Structs ───────────────────────────── */
 
 type Tool struct {
-	Name       string   `yaml:"-"`      // here = node.ID (unique)
-	Command    string   `yaml:"cmd"`    // actual binary (node.Tool)
-	Args       []string `yaml:"args"`   // already split
-	Output     string   `yaml:"output"` // resolved unique output file
-	Parallel   bool     `yaml:"parallel"`
-	Stdin      bool     `yaml:"stdin"`
-	OutputType string   `yaml:"output_type"` // txt, json, xml, etc.
-	Timeout    int      `yaml:"timeout"`     // execution timeout in seconds
+	Name         string        `yaml:"-"`      // here = node.ID (unique)
+	Command      string        `yaml:"cmd"`    // actual binary (node.Tool)
+	Args         []string      `yaml:"args"`   // already split
+	Output       string        `yaml:"output"` // resolved unique output file
+	Parallel     bool          `yaml:"parallel"`
+	Stdin        bool          `yaml:"stdin"`
+	OutputType   string        `yaml:"output_type"`   // txt, json, xml, etc.
+	Timeout      int           `yaml:"timeout"`       // execution timeout in seconds
+	Retries      int           `yaml:"retries"`       // extra attempts after a failure
+	Backoff      string        `yaml:"backoff"`       // fixed, linear or exponential
+	BackoffDelay int           `yaml:"backoff_delay"` // base delay between attempts in seconds
+	CacheTTL     time.Duration `yaml:"cache_ttl"`     // how long cached results stay valid; 0 disables caching
+	Tee          bool          `yaml:"tee"`           // mirror stdout lines into the live log
+	Shell        bool          `yaml:"shell"`         // run through /bin/sh -c with quoted placeholders
+	AcceptExit   []int         `yaml:"accept_exit"`   // exit codes besides 0 that count as success
+
+	SecretEnv   map[string]string `yaml:"secret_env"`   // environment variable → secret name
+	SecretFiles map[string]string `yaml:"secret_files"` // file in {{secret_dir}} → template using {{secret.NAME}}
+
+	Limits graph.ResourceLimits `yaml:"limits"` // rlimits for the tool process
 }
 
 type Category struct {
@@ -42,6 +61,17 @@ const (
 	StatusStart StatusUpdateType = iota
 	StatusFinish
 	StatusError
+	StatusTimeout  // the tool exceeded its timeout on the final attempt
+	StatusRetry    // an attempt failed and the tool will be run again
+	StatusReused   // an earlier output was reused instead of running the tool
+	StatusCached   // the result came from the cache of an earlier run
+	StatusShard    // one chunk of a sharded node finished (Err set if it failed)
+	StatusOutput   // a batch of lines the running tool printed
+	StatusProgress // periodic line counts and elapsed time of a running tool
+	StatusSkipped  // no incoming edge's condition held, so the node did not run
+
+	StatusTargetStart // a target's run began (multi-target runs)
+	StatusTargetDone  // a target's run ended; Result holds its outcome
 )
 
 type Status struct {
@@ -49,6 +79,25 @@ type Status struct {
 	Category string
 	Tool     string // node.ID
 	Err      error
+
+	// chunk number (1-based) and chunk count for StatusShard and for the
+	// StatusOutput and StatusProgress of a chunk
+	Shard, Shards int
+
+	// StatusOutput
+	Stream  string   // "stdout" or "stderr"
+	Lines   []string // batched lines, oldest first
+	Dropped int      // lines skipped by rate limiting since the previous batch
+
+	// StatusProgress
+	OutLines int           // stdout lines so far in this attempt
+	ErrLines int           // stderr lines so far in this attempt
+	Elapsed  time.Duration // time since the attempt started
+
+	// multi-target runs label every event with the target it belongs to
+	Target string
+	RunID  string
+	Result RunStatus // StatusTargetDone
 }
 
 /* ─────────────────────────── Run Engine ─────────────────────────────── */
@@ -78,6 +127,11 @@ func Run(
 		return fmt.Errorf("failed to create seed file: %w", err)
 	}
 
+	vars, err := runVars(dataFlow, nil, nil)
+	if err != nil {
+		return err
+	}
+
 	for _, cat := range cats {
 
 		catDir := filepath.Join(workdir, dataFlow.RunID, "raw", dirSafe(cat.Name))
@@ -96,7 +150,7 @@ func Run(
 				defer wg.Done()
 				sem <- struct{}{}
 				defer func() { <-sem }()
-				_ = runTool(ctx, &tool, cat.Name, catDir, prevPath, dataFlow, out)
+				_ = runTool(ctx, &tool, cat.Name, catDir, prevPath, toolEnv{df: dataFlow, vars: vars, out: out})
 			}
 
 			if tool.Parallel {
@@ -134,51 +188,242 @@ func Run(
 
 /* ─────────────────────────── Helpers ──────────────────────────────── */
 
+// toolEnv carries the per-run services a tool execution reports to. Only df
+// and out are required.
+type toolEnv struct {
+	df      *DataFlow
+	ctl     *Controller       // pause/resume/stop
+	cache   *Cache            // result cache; nil disables it
+	vars    map[string]string // run-wide {{variables}}
+	secrets *secrets.Store    // injected per tool; nil injects nothing
+	out     chan<- Status
+
+	// a chunk of a sharded node runs under its own tool name; node and
+	// shard/shards say which node and chunk it is
+	node          string
+	shard, shards int
+}
+
+// nodeVars is nodeVars for tool run in env: {{node_id}} is the node's ID,
+// also for a chunk, and {{shard}}/{{shards}} are set for chunks.
+func (env toolEnv) nodeVars(tool *Tool, input, output string) map[string]string {
+	node := tool.Name
+	if env.node != "" {
+		node = env.node
+	}
+	v := nodeVars(env.vars, node, input, output)
+	if env.shards > 0 {
+		v["shard"], v["shards"] = strconv.Itoa(env.shard), strconv.Itoa(env.shards)
+	}
+	return v
+}
+
 func runTool(
 	ctx context.Context,
 	tool *Tool, // node-derived unique tool
 	catName, catDir string,
 	inputPath string,
-	dataFlow *DataFlow,
-	out chan<- Status,
+	env toolEnv,
 ) error {
 
 	startTime := time.Now()
-	var outputFiles []string
-	var errorLog strings.Builder
 
 	// Create unique output file for this tool
 	outputFile := filepath.Join(catDir, fmt.Sprintf("%s-%d.txt", tool.Name, startTime.Unix()))
-	outputFiles = append(outputFiles, outputFile)
 
-	// prepare args with placeholder substitution
-	args := make([]string, len(tool.Args))
-	copy(args, tool.Args)
+	res := execTool(ctx, tool, catName, catDir, inputPath, outputFile, env, func(st Status) bool {
+		st.Category, st.Tool = catName, tool.Name
+		return send(env.out, st)
+	})
 
-	for i, a := range args {
-		if strings.Contains(a, "{{input}}") {
-			args[i] = strings.ReplaceAll(a, "{{input}}", inputPath)
-		}
-		if strings.Contains(a, "{{domain}}") {
-			domain := strings.TrimSpace(readFirstLine(inputPath))
-			args[i] = strings.ReplaceAll(a, "{{domain}}", domain)
-		}
-		if strings.Contains(a, "{{output}}") {
-			args[i] = strings.ReplaceAll(a, "{{output}}", outputFile)
+	// Record the node output regardless of success/failure
+	env.df.recordOutput(tool.Name, tool.Command, startTime, time.Now(), res.exitCode, res.err == nil, []string{outputFile}, res.errorLog)
+	if res.cached {
+		env.df.RecordCacheHit(tool.Name, res.cacheID)
+		return nil
+	}
+	if res.termination != "" {
+		env.df.RecordTermination(tool.Name, res.termination)
+	}
+	env.df.AnnotateNode(tool.Name, map[string]string{
+		"attempts":  strconv.Itoa(res.attempts),
+		"timed_out": strconv.FormatBool(res.timedOut),
+	})
+
+	return res.err
+}
+
+// toolResult is the outcome of one execTool call.
+type toolResult struct {
+	exitCode    int
+	attempts    int
+	timedOut    bool
+	termination Termination // how the last attempt was stopped, if it was
+	cached      bool
+	cacheID     string
+	errorLog    string
+	err         error
+}
+
+// execTool produces outputFile from inputPath, either from the cache or by
+// running the tool with retries. Events go to emit rather than straight onto
+// the bus so callers can label them.
+func execTool(
+	ctx context.Context,
+	tool *Tool,
+	catName, catDir string,
+	inputPath, outputFile string,
+	env toolEnv,
+	emit func(Status) bool,
+) toolResult {
+
+	var res toolResult
+	var errorLog strings.Builder
+
+	// prepare args with placeholder substitution; shell nodes get every
+	// substituted value quoted so targets cannot inject shell syntax
+	quote := func(s string) string { return s }
+	if tool.Shell {
+		quote = shellQuote
+	}
+
+	// Reuse a cached result when the same tool already ran on the same input;
+	// paths that differ from run to run stay placeholders in the key
+	keyVars := env.nodeVars(tool, "{{input}}", "{{output}}")
+	keyVars["run_id"], keyVars["run_dir"], keyVars["work_dir"] = "{{run_id}}", "{{run_dir}}", "{{work_dir}}"
+	keyVars["secret_dir"] = "{{secret_dir}}"
+	keyArgs, usesOutput, err := expandArgs(tool.Args, keyVars, quote)
+	if err != nil {
+		emit(Status{Type: StatusError, Err: err})
+		res.exitCode, res.errorLog, res.err = 1, err.Error(), err
+		return res
+	}
+	if env.cache != nil && tool.CacheTTL > 0 {
+		key, err := cacheKey(tool, keyArgs, inputPath)
+		if err != nil {
+			log.Debug("Failed to compute cache key", "tool", tool.Name, "error", err)
 		}
+		res.cacheID = key
+	}
+	if res.cacheID != "" && env.cache.restore(res.cacheID, tool.CacheTTL, outputFile) {
+		emit(Status{Type: StatusCached})
+		res.cached = true
+		return res
 	}
 
 	// Validate tool before execution
 	if err := validateTool(tool); err != nil {
-		out <- Status{Type: StatusError, Category: catName, Tool: tool.Name, Err: err}
-		dataFlow.RecordNodeOutput(tool.Name, tool.Command, startTime, time.Now(), 1, outputFiles, err.Error())
-		return err
+		emit(Status{Type: StatusError, Err: err})
+		res.exitCode, res.errorLog, res.err = 1, err.Error(), err
+		return res
+	}
+
+	sec, err := prepareSecrets(env.secrets, tool, env.nodeVars(tool, inputPath, outputFile))
+	if err != nil {
+		err = fmt.Errorf("failed to prepare secrets: %w", err)
+		emit(Status{Type: StatusError, Err: err})
+		res.exitCode, res.errorLog, res.err = 1, err.Error(), err
+		return res
+	}
+	defer sec.cleanup()
+
+	vars := env.nodeVars(tool, inputPath, outputFile)
+	vars["secret_dir"] = sec.dir
+	args, _, _ := expandArgs(sec.withoutSkipped(tool, tool.Args), vars, quote)
+
+	emit(Status{Type: StatusStart})
+
+	for res.attempts = 1; ; res.attempts++ {
+		if res.attempts > 1 {
+			errorLog.WriteString(fmt.Sprintf("--- attempt %d ---\n", res.attempts))
+		}
+
+		res.exitCode, res.termination, err = runAttempt(ctx, tool, catName, catDir, args, inputPath, outputFile, usesOutput, &errorLog, env.ctl, sec, emit)
+		res.timedOut = res.termination == TermTimeout
+		if err == nil || res.attempts > tool.Retries || ctx.Err() != nil {
+			break
+		}
+
+		delay := backoffDelay(tool.Backoff, tool.BackoffDelay, res.attempts)
+		log.Debug("retrying tool", "cat", catName, "tool", tool.Name, "attempt", res.attempts, "delay", delay, "error", err)
+		emit(Status{Type: StatusRetry, Err: err})
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+		if env.ctl.wait(ctx) != nil {
+			break
+		}
+	}
+
+	switch {
+	case res.timedOut:
+		err = fmt.Errorf("timed out after %ds: %w", tool.Timeout, err)
+		emit(Status{Type: StatusTimeout, Err: err})
+	case err != nil:
+		emit(Status{Type: StatusError, Err: err})
+	default:
+		emit(Status{Type: StatusFinish})
+	}
+
+	if err == nil && res.cacheID != "" {
+		if cerr := env.cache.store(res.cacheID, tool, redactArgs(sec.redact, keyArgs), outputFile); cerr != nil {
+			log.Debug("Failed to cache tool output", "tool", tool.Name, "error", cerr)
+		}
 	}
 
-	out <- Status{Type: StatusStart, Category: catName, Tool: tool.Name}
+	res.errorLog, res.err = errorLog.String(), err
+	return res
+}
+
+// expandArgs substitutes {{variables}} in every arg and reports whether
+// {{output}} appeared at all.
+func expandArgs(in []string, vars map[string]string, quote func(string) string) ([]string, bool, error) {
+	args := make([]string, len(in))
+	for i, a := range in {
+		v, err := expandVars(a, vars, quote)
+		if err != nil {
+			return nil, false, err
+		}
+		args[i] = v
+	}
+	return args, usesVar(in, "output"), nil
+}
 
-	cmd := exec.CommandContext(ctx, tool.Command, args...)
+// runAttempt executes the tool once, bounded by tool.Timeout when set, and
+// reports how it was stopped if it did not simply exit.
+func runAttempt(
+	ctx context.Context,
+	tool *Tool,
+	catName, catDir string,
+	args []string,
+	inputPath, outputFile string,
+	usesOutput bool,
+	errorLog *strings.Builder,
+	ctl *Controller,
+	sec *toolSecrets,
+	emit func(Status) bool,
+) (exitCode int, term Termination, err error) {
+
+	if tool.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = ctl.withTimeout(ctx, time.Duration(tool.Timeout)*time.Second)
+		defer cancel()
+	}
+
+	name, argv := tool.Command, args
+	if tool.Shell {
+		script := shellQuote(tool.Command) + " " + strings.Join(args, " ")
+		name, argv = "/bin/sh", []string{"-c", script}
+	}
+	name, argv = withLimits(tool.Limits, name, argv)
+
+	cmd := exec.CommandContext(ctx, name, argv...)
 	cmd.Dir = catDir
+	setProcessGroup(cmd)
+	// a grandchild that escaped the group must not keep Wait blocked on our pipes
+	cmd.WaitDelay = 5 * time.Second
 
 	// Set environment variables for better tool compatibility
 	cmd.Env = append(os.Environ(),
@@ -186,55 +431,139 @@ func runTool(
 		"PYTHONUNBUFFERED=1",
 		"FORCE_COLOR=0",
 	)
+	cmd.Env = append(cmd.Env, sec.env...)
 
 	// For tools that read from stdin, setup input redirection
 	if tool.Stdin {
 		inputFile, err := os.Open(inputPath)
 		if err != nil {
-			out <- Status{Type: StatusError, Category: catName, Tool: tool.Name, Err: err}
-			dataFlow.RecordNodeOutput(tool.Name, tool.Command, startTime, time.Now(), 1, outputFiles, err.Error())
-			return err
+			return 1, "", err
 		}
 		defer inputFile.Close()
 		cmd.Stdin = inputFile
 	}
 
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		out <- Status{Type: StatusError, Category: catName, Tool: tool.Name, Err: err}
-		dataFlow.RecordNodeOutput(tool.Name, tool.Command, startTime, time.Now(), 1, outputFiles, err.Error())
-		return err
+	// Without an {{output}} placeholder the tool's stdout is its result
+	var outF *os.File
+	if !usesOutput {
+		outF, err = os.Create(outputFile)
+		if err != nil {
+			return 1, "", err
+		}
+		defer outF.Close()
 	}
 
-	go func() {
-		defer stderr.Close()
-		sc := bufio.NewScanner(stderr)
-		for sc.Scan() {
-			line := sc.Text()
-			errorLog.WriteString(line + "\n")
-			log.Debug("stderr", "cat", catName, "tool", tool.Name, "line", line)
+	live := newLiveOutput(emit)
+	logStart := errorLog.Len()
+
+	// secret values never reach the log, the live view or ErrorLog
+	stderr := newLineWriter(func(line string) {
+		line = sec.redact.Replace(line)
+		errorLog.WriteString(line + "\n")
+		live.line("stderr", line)
+		log.Debug("stderr", "cat", catName, "tool", tool.Name, "line", line)
+	})
+	cmd.Stderr = stderr
+
+	stdoutLines := newLineWriter(func(line string) {
+		line = sec.redact.Replace(line)
+		live.line("stdout", line)
+		if tool.Tee {
+			log.Debug("stdout", "cat", catName, "tool", tool.Name, "line", line)
+		}
+	})
+	var capped *cappedWriter
+	if outF != nil {
+		var result io.Writer = outF
+		if tool.Limits.FileSizeMB > 0 {
+			capped = &cappedWriter{
+				w:        outF,
+				left:     int64(tool.Limits.FileSizeMB) << 20,
+				exceeded: func() { _ = killProcess(cmd) },
+			}
+			result = capped
 		}
-	}()
+		cmd.Stdout = io.MultiWriter(result, stdoutLines)
+	} else {
+		cmd.Stdout = stdoutLines
+	}
 
-	err = cmd.Run()
-	endTime := time.Now()
-	exitCode := 0
+	if err = cmd.Start(); err == nil {
+		ctl.track(tool.Name, cmd)
+		err = cmd.Wait()
+		ctl.untrack(cmd)
+	}
+	stderr.Flush()
+	stdoutLines.Flush()
+	live.Close()
 
 	if err != nil {
+		exitCode = 1
 		if exitError, ok := err.(*exec.ExitError); ok {
 			exitCode = exitError.ExitCode()
-		} else {
-			exitCode = 1
+			if slices.Contains(tool.AcceptExit, exitCode) {
+				return exitCode, "", nil
+			}
+		}
+		term = classifyTermination(ctx, err, tool, errorLog.String()[logStart:])
+		if capped != nil && capped.hit {
+			term = TermFileSizeLimit
+		}
+		switch term {
+		case "", TermTimeout, TermCancelled:
+		default:
+			err = fmt.Errorf("%s: %w", term, err)
 		}
-		out <- Status{Type: StatusError, Category: catName, Tool: tool.Name, Err: err}
-	} else {
-		out <- Status{Type: StatusFinish, Category: catName, Tool: tool.Name}
 	}
 
-	// Record the node output regardless of success/failure
-	dataFlow.RecordNodeOutput(tool.Name, tool.Command, startTime, endTime, exitCode, outputFiles, errorLog.String())
+	return exitCode, term, err
+}
 
-	return err
+// classifyTermination works out why a failed attempt ended: termaid's own
+// timeout or cancellation, a signal (rlimit or an outside kill), or an rlimit
+// the tool ran into and reported on stderr before exiting.
+func classifyTermination(ctx context.Context, err error, tool *Tool, stderr string) Termination {
+	switch {
+	case errors.Is(context.Cause(ctx), context.DeadlineExceeded):
+		return TermTimeout
+	case ctx.Err() != nil:
+		return TermCancelled
+	}
+
+	if term, ok := signalTermination(err); ok {
+		return term
+	}
+
+	limits := tool.Limits
+	stderr = strings.ToLower(stderr)
+	switch {
+	case limits.MemoryMB > 0 && (strings.Contains(stderr, "out of memory") ||
+		strings.Contains(stderr, "cannot allocate memory") ||
+		strings.Contains(stderr, "memoryerror") ||
+		strings.Contains(stderr, "bad_alloc")):
+		return TermMemoryLimit
+	case limits.OpenFiles > 0 && strings.Contains(stderr, "too many open files"):
+		return TermOpenFilesLimit
+	}
+	return ""
+}
+
+// backoffDelay returns how long to wait before the next attempt. base is in
+// seconds and defaults to five; the delay is capped at five minutes.
+func backoffDelay(strategy string, base, attempt int) time.Duration {
+	if base <= 0 {
+		base = 5
+	}
+	d := time.Duration(base) * time.Second
+
+	switch strategy {
+	case "linear":
+		d *= time.Duration(attempt)
+	case "exponential":
+		d <<= uint(min(attempt-1, 16))
+	}
+
+	return min(d, 5*time.Minute)
 }
 
 /* mergeOutputs: process and merge all tool outputs with format detection - deprecated in favor of DataFlow */
@@ -303,6 +632,23 @@ func seedInput(domain string) (string, error) {
 
 func dirSafe(s string) string { return strings.ReplaceAll(strings.ToLower(s), " ", "_") }
 
+// shellQuote wraps s in single quotes for /bin/sh, escaping embedded quotes.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// splitWords splits args at whitespace like strings.Fields, except inside
+// quotes and regexes, which keep their delimiters.
+func splitWords(s string) []string {
+	var words []string
+	for _, w := range splitUnquoted(s, " ", "\t", "\n") {
+		if w != "" {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
 // validateTool checks if a tool exists and is executable
 func validateTool(tool *Tool) error {
 	// Check if command exists in PATH
@@ -313,15 +659,15 @@ func validateTool(tool *Tool) error {
 	// Tool-specific validations
 	switch tool.Command {
 	case "nuclei":
-		if !strings.Contains(tool.Args[0], "-t") && !strings.Contains(tool.Args[0], "-w") {
+		if !hasFlag(tool.Args, "-t", "-templates", "-w", "-workflows") {
 			return fmt.Errorf("nuclei requires templates (-t) or workflows (-w)")
 		}
 	case "ffuf":
-		if !strings.Contains(tool.Args[0], "-w") {
+		if !hasFlag(tool.Args, "-w") {
 			return fmt.Errorf("ffuf requires a wordlist (-w)")
 		}
 	case "gobuster":
-		if !strings.Contains(tool.Args[0], "-w") {
+		if !hasFlag(tool.Args, "-w", "--wordlist") {
 			return fmt.Errorf("gobuster requires a wordlist (-w)")
 		}
 	}
@@ -329,6 +675,21 @@ func validateTool(tool *Tool) error {
 	return nil
 }
 
+// hasFlag reports whether any of flags appears in args, on its own or as
+// flag=value. An arg may hold several words, so every word of every arg is
+// checked.
+func hasFlag(args []string, flags ...string) bool {
+	for _, arg := range args {
+		for _, word := range strings.Fields(arg) {
+			name, _, _ := strings.Cut(word, "=")
+			if slices.Contains(flags, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // parseOutputFile parses different output formats and returns normalized lines
 func parseOutputFile(filepath string) ([]string, error) {
 	file, err := os.Open(filepath)
@@ -471,17 +832,3 @@ func isValidTarget(s string) bool {
 
 	return false
 }
-
-func readFirstLine(path string) string {
-	f, err := os.Open(path)
-	if err != nil {
-		log.Debug("Failed to open file for reading first line", "path", path, "error", err)
-		return ""
-	}
-	defer f.Close()
-	sc := bufio.NewScanner(f)
-	if sc.Scan() {
-		return sc.Text()
-	}
-	return ""
-}
@@ -0,0 +1,84 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestValidateTool(t *testing.T) {
+	// stand-ins for the real tools, so only the args are checked
+	bin := t.TempDir()
+	for _, name := range []string{"nuclei", "ffuf", "gobuster"} {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte("#!/bin/sh\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin)
+
+	tests := []struct {
+		command string
+		args    []string
+		ok      bool
+	}{
+		{"nuclei", nil, false},
+		{"nuclei", []string{""}, false},
+		{"nuclei", []string{"-l", "{{input}}", "-t", "cves/"}, true},
+		{"nuclei", []string{"-l", "{{input}}", "-templates=cves/"}, true},
+		{"nuclei", []string{"-l {{input}} -w workflows/"}, true},
+		{"nuclei", []string{"-l", "{{input}}", "-tags", "cve"}, false},
+		{"ffuf", []string{"-u", "https://x/FUZZ", "-w", "words.txt"}, true},
+		{"ffuf", []string{"-u", "https://x/FUZZ"}, false},
+		{"gobuster", []string{"dir", "-u", "https://x", "--wordlist", "words.txt"}, true},
+		{"gobuster", []string{"dir", "-u", "https://x/-w"}, false},
+		{"missing-tool", nil, false},
+	}
+	for _, tt := range tests {
+		err := validateTool(&Tool{Command: tt.command, Args: tt.args})
+		if (err == nil) != tt.ok {
+			t.Errorf("validateTool(%s %q) = %v, want ok=%t", tt.command, tt.args, err, tt.ok)
+		}
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		strategy      string
+		base, attempt int
+		want          time.Duration
+	}{
+		{"fixed", 2, 3, 2 * time.Second},
+		{"", 2, 3, 2 * time.Second},
+		{"linear", 2, 3, 6 * time.Second},
+		{"exponential", 2, 1, 2 * time.Second},
+		{"exponential", 2, 3, 8 * time.Second},
+		{"fixed", 0, 1, 5 * time.Second}, // no base given
+		{"linear", 60, 10, 5 * time.Minute},
+		{"exponential", 1, 100, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := backoffDelay(tt.strategy, tt.base, tt.attempt); got != tt.want {
+			t.Errorf("backoffDelay(%q, %d, %d) = %v, want %v", tt.strategy, tt.base, tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"  a\tb \n c ", []string{"a", "b", "c"}},
+		{`-p "x y" z`, []string{"-p", `"x y"`, "z"}},
+		{"/a b/i c", []string{"/a b/i", "c"}},
+		{"https://x/y z", []string{"https://x/y", "z"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := splitWords(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("splitWords(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package pipeline
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/MKlolbullen/termaid/internal/graph"
+)
+
+/* ─────────────────────────── Typed Ports ────────────────────────────── */
+
+// Port types, as declared by in: and out: in the catalog and on nodes.
+const (
+	PortDomain   = "domain"   // an apex domain, like the run target
+	PortHosts    = "hosts"    // host names or IPs
+	PortURL      = "url"      // URLs, for tools that take one at a time
+	PortURLs     = "urls"     // URLs
+	PortPorts    = "ports"    // host:port pairs
+	PortFindings = "findings" // scanner results
+	PortAny      = "any"      // reads or writes anything
+	PortRaw      = "raw"      // untyped lines
+)
+
+// conversion turns one value into the next type; false drops the value.
+type conversion func(value string) (string, bool)
+
+// conversions are the single steps Bridge chains together.
+var conversions = map[[2]string]conversion{
+	{PortURLs, PortHosts}:   valueHost,
+	{PortPorts, PortHosts}:  valueHost,
+	{PortPorts, PortURLs}:   portURL,
+	{PortHosts, PortDomain}: apexDomain,
+}
+
+// Compatible reports whether a node writing from can feed a node reading to
+// as it is. Undeclared, any and raw ports match everything, url and urls are
+// the same data, and a domain is a host.
+func Compatible(from, to string) bool {
+	from, to = portKind(from), portKind(to)
+	switch {
+	case from == to:
+		return true
+	case from == "" || to == "" || from == PortAny || to == PortAny || from == PortRaw || to == PortRaw:
+		return true
+	case from == PortDomain && to == PortHosts:
+		return true
+	}
+	return false
+}
+
+// Bridge returns the chain of port types that turns from into to, ends
+// included ([urls hosts domain]). Compatible types need no chain; ok is false
+// when no chain of conversions exists.
+func Bridge(from, to string) (chain []string, ok bool) {
+	if Compatible(from, to) {
+		return nil, true
+	}
+	from, to = portKind(from), portKind(to)
+
+	// breadth first, so the shortest chain wins
+	prev := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+		if Compatible(t, to) {
+			for ; t != ""; t = prev[t] {
+				chain = append([]string{t}, chain...)
+			}
+			if chain[len(chain)-1] != to {
+				chain = append(chain, to)
+			}
+			return chain, true
+		}
+		for _, next := range nextPorts(t) {
+			if _, seen := prev[next]; !seen {
+				prev[next] = t
+				queue = append(queue, next)
+			}
+		}
+	}
+	return nil, false
+}
+
+// nextPorts lists the types one conversion away from t, in a fixed order.
+func nextPorts(t string) []string {
+	var next []string
+	for _, to := range []string{PortHosts, PortURLs, PortDomain} {
+		if _, ok := conversions[[2]string{t, to}]; ok {
+			next = append(next, to)
+		}
+	}
+	if t == PortDomain {
+		next = append(next, PortHosts)
+	}
+	return next
+}
+
+func portKind(t string) string {
+	if t == PortURL {
+		return PortURLs
+	}
+	return t
+}
+
+// convertValue runs value through every step of chain.
+func convertValue(value string, chain []string) (string, bool) {
+	for i := 0; i+1 < len(chain); i++ {
+		conv, ok := conversions[[2]string{chain[i], chain[i+1]}]
+		if !ok {
+			continue // a compatible hop, such as domain → hosts
+		}
+		if value, ok = conv(value); !ok {
+			return "", false
+		}
+	}
+	return value, true
+}
+
+// valueHost is the host named by a URL, host:port or JSON-lines record.
+func valueHost(value string) (string, bool) {
+	t, ok := parseTarget(value)
+	return t.host, ok && t.host != ""
+}
+
+// portURL turns host:port into a URL, https for the usual TLS ports.
+func portURL(value string) (string, bool) {
+	t, ok := parseTarget(value)
+	if !ok || t.host == "" {
+		return "", false
+	}
+	host := t.host
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	switch t.port {
+	case 0, 80:
+		return "http://" + host, true
+	case 443:
+		return "https://" + host, true
+	case 8443, 9443:
+		return "https://" + host + ":" + strconv.Itoa(t.port), true
+	}
+	return "http://" + host + ":" + strconv.Itoa(t.port), true
+}
+
+// secondLevelSuffixes are public suffixes of two labels, common enough that
+// an apex under them has three.
+var secondLevelSuffixes = map[string]bool{
+	"co.uk": true, "org.uk": true, "ac.uk": true, "gov.uk": true,
+	"com.au": true, "net.au": true, "org.au": true,
+	"co.jp": true, "co.kr": true, "co.nz": true, "co.za": true, "co.in": true,
+	"com.br": true, "com.cn": true, "com.mx": true, "com.tr": true, "com.sg": true,
+}
+
+// apexDomain reduces a host to its registrable domain. IPs have none.
+func apexDomain(value string) (string, bool) {
+	host, ok := valueHost(value)
+	if !ok || net.ParseIP(host) != nil {
+		return "", false
+	}
+
+	labels := strings.Split(host, ".")
+	n := 2
+	if len(labels) > 2 && secondLevelSuffixes[strings.Join(labels[len(labels)-2:], ".")] {
+		n = 3
+	}
+	if len(labels) < n {
+		return host, true
+	}
+	return strings.Join(labels[len(labels)-n:], "."), true
+}
+
+/* ─── graph integration ─── */
+
+// outPort is what node id writes. The root emits the run target.
+func outPort(g *graph.DAG, id string) string {
+	if id == g.Root {
+		return PortDomain
+	}
+	return g.Nodes[id].Out
+}
+
+// InsertConversions splices convert nodes into every edge whose types do not
+// match but can be bridged, one node per step of the chain. It returns the
+// IDs of the nodes it added and, as an error, the edges nothing bridges;
+// those keep passing lines through untouched.
+func InsertConversions(g *graph.DAG) ([]string, error) {
+	parents := nodeParents(g)
+	var added, unbridged []string
+
+	for _, id := range sortedNodeIDs(g) {
+		child := g.Nodes[id]
+		for _, p := range parents[id] {
+			from := outPort(g, p)
+			chain, ok := Bridge(from, child.In)
+			if !ok {
+				unbridged = append(unbridged, fmt.Sprintf("%s → %s (%s into %s)", p, id, from, child.In))
+				continue
+			}
+			if len(chain) == 0 {
+				continue
+			}
+
+			// nodes hanging off the root implicitly need a real edge to splice
+			if p == g.Root && !slices.Contains(g.Nodes[p].Children, id) {
+				if err := g.AddEdge(p, id); err != nil {
+					return added, err
+				}
+			}
+
+			parent := p
+			for i := 0; i+1 < len(chain); i++ {
+				convID := conversionID(g, chain[i], chain[i+1])
+				node, err := g.SpliceNode(parent, id, convID, ConvertTool)
+				if err != nil {
+					return added, err
+				}
+				node.In, node.Out = chain[i], chain[i+1]
+				added = append(added, convID)
+				parent = convID
+			}
+		}
+	}
+
+	if len(unbridged) > 0 {
+		return added, fmt.Errorf("no conversion between %s", strings.Join(unbridged, ", "))
+	}
+	return added, nil
+}
+
+// conversionID names a new convert node, e.g. urls-to-hosts-2.
+func conversionID(g *graph.DAG, from, to string) string {
+	for i := 1; ; i++ {
+		id := fmt.Sprintf("%s-to-%s-%d", from, to, i)
+		if _, taken := g.Nodes[id]; !taken {
+			return id
+		}
+	}
+}
+
+/* ─── DataFlow integration ─── */
+
+// setPortTypes remembers what every node of g writes, so the records read
+// from its output carry that type.
+func (df *DataFlow) setPortTypes(g *graph.DAG) {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+
+	df.types = map[string]string{"seed": PortDomain}
+	for id, n := range g.Nodes {
+		if n.Out != "" {
+			df.types[id] = n.Out
+		}
+	}
+}
+
+// recordType is the DataRecord type of a value nodeID produced: the one its
+// output port declares, else a guess from the value. Hosts stay a guess, as
+// they may be names or IPs.
+func (df *DataFlow) recordType(nodeID, value string) string {
+	switch portKind(df.types[nodeID]) {
+	case PortDomain:
+		return "domain"
+	case PortURLs:
+		return "url"
+	case PortPorts:
+		return "port"
+	case PortFindings:
+		return "finding"
+	}
+	return df.inferDataType(value)
+}
@@ -0,0 +1,122 @@
+package pipeline
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBridge(t *testing.T) {
+	tests := []struct {
+		from, to string
+		chain    []string
+		ok       bool
+	}{
+		{PortURLs, PortURL, nil, true},
+		{PortDomain, PortHosts, nil, true},
+		{"", PortHosts, nil, true},
+		{PortFindings, PortRaw, nil, true},
+		{PortURLs, PortHosts, []string{PortURLs, PortHosts}, true},
+		{PortURL, PortHosts, []string{PortURLs, PortHosts}, true},
+		{PortPorts, PortURL, []string{PortPorts, PortURLs}, true},
+		{PortURLs, PortDomain, []string{PortURLs, PortHosts, PortDomain}, true},
+		{PortHosts, PortURLs, nil, false},
+		{PortFindings, PortHosts, nil, false},
+	}
+	for _, tt := range tests {
+		chain, ok := Bridge(tt.from, tt.to)
+		if ok != tt.ok || !slices.Equal(chain, tt.chain) {
+			t.Errorf("Bridge(%q, %q) = %q, %t; want %q, %t", tt.from, tt.to, chain, ok, tt.chain, tt.ok)
+		}
+	}
+}
+
+func TestConvertValue(t *testing.T) {
+	tests := []struct {
+		value string
+		chain []string
+		want  string
+		ok    bool
+	}{
+		{"https://api.example.com:8443/v1?q=1", []string{PortURLs, PortHosts}, "api.example.com", true},
+		{"10.0.0.1:22", []string{PortPorts, PortHosts}, "10.0.0.1", true},
+		{"app.example.com:443", []string{PortPorts, PortURLs}, "https://app.example.com", true},
+		{"app.example.com:8443", []string{PortPorts, PortURLs}, "https://app.example.com:8443", true},
+		{"app.example.com:8080", []string{PortPorts, PortURLs}, "http://app.example.com:8080", true},
+		{"[::1]:80", []string{PortPorts, PortURLs}, "http://[::1]", true},
+		{"a.b.example.co.uk", []string{PortHosts, PortDomain}, "example.co.uk", true},
+		{"https://x.example.com/", []string{PortURLs, PortHosts, PortDomain}, "example.com", true},
+		{"10.0.0.1", []string{PortHosts, PortDomain}, "", false},
+		{"example.com", []string{PortDomain, PortHosts}, "example.com", true},
+	}
+	for _, tt := range tests {
+		got, ok := convertValue(tt.value, tt.chain)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("convertValue(%q, %q) = %q, %t; want %q, %t", tt.value, tt.chain, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestInsertConversions(t *testing.T) {
+	g := testDAG(t,
+		copies("crawl", "input"),
+		copies("resolve", "crawl"),
+		copies("whois", "crawl"),
+		copies("scan", "input"),
+		copies("nuclei", "input"),
+	)
+	g.Nodes["crawl"].Out = PortURLs
+	g.Nodes["resolve"].In = PortHosts   // urls → hosts
+	g.Nodes["whois"].In = PortDomain    // urls → hosts → domain
+	g.Nodes["scan"].In = PortHosts      // the target domain is a host already
+	g.Nodes["nuclei"].In = PortFindings // nothing turns a domain into findings
+
+	added, err := InsertConversions(g)
+	if err == nil {
+		t.Error("an unbridgeable edge was not reported")
+	}
+	want := []string{"urls-to-hosts-1", "urls-to-hosts-2", "hosts-to-domain-1"}
+	if !slices.Equal(added, want) {
+		t.Fatalf("added %q, want %q", added, want)
+	}
+
+	parents := nodeParents(g)
+	for _, edge := range [][2]string{
+		{"crawl", "urls-to-hosts-1"}, {"urls-to-hosts-1", "resolve"},
+		{"crawl", "urls-to-hosts-2"}, {"urls-to-hosts-2", "hosts-to-domain-1"}, {"hosts-to-domain-1", "whois"},
+	} {
+		if !slices.Equal(parents[edge[1]], []string{edge[0]}) {
+			t.Errorf("parents of %s = %q, want [%s]", edge[1], parents[edge[1]], edge[0])
+		}
+	}
+	if n := g.Nodes["urls-to-hosts-2"]; n.Tool != ConvertTool || n.In != PortURLs || n.Out != PortHosts {
+		t.Errorf("conversion node = %s %s → %s", n.Tool, n.In, n.Out)
+	}
+
+	// a second pass finds every edge bridged already
+	if again, _ := InsertConversions(g); len(again) != 0 {
+		t.Errorf("second pass added %q", again)
+	}
+}
+
+func TestSchedulerConvert(t *testing.T) {
+	g := testDAG(t,
+		emits(t, "crawl", []string{"input"},
+			"https://a.example.com/login", "https://a.example.com/admin", "not a url", "http://b.example.com:8080/"),
+		copies("resolve", "crawl"),
+	)
+	g.Nodes["crawl"].Out, g.Nodes["resolve"].In = PortURLs, PortHosts
+	if _, err := InsertConversions(g); err != nil {
+		t.Fatal(err)
+	}
+
+	df, _, err := runTestDAG(t, t.TempDir(), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readLines(t, df, "resolve"), []string{"a.example.com", "b.example.com"}; !slices.Equal(got, want) {
+		t.Errorf("resolve read %q, want %q", got, want)
+	}
+	if meta := df.NodeOutputs["urls-to-hosts-1"].Metadata; meta["records_in"] != "4" || meta["records_out"] != "2" {
+		t.Errorf("converted %s records into %s, want 4 into 2", meta["records_in"], meta["records_out"])
+	}
+}
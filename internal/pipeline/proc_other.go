@@ -0,0 +1,37 @@
+//go:build !unix
+
+package pipeline
+
+import (
+	"errors"
+	"os/exec"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/MKlolbullen/termaid/internal/graph"
+)
+
+var errNoJobControl = errors.New("suspending tools is not supported on this platform")
+
+// setProcessGroup is a no-op; cancellation kills only the direct child.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func suspendProcess(cmd *exec.Cmd) error { return errNoJobControl }
+func resumeProcess(cmd *exec.Cmd) error  { return errNoJobControl }
+
+func killProcess(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
+
+// withLimits leaves the command alone; rlimits need a unix shell.
+func withLimits(l graph.ResourceLimits, name string, args []string) (string, []string) {
+	if l.Set() {
+		log.Debug("Resource limits are not supported on this platform", "tool", name)
+	}
+	return name, args
+}
+
+func signalTermination(err error) (Termination, bool) { return "", false }
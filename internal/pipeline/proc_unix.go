@@ -0,0 +1,93 @@
+//go:build unix
+
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/MKlolbullen/termaid/internal/graph"
+)
+
+// setProcessGroup starts cmd in its own process group and makes context
+// cancellation kill the whole group rather than just the direct child.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return signalGroup(cmd, syscall.SIGKILL)
+	}
+}
+
+func suspendProcess(cmd *exec.Cmd) error { return signalGroup(cmd, syscall.SIGSTOP) }
+func resumeProcess(cmd *exec.Cmd) error  { return signalGroup(cmd, syscall.SIGCONT) }
+func killProcess(cmd *exec.Cmd) error    { return signalGroup(cmd, syscall.SIGKILL) }
+
+// signalGroup delivers sig to every process in cmd's group.
+func signalGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, sig)
+}
+
+// withLimits wraps name and args in a /bin/sh that sets the rlimits and then
+// execs the tool, so the limits hold from the tool's first instruction.
+func withLimits(l graph.ResourceLimits, name string, args []string) (string, []string) {
+	if !l.Set() {
+		return name, args
+	}
+
+	var steps []string
+	if l.CPUSeconds > 0 {
+		// a hard limit above the soft one, so the tool gets SIGXCPU first
+		// rather than an indistinguishable SIGKILL
+		steps = append(steps, fmt.Sprintf("ulimit -S -t %d", l.CPUSeconds),
+			fmt.Sprintf("ulimit -H -t %d", l.CPUSeconds+5))
+	}
+	if l.MemoryMB > 0 {
+		steps = append(steps, fmt.Sprintf("ulimit -v %d", l.MemoryMB*1024)) // KiB
+	}
+	if l.OpenFiles > 0 {
+		steps = append(steps, fmt.Sprintf("ulimit -n %d", l.OpenFiles))
+	}
+	if l.FileSizeMB > 0 {
+		steps = append(steps, fmt.Sprintf("ulimit -f %d", l.FileSizeMB*2048)) // 512-byte blocks
+	}
+	steps = append(steps, `exec "$0" "$@"`)
+
+	return "/bin/sh", append([]string{"-c", strings.Join(steps, " && "), name}, args...)
+}
+
+// signalTermination classifies a tool killed by a signal. Only what the wait
+// status proves counts: a shell exiting with 128 plus a signal number may
+// just have chosen that exit code.
+func signalTermination(err error) (Termination, bool) {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return "", false
+	}
+	ws, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok {
+		return "", false
+	}
+
+	if !ws.Signaled() {
+		return "", false
+	}
+
+	switch sig := ws.Signal(); sig {
+	case syscall.SIGXCPU:
+		return TermCPULimit, true
+	case syscall.SIGXFSZ:
+		return TermFileSizeLimit, true
+	case syscall.SIGKILL:
+		// termaid's own kills are classified before this is asked; who
+		// sent this one is unknown
+		return TermKilled, true
+	default:
+		return Termination("signal: " + sig.String()), true
+	}
+}
@@ -0,0 +1,146 @@
+//go:build unix
+
+package pipeline
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MKlolbullen/termaid/internal/graph"
+)
+
+// procState returns the state letter of pid from /proc (R, S, T, …).
+func procState(t *testing.T, pid int) string {
+	t.Helper()
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		t.Skip("no /proc to inspect process state")
+	}
+	// the state follows the parenthesised command name
+	fields := strings.Fields(string(data[strings.LastIndexByte(string(data), ')')+1:]))
+	return fields[0]
+}
+
+func TestControllerSuspend(t *testing.T) {
+	ctx, ctl := NewController(context.Background())
+	cmd := exec.CommandContext(ctx, "sleep", "30")
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ctl.track("sleep", cmd)
+	defer func() {
+		ctl.Stop()
+		_ = cmd.Wait()
+	}()
+
+	// eventually, since the signal is delivered asynchronously
+	state := func(want string) {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			if procState(t, cmd.Process.Pid) == want {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("tool state = %s, want %s", procState(t, cmd.Process.Pid), want)
+	}
+
+	ctl.Pause(true)
+	state("T")
+	ctl.Resume()
+	state("S")
+}
+
+func TestWithLimits(t *testing.T) {
+	name, args := withLimits(graph.ResourceLimits{}, "echo", []string{"hi"})
+	if name != "echo" || len(args) != 1 {
+		t.Errorf("no limits wrapped the tool: %s %q", name, args)
+	}
+
+	limits := graph.ResourceLimits{CPUSeconds: 30, OpenFiles: 64, FileSizeMB: 1}
+	name, args = withLimits(limits, "sh", []string{"-c", `ulimit -n; ulimit -S -t; ulimit -H -t; ulimit -f; echo "$1"`, "sh", "a b"})
+	out, err := exec.Command(name, args...).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the tool's own args survive the wrapper, spaces and all
+	if got, want := strings.Fields(string(out)), []string{"64", "30", "35", "2048", "a", "b"}; !slices.Equal(got, want) {
+		t.Errorf("limits seen by the tool = %q, want %q", got, want)
+	}
+}
+
+func TestSignalTermination(t *testing.T) {
+	tests := []struct {
+		script string
+		want   Termination
+		ok     bool
+	}{
+		{"kill -XCPU $$", TermCPULimit, true},
+		{"kill -XFSZ $$", TermFileSizeLimit, true},
+		{"kill -KILL $$", TermKilled, true},
+		{"kill -TERM $$", "signal: terminated", true},
+		{"exit 137", "", false}, // looks like SIGKILL, but is just an exit code
+		{"exit 1", "", false},
+	}
+	for _, tt := range tests {
+		err := exec.Command("sh", "-c", tt.script).Run()
+		term, ok := signalTermination(err)
+		if term != tt.want || ok != tt.ok {
+			t.Errorf("%q: signalTermination = %q, %t; want %q, %t", tt.script, term, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestClassifyTermination(t *testing.T) {
+	exitErr := exec.Command("sh", "-c", "exit 1").Run()
+	limited := &Tool{Limits: graph.ResourceLimits{MemoryMB: 64, OpenFiles: 16}}
+
+	timedOut, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	stopped, stop := context.WithCancel(context.Background())
+	stop()
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		tool   *Tool
+		stderr string
+		want   Termination
+	}{
+		{"timeout", timedOut, &Tool{}, "", TermTimeout},
+		{"cancelled", stopped, &Tool{}, "", TermCancelled},
+		{"memory", context.Background(), limited, "fatal error: out of memory", TermMemoryLimit},
+		{"open files", context.Background(), limited, "dial tcp: socket: Too many open files", TermOpenFilesLimit},
+		// without the limit set the message is the tool's own business
+		{"unlimited", context.Background(), &Tool{}, "too many open files", ""},
+		{"plain failure", context.Background(), limited, "no such host", ""},
+	}
+	for _, tt := range tests {
+		if got := classifyTermination(tt.ctx, exitErr, tt.tool, tt.stderr); got != tt.want {
+			t.Errorf("%s: classifyTermination = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSchedulerFileSizeLimit(t *testing.T) {
+	g := testDAG(t, testNode{id: "big", tool: "dd", args: "if=/dev/zero bs=1000000 count=3", parents: []string{"input"}})
+	g.Nodes["big"].Limits = graph.ResourceLimits{FileSizeMB: 1}
+
+	df, _, err := runTestDAG(t, t.TempDir(), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := df.NodeOutputs["big"].Termination; got != TermFileSizeLimit {
+		t.Errorf("termination = %q, want %q", got, TermFileSizeLimit)
+	}
+	if df.NodeState("big") != NodeFailed {
+		t.Errorf("state = %v, want failed", df.NodeState("big"))
+	}
+}
@@ -0,0 +1,652 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/MKlolbullen/termaid/internal/graph"
+	"github.com/MKlolbullen/termaid/internal/secrets"
+)
+
+/* ─────────────────────────── DAG Scheduler ──────────────────────────── */
+
+// RunOptions tunes a RunDAG execution.
+type RunOptions struct {
+	Concurrency  int               // nodes running at once across the whole run
+	ToolLimits   map[string]int    // tool binary → instances running at once
+	Control      *Controller       // optional pause/resume/stop handle
+	WorkflowPath string            // recorded in the run state for reference
+	Scope        *graph.Scope      // overrides the workflow's scope
+	Vars         map[string]string // overrides the workflow's variables
+	Secrets      *secrets.Store    // source of the secrets nodes ask for
+
+	NoCache  bool          // ignore and do not populate the result cache
+	CacheDir string        // defaults to <workdir>/cache
+	CacheTTL time.Duration // defaults to DefaultCacheTTL
+
+	TargetConcurrency int // targets running at once in RunTargets
+
+	Force bool // run even if graph.Validate finds problems
+
+	limits *limiter // shared across the runs of RunTargets
+}
+
+// snapshotFile is the copy of the workflow kept in each run directory so the
+// run can be resumed even if the original file changes.
+const snapshotFile = "workflow.json"
+
+// RunDAG executes a workflow graph edge by edge. Every node starts as soon as
+// all of its parents have finished and is fed the input DataFlow prepares from
+// exactly those parents. Nodes without an explicit parent hang off the root.
+func RunDAG(
+	ctx context.Context,
+	domain string,
+	workdir string,
+	g *graph.DAG,
+	opts RunOptions,
+	out chan<- Status,
+) error {
+
+	dataFlow, err := newRun(workdir, domain, g, opts)
+	if err != nil {
+		return err
+	}
+
+	return runDataFlow(ctx, dataFlow, g, opts, out)
+}
+
+// newRun creates the run directory for one target: state, workflow snapshot,
+// scope and seed file.
+func newRun(workdir, domain string, g *graph.DAG, opts RunOptions) (*DataFlow, error) {
+	if err := os.MkdirAll(workdir, 0o755); err != nil {
+		return nil, err
+	}
+
+	dataFlow, err := NewDataFlow(workdir, domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize data flow: %w", err)
+	}
+
+	// secret values pasted into variables or args stay out of the state
+	// and snapshot; resuming such a run needs them passed again
+	dataFlow.redact = opts.Secrets.Redactor()
+	dataFlow.GlobalState.WorkflowPath = opts.WorkflowPath
+	dataFlow.GlobalState.Vars = redactVars(dataFlow.redact, opts.Vars)
+
+	snapshot := filepath.Join(workdir, dataFlow.RunID, snapshotFile)
+	if err := os.WriteFile(snapshot, []byte(dataFlow.redact.Replace(g.ToJSON())), 0o644); err != nil {
+		return nil, fmt.Errorf("failed to snapshot workflow: %w", err)
+	}
+
+	scope := opts.Scope
+	if scope == nil {
+		scope = g.Scope
+	}
+	if err := dataFlow.SetScope(scope); err != nil {
+		return nil, err
+	}
+
+	if _, err := dataFlow.CreateSeedFile(); err != nil {
+		return nil, fmt.Errorf("failed to create seed file: %w", err)
+	}
+
+	return dataFlow, nil
+}
+
+// ResumeDAG continues an interrupted run from its checkpoint. Nodes that
+// already completed keep their outputs; everything else runs again.
+func ResumeDAG(
+	ctx context.Context,
+	workdir string,
+	runID string,
+	g *graph.DAG,
+	opts RunOptions,
+	out chan<- Status,
+) error {
+
+	dataFlow, err := LoadDataFlow(workdir, runID)
+	if err != nil {
+		return err
+	}
+	dataFlow.redact = opts.Secrets.Redactor()
+
+	// without an explicit scope the run keeps the one it started with
+	if err := dataFlow.SetScope(opts.Scope); err != nil {
+		return err
+	}
+	if opts.Vars == nil {
+		opts.Vars = dataFlow.GlobalState.Vars
+	}
+
+	return runDataFlow(ctx, dataFlow, g, opts, out)
+}
+
+// SnapshotPath returns where a run keeps its copy of the workflow.
+func SnapshotPath(workdir, runID string) string {
+	return filepath.Join(workdir, runID, snapshotFile)
+}
+
+func runDataFlow(ctx context.Context, dataFlow *DataFlow, g *graph.DAG, opts RunOptions, out chan<- Status) error {
+	s, err := newScheduler(g, dataFlow, opts, out)
+	if err != nil {
+		return err
+	}
+	dataFlow.setPortTypes(g)
+	dataFlow.setGraph(g)
+	if err := dataFlow.setParsers(g); err != nil {
+		return err
+	}
+
+	if !opts.NoCache {
+		dir := opts.CacheDir
+		if dir == "" {
+			dir = filepath.Join(dataFlow.WorkDir, "cache")
+		}
+		cache, err := NewCache(dir)
+		if err != nil {
+			return err
+		}
+		s.cache = cache
+		s.cacheTTL = opts.CacheTTL
+		if s.cacheTTL <= 0 {
+			s.cacheTTL = DefaultCacheTTL
+		}
+	}
+
+	runErr := s.run(ctx)
+
+	status, reason := s.runStatus(ctx, runErr)
+	if err := dataFlow.SetRunStatus(status, reason); err != nil {
+		log.Debug("Failed to record run status", "error", err)
+	}
+	if runErr == nil && status == RunFailed {
+		runErr = fmt.Errorf("run failed: %s", reason)
+	}
+
+	if err := dataFlow.CreateExecutionReport(); err != nil {
+		log.Debug("Failed to create execution report", "error", err)
+	}
+
+	return runErr
+}
+
+// ToolFromNode converts a workflow node into the Tool the runner executes.
+// Shell nodes keep their args as one string so the shell can parse them.
+func ToolFromNode(n *graph.Node) Tool {
+	args := strings.Fields(n.Args)
+	if n.Shell {
+		args = []string{n.Args}
+	}
+	return Tool{
+		Name:     n.ID,
+		Command:  n.Tool,
+		Args:     args,
+		Output:   fmt.Sprintf("%s_%s.txt", n.Tool, n.ID),
+		Parallel: n.Parallel,
+		Tee:      n.Tee,
+		Shell:    n.Shell,
+
+		Timeout:      intValue(n.Timeout),
+		Retries:      intValue(n.Retries),
+		Backoff:      n.Backoff,
+		BackoffDelay: intValue(n.BackoffDelay),
+		AcceptExit:   n.AcceptExit,
+
+		SecretEnv:   n.SecretEnv,
+		SecretFiles: n.SecretFiles,
+
+		Limits: n.Limits,
+	}
+}
+
+// intValue reads an optional node setting; unset is 0.
+func intValue(p *int) int {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+type scheduler struct {
+	g        *graph.DAG
+	df       *DataFlow
+	parents  map[string][]string
+	children map[string][]string
+	pending  map[string]int             // node ID → parents not yet finished
+	conds    map[[2]string]*condition   // {parent, child} → edge condition
+	taken    map[string]map[string]bool // node ID → parents whose edge to it was taken
+	aborted  string                     // node whose failure aborted the run
+	limits   *limiter
+	vars     map[string]string // run-wide {{variables}}
+	secrets  *secrets.Store
+	ctl      *Controller
+	cache    *Cache
+	cacheTTL time.Duration
+	out      chan<- Status
+}
+
+func newScheduler(g *graph.DAG, df *DataFlow, opts RunOptions, out chan<- Status) (*scheduler, error) {
+	if errs := graph.Errors(g.Validate()); len(errs) > 0 && !opts.Force {
+		return nil, &graph.ValidationError{Problems: errs}
+	}
+
+	s := &scheduler{
+		g:        g,
+		df:       df,
+		parents:  nodeParents(g),
+		children: make(map[string][]string),
+		pending:  make(map[string]int),
+		conds:    make(map[[2]string]*condition),
+		taken:    make(map[string]map[string]bool),
+		limits:   opts.limits,
+		secrets:  opts.Secrets,
+		ctl:      opts.Control,
+		out:      out,
+	}
+
+	if s.limits == nil {
+		s.limits = newLimiter(opts.Concurrency, runLimits(g, opts.ToolLimits))
+	}
+
+	vars, err := runVars(df, g.Vars, opts.Vars)
+	if err != nil {
+		return nil, err
+	}
+	s.vars = vars
+
+	for _, id := range sortedNodeIDs(g) {
+		for _, p := range s.parents[id] {
+			s.children[p] = append(s.children[p], id)
+		}
+		s.pending[id] = len(s.parents[id])
+	}
+
+	for _, id := range sortedNodeIDs(g) {
+		switch g.Nodes[id].OnError {
+		case "", graph.OnErrorContinue, graph.OnErrorSkipDescendants, graph.OnErrorAbort, graph.OnErrorRequired:
+		default:
+			return nil, fmt.Errorf("node %s: unknown on_error policy %q", id, g.Nodes[id].OnError)
+		}
+
+		// catch undefined variables before anything runs
+		tool := ToolFromNode(g.Nodes[id])
+		if _, _, err := expandArgs(tool.Args, nodeVars(vars, id, "", ""), nil); err != nil {
+			return nil, fmt.Errorf("node %s: %w", id, err)
+		}
+		if b, ok := builtinFor(g.Nodes[id]); ok {
+			if _, err := compileBuiltin(g.Nodes[id], b, s.parents[id], nodeVars(vars, id, "", "")); err != nil {
+				return nil, fmt.Errorf("node %s: %w", id, err)
+			}
+		}
+
+		for _, c := range s.children[id] {
+			src := g.Nodes[id].Condition(c)
+			if src == "" {
+				continue
+			}
+			cond, err := parseCondition(src)
+			if err != nil {
+				return nil, fmt.Errorf("edge %s → %s: %w", id, c, err)
+			}
+			s.conds[[2]string{id, c}] = cond
+		}
+	}
+
+	return s, nil
+}
+
+// run drives the graph until no node is running and none can be started.
+// A failed abort-workflow node cancels everything still running.
+func (s *scheduler) run(parent context.Context) error {
+	ctx, abort := context.WithCancel(parent)
+	defer abort()
+
+	type result struct {
+		id    string
+		taken map[string]bool
+	}
+	done := make(chan result)
+	running := 0
+	finished := make(map[string]bool)
+
+	launch := func(id string) {
+		running++
+		inputs := s.inputIDs(id)
+		go func() {
+			s.execute(ctx, id, inputs)
+			done <- result{id, s.follow(id)}
+		}()
+	}
+
+	// settle marks id finished and starts every child whose parents have now
+	// all finished. A child none of whose incoming edges was taken is skipped,
+	// which in turn settles it.
+	var settle func(id string, taken map[string]bool)
+	settle = func(id string, taken map[string]bool) {
+		finished[id] = true
+		for _, c := range s.children[id] {
+			if taken[c] {
+				if s.taken[c] == nil {
+					s.taken[c] = make(map[string]bool)
+				}
+				s.taken[c][id] = true
+			}
+			s.pending[c]--
+			if s.pending[c] > 0 || ctx.Err() != nil {
+				continue
+			}
+			if len(s.taken[c]) == 0 {
+				s.skip(c)
+				settle(c, nil)
+				continue
+			}
+			launch(c)
+		}
+	}
+
+	settle(s.g.Root, s.follow(s.g.Root))
+
+	for running > 0 {
+		res := <-done
+		running--
+		if s.aborted == "" && parent.Err() == nil &&
+			s.g.Nodes[res.id].OnError == graph.OnErrorAbort && !s.succeeded(res.id) {
+			s.aborted = res.id
+			abort()
+		}
+		settle(res.id, res.taken)
+	}
+
+	if s.aborted != "" {
+		return fmt.Errorf("run aborted: %s failed (on_error: %s)", s.aborted, graph.OnErrorAbort)
+	}
+	if err := parent.Err(); err != nil {
+		return err
+	}
+
+	if len(finished) < len(s.g.Nodes) {
+		var stuck []string
+		for _, id := range sortedNodeIDs(s.g) {
+			if !finished[id] {
+				stuck = append(stuck, id)
+			}
+		}
+		return fmt.Errorf("nodes never became ready (cycle?): %s", strings.Join(stuck, ", "))
+	}
+
+	return nil
+}
+
+// execute prepares the input for a single node from the parents in inputs
+// and runs it.
+func (s *scheduler) execute(ctx context.Context, id string, inputs []string) {
+	node := s.g.Nodes[id]
+	catName := fmt.Sprintf("layer-%d", node.Layer)
+	catDir := filepath.Join(s.df.WorkDir, s.df.RunID, "raw", catName)
+
+	if _, ok := s.df.ReusableOutput(id); ok {
+		s.out <- Status{Type: StatusReused, Category: catName, Tool: id}
+		return
+	}
+
+	if err := os.MkdirAll(catDir, 0o755); err != nil {
+		s.fail(id, node.Tool, catName, err)
+		return
+	}
+
+	inputPath, err := s.df.PrepareNodeInput(id, inputs, node.Layer)
+	if err != nil {
+		s.fail(id, node.Tool, catName, fmt.Errorf("failed to prepare input: %w", err))
+		return
+	}
+
+	if b, ok := builtinFor(node); ok {
+		if s.ctl.wait(ctx) == nil {
+			s.runBuiltin(node, b, inputs, catName, catDir, inputPath)
+		}
+		return
+	}
+
+	tool := ToolFromNode(node)
+	tool.CacheTTL = s.nodeCacheTTL(node)
+	env := toolEnv{df: s.df, ctl: s.ctl, cache: s.cache, vars: s.vars, secrets: s.secrets, out: s.out}
+
+	if node.Shard.Enabled() {
+		// every chunk takes its own slot
+		if s.ctl.wait(ctx) != nil {
+			return
+		}
+		if err := s.df.SetNodeState(id, NodeRunning); err != nil {
+			log.Debug("Failed to checkpoint node state", "node", id, "error", err)
+		}
+		_ = s.runSharded(ctx, node, &tool, catName, catDir, inputPath, env)
+	} else {
+		release, ok := s.slot(ctx, limitKeys(node))
+		if !ok {
+			return
+		}
+		if err := s.df.SetNodeState(id, NodeRunning); err != nil {
+			log.Debug("Failed to checkpoint node state", "node", id, "error", err)
+		}
+		_ = runTool(ctx, &tool, catName, catDir, inputPath, env)
+		release()
+	}
+
+	if err := s.df.ProcessNodeOutputs(id); err != nil {
+		log.Debug("Failed to process node outputs", "node", id, "error", err)
+	}
+}
+
+// slot waits out any pause, then takes a run slot under keys. ok is false
+// when the run ended first.
+func (s *scheduler) slot(ctx context.Context, keys []string) (release func(), ok bool) {
+	if s.ctl.wait(ctx) != nil {
+		return nil, false
+	}
+	if s.limits.acquire(ctx, keys) != nil {
+		return nil, false
+	}
+
+	// a pause may have begun while this node queued for a slot
+	if s.ctl.wait(ctx) != nil {
+		s.limits.release(keys)
+		return nil, false
+	}
+
+	return func() { s.limits.release(keys) }, true
+}
+
+// runLimits collects the per-tool caps from opts and the per-subgraph caps
+// declared in the workflow into one keyed table for the limiter.
+func runLimits(g *graph.DAG, tools map[string]int) map[string]int {
+	caps := make(map[string]int)
+	for tool, n := range tools {
+		if n > 0 {
+			caps["tool:"+tool] = n
+		}
+	}
+	for id, sg := range g.Subgraphs {
+		if sg.MaxParallel > 0 {
+			caps["subgraph:"+id] = sg.MaxParallel
+		}
+	}
+	return caps
+}
+
+// limitKeys names the caps a node counts against.
+func limitKeys(node *graph.Node) []string {
+	keys := []string{"tool:" + node.Tool}
+	if node.Subgraph != "" {
+		keys = append(keys, "subgraph:"+node.Subgraph)
+	}
+	return keys
+}
+
+// nodeCacheTTL resolves a node's cache_ttl against the run default. Every
+// node is cached unless its cache_ttl is "off".
+func (s *scheduler) nodeCacheTTL(node *graph.Node) time.Duration {
+	if s.cache == nil {
+		return 0
+	}
+	switch node.CacheTTL {
+	case "":
+		return s.cacheTTL
+	case "off", "0":
+		return 0
+	}
+	ttl, err := time.ParseDuration(node.CacheTTL)
+	if err != nil {
+		log.Debug("Invalid cache_ttl, using default", "node", node.ID, "value", node.CacheTTL)
+		return s.cacheTTL
+	}
+	return ttl
+}
+
+// follow decides which outgoing edges of a finished node are taken.
+// Unconditional edges always are; an "else" edge is taken when no other
+// condition on the node held.
+func (s *scheduler) follow(id string) map[string]bool {
+	taken := make(map[string]bool)
+	if s.g.Nodes[id].OnError == graph.OnErrorSkipDescendants && !s.succeeded(id) {
+		return taken
+	}
+
+	var in *conditionInput
+	var elses []string
+	matched := false
+
+	for _, c := range s.children[id] {
+		cond := s.conds[[2]string{id, c}]
+		switch {
+		case cond == nil:
+			taken[c] = true
+		case cond.isElse:
+			elses = append(elses, c)
+		default:
+			if in == nil {
+				ci := s.df.conditionInput(id)
+				in = &ci
+			}
+			taken[c] = cond.eval(*in)
+			matched = matched || taken[c]
+			log.Debug("Evaluated edge condition", "from", id, "to", c, "condition", cond.src, "taken", taken[c])
+		}
+	}
+
+	for _, c := range elses {
+		taken[c] = !matched
+	}
+
+	return taken
+}
+
+// succeeded reports whether a node finished successfully. The root always
+// has.
+func (s *scheduler) succeeded(id string) bool {
+	return id == s.g.Root || s.df.NodeState(id) == NodeCompleted
+}
+
+// runStatus works out the overall outcome of a finished run from the error
+// policies of the nodes that did not succeed.
+func (s *scheduler) runStatus(ctx context.Context, runErr error) (RunStatus, string) {
+	switch {
+	case s.aborted != "":
+		return RunAborted, fmt.Sprintf("%s failed (on_error: %s)", s.aborted, graph.OnErrorAbort)
+	case ctx.Err() != nil:
+		return RunCancelled, "stopped before all nodes finished"
+	case runErr != nil:
+		return RunFailed, runErr.Error()
+	}
+
+	var required, failed []string
+	for _, id := range sortedNodeIDs(s.g) {
+		if s.succeeded(id) {
+			continue
+		}
+		switch {
+		case s.g.Nodes[id].OnError == graph.OnErrorRequired:
+			required = append(required, id)
+		case s.df.NodeState(id) == NodeFailed:
+			failed = append(failed, id)
+		}
+	}
+
+	switch {
+	case len(required) > 0:
+		return RunFailed, "required nodes did not succeed: " + strings.Join(required, ", ")
+	case len(failed) > 0:
+		return RunPartial, "nodes failed: " + strings.Join(failed, ", ")
+	}
+	return RunSucceeded, ""
+}
+
+// skip records a node none of whose incoming edges was taken.
+func (s *scheduler) skip(id string) {
+	node := s.g.Nodes[id]
+	catName := fmt.Sprintf("layer-%d", node.Layer)
+	s.out <- Status{Type: StatusSkipped, Category: catName, Tool: id}
+	if err := s.df.SetNodeState(id, NodeSkipped); err != nil {
+		log.Debug("Failed to checkpoint node state", "node", id, "error", err)
+	}
+}
+
+// fail reports a node that could not be started.
+func (s *scheduler) fail(id, tool, catName string, err error) {
+	now := time.Now()
+	s.out <- Status{Type: StatusError, Category: catName, Tool: id, Err: err}
+	s.df.RecordNodeOutput(id, tool, now, now, 1, nil, err.Error())
+}
+
+// inputIDs maps the parents whose edge to id was taken to the IDs DataFlow
+// records outputs under.
+func (s *scheduler) inputIDs(id string) []string {
+	var ids []string
+	for _, p := range s.parents[id] {
+		if !s.taken[id][p] {
+			continue
+		}
+		if p == s.g.Root {
+			p = "seed"
+		}
+		ids = append(ids, p)
+	}
+	return ids
+}
+
+// nodeParents maps every node of g to its parents. Nodes that no edge points
+// at are attached to the root, matching how workflow files leave it implicit.
+func nodeParents(g *graph.DAG) map[string][]string {
+	parents := make(map[string][]string, len(g.Nodes))
+	for id := range g.Nodes {
+		if ps := g.Parents(id); len(ps) > 0 {
+			parents[id] = ps
+		}
+	}
+	return parents
+}
+
+// sortedNodeIDs returns node IDs ordered by layer, position and ID.
+func sortedNodeIDs(g *graph.DAG) []string {
+	ids := make([]string, 0, len(g.Nodes))
+	for id := range g.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := g.Nodes[ids[i]], g.Nodes[ids[j]]
+		if a.Layer != b.Layer {
+			return a.Layer < b.Layer
+		}
+		if a.Position != b.Position {
+			return a.Position < b.Position
+		}
+		return a.ID < b.ID
+	})
+	return ids
+}
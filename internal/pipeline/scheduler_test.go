@@ -0,0 +1,505 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MKlolbullen/termaid/internal/graph"
+)
+
+// testNode is a node of a test workflow; the first parent places it.
+type testNode struct {
+	id, tool, args string
+	parents        []string
+	onError        string
+	acceptExit     []int
+	conds          map[string]string // parent → condition on its edge to this node
+}
+
+// emits prints a file holding values, one per line; its stdout is its output.
+func emits(t *testing.T, id string, parents []string, values ...string) testNode {
+	t.Helper()
+	src := filepath.Join(t.TempDir(), id+".txt")
+	if err := os.WriteFile(src, []byte(strings.Join(values, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return testNode{id: id, tool: "cat", args: src, parents: parents}
+}
+
+// awk runs an awk program over its input; its stdout is its output.
+func awk(t *testing.T, id string, parents []string, prog string) testNode {
+	t.Helper()
+	src := filepath.Join(t.TempDir(), id+".awk")
+	if err := os.WriteFile(src, []byte(prog+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return testNode{id: id, tool: "awk", args: "-f " + src + " {{input}}", parents: parents}
+}
+
+// copies passes its input through unchanged.
+func copies(id string, parents ...string) testNode {
+	return testNode{id: id, tool: "cp", args: "{{input}} {{output}}", parents: parents}
+}
+
+func testDAG(t *testing.T, nodes ...testNode) *graph.DAG {
+	t.Helper()
+	g := graph.NewDAG()
+	for _, n := range nodes {
+		layer := 1
+		for _, p := range n.parents {
+			layer = max(layer, g.Nodes[p].Layer+1)
+		}
+		if err := g.AddNode(n.parents[0], n.id, n.tool, n.args, layer); err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range n.parents[1:] {
+			if err := g.AddEdge(p, n.id); err != nil {
+				t.Fatal(err)
+			}
+		}
+		node := g.Nodes[n.id]
+		node.OnError, node.AcceptExit = n.onError, n.acceptExit
+		for p, cond := range n.conds {
+			parent := g.Nodes[p]
+			if parent.Conditions == nil {
+				parent.Conditions = make(map[string]string)
+			}
+			parent.Conditions[n.id] = cond
+		}
+	}
+	return g
+}
+
+// collect runs fn and returns every status it sent.
+func collect(fn func(out chan<- Status) error) ([]Status, error) {
+	out := make(chan Status, 64)
+	done := make(chan []Status)
+	go func() {
+		var all []Status
+		for st := range out {
+			all = append(all, st)
+		}
+		done <- all
+	}()
+	err := fn(out)
+	close(out)
+	return <-done, err
+}
+
+// runTestDAG runs g against example.com in a fresh work directory.
+func runTestDAG(t *testing.T, workdir string, g *graph.DAG) (*DataFlow, []Status, error) {
+	t.Helper()
+	df, err := NewDataFlow(workdir, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := df.CreateSeedFile(); err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := collect(func(out chan<- Status) error {
+		return runDataFlow(context.Background(), df, g, RunOptions{Concurrency: 4, NoCache: true}, out)
+	})
+	return df, statuses, err
+}
+
+// events lists the status types each node reported, in order, leaving out
+// live output and progress.
+func events(statuses []Status) map[string][]StatusUpdateType {
+	byNode := make(map[string][]StatusUpdateType)
+	for _, st := range statuses {
+		if st.Type != StatusOutput && st.Type != StatusProgress {
+			byNode[st.Tool] = append(byNode[st.Tool], st.Type)
+		}
+	}
+	return byNode
+}
+
+func readLines(t *testing.T, df *DataFlow, nodeID string) []string {
+	t.Helper()
+	file, err := df.GetLatestOutput(nodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Fields(string(data))
+}
+
+func TestSchedulerFanIn(t *testing.T) {
+	g := testDAG(t,
+		emits(t, "a", []string{"input"}, "a.example.com", "b.example.com"),
+		emits(t, "b", []string{"input"}, "b.example.com", "c.example.com"),
+		emits(t, "c", []string{"a"}, "d.example.com"),
+		copies("merge", "b", "c", "a"),
+	)
+	df, statuses, err := runTestDAG(t, t.TempDir(), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// merge waited for every parent, c two layers in included
+	want := []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com"}
+	if got := readLines(t, df, "merge"); !slices.Equal(got, want) {
+		t.Errorf("merge read %q, want %q", got, want)
+	}
+	merge := df.NodeOutputs["merge"]
+	for _, p := range []string{"a", "b", "c"} {
+		if end := df.NodeOutputs[p].EndTime; merge.StartTime.Before(end) {
+			t.Errorf("merge started at %v, before %s finished at %v", merge.StartTime, p, end)
+		}
+	}
+	for id, evs := range events(statuses) {
+		if !slices.Equal(evs, []StatusUpdateType{StatusStart, StatusFinish}) {
+			t.Errorf("%s reported %v, want start and finish", id, evs)
+		}
+	}
+}
+
+func TestSchedulerSkips(t *testing.T) {
+	tests := []struct {
+		name    string
+		nodes   []testNode
+		ran     []string
+		skipped []string
+	}{
+		{
+			name: "skip-descendants stops the subtree",
+			nodes: []testNode{
+				{id: "bad", tool: "false", parents: []string{"input"}, onError: graph.OnErrorSkipDescendants},
+				emits(t, "child", []string{"bad"}, "x.example.com"),
+				emits(t, "grandchild", []string{"child"}, "y.example.com"),
+				emits(t, "other", []string{"input"}, "z.example.com"),
+			},
+			ran:     []string{"bad", "other"},
+			skipped: []string{"child", "grandchild"},
+		},
+		{
+			name: "continue still feeds children",
+			nodes: []testNode{
+				{id: "bad", tool: "false", parents: []string{"input"}},
+				emits(t, "child", []string{"bad"}, "x.example.com"),
+			},
+			ran: []string{"bad", "child"},
+		},
+		{
+			name: "condition not met and else taken",
+			nodes: []testNode{
+				emits(t, "a", []string{"input"}, "a.example.com"),
+				{id: "many", tool: "cat", args: "{{input}}", parents: []string{"a"}, conds: map[string]string{"a": "lines > 100"}},
+				{id: "few", tool: "cat", args: "{{input}}", parents: []string{"a"}, conds: map[string]string{"a": "else"}},
+				emits(t, "after", []string{"many"}, "b.example.com"),
+			},
+			ran:     []string{"a", "few"},
+			skipped: []string{"many", "after"},
+		},
+		{
+			name: "fan-in runs on the parents that were taken",
+			nodes: []testNode{
+				emits(t, "a", []string{"input"}, "a.example.com"),
+				emits(t, "b", []string{"input"}, "b.example.com"),
+				{id: "join", tool: "cat", args: "{{input}}", parents: []string{"a", "b"}, conds: map[string]string{"b": "empty"}},
+			},
+			ran: []string{"a", "b", "join"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			df, statuses, err := runTestDAG(t, t.TempDir(), testDAG(t, tt.nodes...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			byNode := events(statuses)
+			for _, id := range tt.ran {
+				if !slices.Contains(byNode[id], StatusStart) {
+					t.Errorf("%s did not run: %v", id, byNode[id])
+				}
+			}
+			for _, id := range tt.skipped {
+				if !slices.Equal(byNode[id], []StatusUpdateType{StatusSkipped}) {
+					t.Errorf("%s reported %v, want only skipped", id, byNode[id])
+				}
+				if got := df.GlobalState.NodeStates[id]; got != NodeSkipped {
+					t.Errorf("%s state = %v, want skipped", id, got)
+				}
+			}
+		})
+	}
+
+	// the join above read only a's output
+	df, _, err := runTestDAG(t, t.TempDir(), testDAG(t, tests[3].nodes...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readLines(t, df, "join"); !slices.Equal(got, []string{"a.example.com"}) {
+		t.Errorf("join read %q, want only a's output", got)
+	}
+}
+
+func TestRunStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		nodes  []testNode
+		status RunStatus
+		fails  bool // the run returns an error
+	}{
+		{
+			name:   "all succeed",
+			nodes:  []testNode{emits(t, "a", []string{"input"}, "a.example.com")},
+			status: RunSucceeded,
+		},
+		{
+			name: "a failure that does not matter",
+			nodes: []testNode{
+				emits(t, "a", []string{"input"}, "a.example.com"),
+				{id: "bad", tool: "false", parents: []string{"input"}},
+			},
+			status: RunPartial,
+		},
+		{
+			name: "accepted exit code",
+			nodes: []testNode{
+				{id: "test", tool: "test", args: "-z {{input}}", parents: []string{"input"}, acceptExit: []int{1}},
+			},
+			status: RunSucceeded,
+		},
+		{
+			name: "required node failed",
+			nodes: []testNode{
+				{id: "bad", tool: "false", parents: []string{"input"}, onError: graph.OnErrorRequired},
+			},
+			status: RunFailed,
+			fails:  true,
+		},
+		{
+			name: "required node skipped",
+			nodes: []testNode{
+				{id: "bad", tool: "false", parents: []string{"input"}, onError: graph.OnErrorSkipDescendants},
+				{id: "need", tool: "cat", args: "{{input}}", parents: []string{"bad"}, onError: graph.OnErrorRequired},
+			},
+			status: RunFailed,
+			fails:  true,
+		},
+		{
+			name: "abort",
+			nodes: []testNode{
+				{id: "bad", tool: "false", parents: []string{"input"}, onError: graph.OnErrorAbort},
+				emits(t, "child", []string{"bad"}, "x.example.com"),
+			},
+			status: RunAborted,
+			fails:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			df, statuses, err := runTestDAG(t, t.TempDir(), testDAG(t, tt.nodes...))
+			if (err != nil) != tt.fails {
+				t.Errorf("run returned %v, want error %t", err, tt.fails)
+			}
+			if got := df.GlobalState.Status; got != tt.status {
+				t.Errorf("run status = %s (%s), want %s", got, df.GlobalState.StatusReason, tt.status)
+			}
+			if tt.status == RunAborted && events(statuses)["child"] != nil {
+				t.Errorf("child of an aborting node ran: %v", events(statuses)["child"])
+			}
+		})
+	}
+}
+
+func TestSchedulerBadCondition(t *testing.T) {
+	g := testDAG(t,
+		emits(t, "a", []string{"input"}, "a.example.com"),
+		testNode{id: "b", tool: "cat", args: "{{input}}", parents: []string{"a"}, conds: map[string]string{"a": "lines >"}},
+	)
+	_, statuses, err := runTestDAG(t, t.TempDir(), g)
+	if err == nil || !strings.Contains(err.Error(), "a → b") {
+		t.Fatalf("run returned %v, want the bad edge named", err)
+	}
+	if len(statuses) != 0 {
+		t.Errorf("nodes ran despite an invalid condition: %v", statuses)
+	}
+}
+
+func TestSchedulerChain(t *testing.T) {
+	g := testDAG(t,
+		emits(t, "a", []string{"input"}, "a.example.com"),
+		copies("b", "a"),
+		copies("c", "b"),
+	)
+	df, _, err := runTestDAG(t, t.TempDir(), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a single parent's output is read as is, so it flows down unchanged
+	if got := readLines(t, df, "c"); !slices.Equal(got, []string{"a.example.com"}) {
+		t.Errorf("c read %q", got)
+	}
+	if got := df.GlobalState.DataLinks["c"]; len(got) != 1 || got[0] != df.NodeOutputs["b"].OutputFiles[0] {
+		t.Errorf("c linked to %q, want b's output", got)
+	}
+}
+
+func TestSchedulerShell(t *testing.T) {
+	g := testDAG(t,
+		testNode{id: "shell", tool: "echo", args: "a.example.com | tr a-z A-Z", parents: []string{"input"}},
+		testNode{id: "plain", tool: "echo", args: "a.example.com | tr a-z A-Z", parents: []string{"input"}},
+	)
+	g.Nodes["shell"].Shell = true
+
+	df, _, err := runTestDAG(t, t.TempDir(), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readLines(t, df, "shell"); !slices.Equal(got, []string{"A.EXAMPLE.COM"}) {
+		t.Errorf("shell node wrote %q, want the piped output", got)
+	}
+	// without shell mode the operators reach the tool as plain arguments
+	if got, want := readLines(t, df, "plain"), []string{"a.example.com", "|", "tr", "a-z", "A-Z"}; !slices.Equal(got, want) {
+		t.Errorf("plain node wrote %q, want %q", got, want)
+	}
+}
+
+func TestSchedulerRetry(t *testing.T) {
+	// fails the first time, when the marker is missing, and passes after
+	marker := filepath.Join(t.TempDir(), "marker")
+	g := testDAG(t, testNode{id: "flaky", tool: "test", args: "-e " + marker + " || { touch " + marker + "; exit 1; }", parents: []string{"input"}})
+	n := g.Nodes["flaky"]
+	retries, delay := 2, 1
+	n.Shell, n.Retries, n.BackoffDelay = true, &retries, &delay
+
+	df, statuses, err := runTestDAG(t, t.TempDir(), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := events(statuses)["flaky"], []StatusUpdateType{StatusStart, StatusRetry, StatusFinish}; !slices.Equal(got, want) {
+		t.Errorf("flaky reported %v, want %v", got, want)
+	}
+	if meta := df.NodeOutputs["flaky"].Metadata; meta["attempts"] != "2" {
+		t.Errorf("flaky took %s attempts, want 2", meta["attempts"])
+	}
+}
+
+func TestSchedulerTimeout(t *testing.T) {
+	g := testDAG(t, testNode{id: "slow", tool: "sleep", args: "30", parents: []string{"input"}})
+	timeout := 1
+	g.Nodes["slow"].Timeout = &timeout
+
+	start := time.Now()
+	df, statuses, _ := runTestDAG(t, t.TempDir(), g)
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("run took %v despite a 1s timeout", elapsed)
+	}
+	if got, want := events(statuses)["slow"], []StatusUpdateType{StatusStart, StatusTimeout}; !slices.Equal(got, want) {
+		t.Errorf("slow reported %v, want %v", got, want)
+	}
+	if meta := df.NodeOutputs["slow"].Metadata; meta["timed_out"] != "true" || meta["attempts"] != "1" {
+		t.Errorf("slow metadata = %v", meta)
+	}
+}
+
+func TestSchedulerLayerOrder(t *testing.T) {
+	g := testDAG(t,
+		emits(t, "a", []string{"input"}, "a.example.com"),
+		copies("b", "a"),
+	)
+	// drawn left of its parent, b still runs after it
+	if err := g.MoveNode("b", 1, 5); err != nil {
+		t.Fatal(err)
+	}
+	df, _, err := runTestDAG(t, t.TempDir(), g)
+	if err != nil {
+		t.Fatalf("misdrawn workflow refused: %v", err)
+	}
+	if got := readLines(t, df, "b"); !slices.Equal(got, []string{"a.example.com"}) {
+		t.Errorf("b read %q", got)
+	}
+}
+
+func TestSchedulerCycle(t *testing.T) {
+	g := testDAG(t,
+		copies("a", "input"),
+		copies("b", "a"),
+	)
+	// AddEdge refuses cycles, so the edge goes straight into Children
+	g.Nodes["b"].Children = append(g.Nodes["b"].Children, "a")
+	g.Reindex()
+
+	_, statuses, err := runTestDAG(t, t.TempDir(), g)
+	if err == nil || !strings.Contains(err.Error(), "cycle: a → b → a") {
+		t.Fatalf("run returned %v, want the cycle refused", err)
+	}
+	if len(statuses) != 0 {
+		t.Errorf("nodes of a cycle ran: %v", statuses)
+	}
+
+	// forced past validation, the scheduler still never starts them
+	df, err := NewDataFlow(t.TempDir(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses, err = collect(func(out chan<- Status) error {
+		return runDataFlow(context.Background(), df, g, RunOptions{Concurrency: 4, NoCache: true, Force: true}, out)
+	})
+	if err == nil || !strings.Contains(err.Error(), "a, b") {
+		t.Fatalf("forced run returned %v, want both nodes reported stuck", err)
+	}
+	if len(statuses) != 0 {
+		t.Errorf("nodes of a cycle ran: %v", statuses)
+	}
+}
+
+func TestResumeDAG(t *testing.T) {
+	workdir := t.TempDir()
+	flag := filepath.Join(t.TempDir(), "flag")
+	g := testDAG(t,
+		emits(t, "a", []string{"input"}, "a.example.com"),
+		// fails until flag exists
+		testNode{id: "b", tool: "cat", args: flag + " {{input}}", parents: []string{"a"}},
+	)
+
+	df, _, err := runTestDAG(t, workdir, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := df.GlobalState.NodeStates["b"]; got != NodeFailed {
+		t.Fatalf("b state = %v, want failed", got)
+	}
+	if err := os.WriteFile(flag, []byte("flag.example.com\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := collect(func(out chan<- Status) error {
+		return ResumeDAG(context.Background(), workdir, df.RunID, g, RunOptions{Concurrency: 4}, out)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byNode := events(statuses)
+	if !slices.Equal(byNode["a"], []StatusUpdateType{StatusReused}) {
+		t.Errorf("a reported %v on resume, want reused", byNode["a"])
+	}
+	if !slices.Equal(byNode["b"], []StatusUpdateType{StatusStart, StatusFinish}) {
+		t.Errorf("b reported %v on resume, want it to run again", byNode["b"])
+	}
+
+	// the checkpoint on disk has caught up with the resumed run
+	resumed, err := LoadDataFlow(workdir, df.RunID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b"} {
+		if got := resumed.GlobalState.NodeStates[id]; got != NodeCompleted {
+			t.Errorf("%s state = %v after resume, want completed", id, got)
+		}
+	}
+	if got := readLines(t, resumed, "b"); !slices.Equal(got, []string{"flag.example.com", "a.example.com"}) {
+		t.Errorf("b read %q after resume", got)
+	}
+}
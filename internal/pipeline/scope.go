@@ -0,0 +1,367 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/MKlolbullen/termaid/internal/graph"
+)
+
+/* ─────────────────────────── Scope Enforcement ──────────────────────── */
+
+// scopeAuditFile lists every record the scope kept from reaching a node.
+const scopeAuditFile = "scope-audit.jsonl"
+
+// scopeRules is a compiled graph.Scope.
+type scopeRules struct {
+	spec         graph.Scope
+	include      []hostRule
+	exclude      []hostRule
+	includePaths []*regexp.Regexp
+	excludePaths []*regexp.Regexp
+}
+
+// hostRule matches a host by glob or, for IPs, by CIDR.
+type hostRule struct {
+	glob string
+	cidr *net.IPNet
+}
+
+// scopeTarget is the part of a record the scope is checked against.
+type scopeTarget struct {
+	host string
+	port int // 0 when the record names no port
+	path string
+}
+
+// auditEntry is one line of the scope audit file.
+type auditEntry struct {
+	Time   time.Time `json:"time"`
+	Node   string    `json:"node"`   // node whose input the record was dropped from
+	Source string    `json:"source"` // node that produced the record
+	Value  string    `json:"value"`
+	Reason string    `json:"reason"`
+}
+
+func compileScope(spec graph.Scope) (*scopeRules, error) {
+	r := &scopeRules{spec: spec}
+
+	var err error
+	if r.include, err = compileHostRules(spec.Include); err != nil {
+		return nil, err
+	}
+	if r.exclude, err = compileHostRules(spec.Exclude); err != nil {
+		return nil, err
+	}
+	if r.includePaths, err = compileRegexps(spec.IncludePaths); err != nil {
+		return nil, err
+	}
+	if r.excludePaths, err = compileRegexps(spec.ExcludePaths); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func compileHostRules(patterns []string) ([]hostRule, error) {
+	rules := make([]hostRule, 0, len(patterns))
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if strings.Contains(p, "/") {
+			_, cidr, err := net.ParseCIDR(p)
+			if err != nil {
+				return nil, fmt.Errorf("scope: bad CIDR %q: %w", p, err)
+			}
+			rules = append(rules, hostRule{cidr: cidr})
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("scope: bad glob %q: %w", p, err)
+		}
+		rules = append(rules, hostRule{glob: p})
+	}
+	return rules, nil
+}
+
+func compileRegexps(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("scope: bad path regex %q: %w", p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func (h hostRule) match(host string) bool {
+	if h.cidr != nil {
+		ip := net.ParseIP(host)
+		return ip != nil && h.cidr.Contains(ip)
+	}
+	if ok, _ := path.Match(h.glob, host); ok {
+		return true
+	}
+	// "*.example.com" covers the apex example.com as well
+	return strings.HasPrefix(h.glob, "*.") && host == h.glob[2:]
+}
+
+func matchAny(rules []hostRule, host string) (string, bool) {
+	for _, r := range rules {
+		if r.match(host) {
+			if r.cidr != nil {
+				return r.cidr.String(), true
+			}
+			return r.glob, true
+		}
+	}
+	return "", false
+}
+
+// check reports whether a record value is in scope and, if not, why. A value
+// naming no host (words, parameters, free text) is out of scope: with a scope
+// set nothing reaches a node unchecked.
+func (r *scopeRules) check(value string) (bool, string) {
+	t, ok := lineTarget(value)
+	if !ok {
+		return false, "no host to check against the scope"
+	}
+
+	if rule, hit := matchAny(r.exclude, t.host); hit {
+		return false, fmt.Sprintf("host %s excluded by %s", t.host, rule)
+	}
+	if len(r.include) > 0 {
+		if _, hit := matchAny(r.include, t.host); !hit {
+			return false, fmt.Sprintf("host %s not in scope", t.host)
+		}
+	}
+
+	if t.port != 0 {
+		if slices.Contains(r.spec.ExcludePorts, t.port) {
+			return false, fmt.Sprintf("port %d excluded", t.port)
+		}
+		if len(r.spec.Ports) > 0 && !slices.Contains(r.spec.Ports, t.port) {
+			return false, fmt.Sprintf("port %d not in scope", t.port)
+		}
+	}
+
+	if t.path != "" {
+		for _, re := range r.excludePaths {
+			if re.MatchString(t.path) {
+				return false, fmt.Sprintf("path %s excluded by %s", t.path, re)
+			}
+		}
+		if len(r.includePaths) > 0 && !slices.ContainsFunc(r.includePaths, func(re *regexp.Regexp) bool {
+			return re.MatchString(t.path)
+		}) {
+			return false, fmt.Sprintf("path %s not in scope", t.path)
+		}
+	}
+
+	return true, ""
+}
+
+// urlInLineRe finds a URL inside a line of tool output.
+var urlInLineRe = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"'<>\[\]]+`)
+
+// lineTarget is parseTarget for raw tool lines: a plain-text line with
+// several fields, like httpx's "https://a.example.com [200] [Title]" or
+// dnsx's "a.example.com [A] 1.2.3.4", is judged by its first field or,
+// failing that, the first URL in it.
+func lineTarget(value string) (scopeTarget, bool) {
+	value = strings.TrimSpace(value)
+	fields := strings.Fields(value)
+	if strings.HasPrefix(value, "{") || len(fields) < 2 {
+		return parseTarget(value)
+	}
+	if t, ok := parseTarget(fields[0]); ok {
+		return t, true
+	}
+	if u := urlInLineRe.FindString(value); u != "" {
+		return parseTarget(u)
+	}
+	return scopeTarget{}, false
+}
+
+// parseTarget pulls host, port and path out of a URL, host:port, bare host or
+// IP, or the url/host field of a JSON-lines record.
+func parseTarget(value string) (scopeTarget, bool) {
+	value = strings.TrimSpace(value)
+
+	if strings.HasPrefix(value, "{") {
+		var obj map[string]any
+		if err := json.Unmarshal([]byte(value), &obj); err != nil {
+			return scopeTarget{}, false
+		}
+		for _, key := range []string{"url", "matched-at", "host", "input", "ip"} {
+			if s, ok := obj[key].(string); ok && s != "" {
+				t, ok := parseTarget(s)
+				if ok && t.port == 0 {
+					if p, ok := obj["port"]; ok {
+						t.port, _ = strconv.Atoi(fmt.Sprint(p))
+					}
+				}
+				return t, ok
+			}
+		}
+		return scopeTarget{}, false
+	}
+
+	if strings.Contains(value, "://") {
+		u, err := url.Parse(value)
+		if err != nil || u.Hostname() == "" {
+			return scopeTarget{}, false
+		}
+		t := scopeTarget{host: strings.ToLower(u.Hostname()), path: u.EscapedPath()}
+		switch {
+		case u.Port() != "":
+			t.port, _ = strconv.Atoi(u.Port())
+		case u.Scheme == "http":
+			t.port = 80
+		case u.Scheme == "https":
+			t.port = 443
+		}
+		return t, true
+	}
+
+	host := value
+	t := scopeTarget{}
+	if h, p, err := net.SplitHostPort(value); err == nil {
+		host = h
+		t.port, _ = strconv.Atoi(p)
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	if net.ParseIP(host) == nil && (!strings.Contains(host, ".") || strings.ContainsAny(host, " \t/")) {
+		return scopeTarget{}, false
+	}
+	t.host = host
+	return t, true
+}
+
+/* ─── DataFlow integration ─── */
+
+// SetScope makes every node input pass through scope. A nil scope keeps the
+// one recorded for the run, if any, so resumed runs stay scoped.
+func (df *DataFlow) SetScope(scope *graph.Scope) error {
+	df.mu.Lock()
+	if scope == nil {
+		scope = df.GlobalState.Scope
+	}
+	if scope == nil {
+		df.scope = nil
+		df.mu.Unlock()
+		return nil
+	}
+
+	rules, err := compileScope(*scope)
+	if err != nil {
+		df.mu.Unlock()
+		return err
+	}
+	df.scope = rules
+	df.GlobalState.Scope = scope
+	cp := df.snapshot()
+	df.mu.Unlock()
+
+	return df.saveCheckpoint(cp)
+}
+
+// scopeRecords drops out-of-scope records bound for nodeID and appends each
+// one to the audit file. Callers do not hold df.mu.
+func (df *DataFlow) scopeRecords(nodeID string, records []DataRecord) []DataRecord {
+	if df.scope == nil {
+		return records
+	}
+
+	var kept []DataRecord
+	var dropped []auditEntry
+	for _, rec := range records {
+		if ok, reason := df.scope.check(rec.Value); !ok {
+			dropped = append(dropped, auditEntry{
+				Time:   time.Now(),
+				Node:   nodeID,
+				Source: rec.Source,
+				Value:  df.redacted(rec.Value),
+				Reason: reason,
+			})
+			continue
+		}
+		kept = append(kept, rec)
+	}
+
+	if len(dropped) > 0 {
+		df.mu.Lock()
+		df.GlobalState.Statistics.ScopeDropped += len(dropped)
+		df.mu.Unlock()
+		if err := df.appendAudit(dropped); err != nil {
+			log.Debug("Failed to write scope audit", "node", nodeID, "error", err)
+		}
+	}
+
+	return kept
+}
+
+// scopedInput returns file unchanged when every record in it is in scope,
+// otherwise a filtered copy written for nodeID. The output of a node with a
+// parser is always rewritten, as the values the parser picked out. Callers
+// do not hold df.mu.
+func (df *DataFlow) scopedInput(nodeID, sourceID, file string, layer int) (string, error) {
+	_, parsed := df.parsers[sourceID]
+	if df.scope == nil && !parsed {
+		return file, nil
+	}
+
+	records, err := df.parseFile(file, sourceID)
+	if err != nil {
+		return "", err
+	}
+	kept := df.scopeRecords(nodeID, records)
+	if len(kept) == len(records) && !parsed {
+		return file, nil
+	}
+
+	scoped := filepath.Join(df.WorkDir, df.RunID, "merged",
+		fmt.Sprintf("L%02d-%s-input.txt", layer, nodeID))
+	var b strings.Builder
+	for _, rec := range kept {
+		b.WriteString(rec.Value + "\n")
+	}
+	if err := os.WriteFile(scoped, []byte(b.String()), 0o644); err != nil {
+		return "", err
+	}
+	return scoped, nil
+}
+
+func (df *DataFlow) appendAudit(entries []auditEntry) error {
+	df.auditMu.Lock()
+	defer df.auditMu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(df.WorkDir, df.RunID, scopeAuditFile),
+		os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
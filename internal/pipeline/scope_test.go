@@ -0,0 +1,116 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MKlolbullen/termaid/internal/graph"
+)
+
+func TestScopeCheck(t *testing.T) {
+	scope := graph.Scope{
+		Include:      []string{"*.example.com", "10.0.0.0/24"},
+		Exclude:      []string{"admin.example.com"},
+		ExcludePaths: []string{`^/logout`},
+		ExcludePorts: []int{8443},
+	}
+	rules, err := compileScope(scope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		// httpx -sc -title -td
+		{"httpx in scope", "https://app.example.com [200] [Login] [nginx]", true},
+		{"httpx out of scope", "https://evil.com [200] [Example Domain]", false},
+		{"httpx excluded host", "https://admin.example.com [302]", false},
+		{"httpx excluded port", "https://app.example.com:8443 [200]", false},
+		{"httpx excluded path", "https://app.example.com/logout [200]", false},
+		{"httpx json", `{"url":"https://app.example.com","status_code":200,"host":"93.184.216.34"}`, true},
+		{"httpx json out of scope", `{"url":"https://evil.com","status_code":200}`, false},
+		// dnsx -a -resp
+		{"dnsx in scope", "api.example.com [A] [93.184.216.34]", true},
+		{"dnsx out of scope", "api.example.org [A] [93.184.216.34]", false},
+		{"dnsx json", `{"host":"api.example.com","a":["93.184.216.34"]}`, true},
+		{"apex covered by wildcard", "example.com", true},
+		{"lookalike not covered", "badexample.com", false},
+		{"cidr", "10.0.0.7", true},
+		{"outside cidr", "10.0.1.7", false},
+		{"host and port", "10.0.0.7:22", true},
+		{"url found later in the line", "[INF] found https://app.example.com/x", true},
+		{"no host", "admin", false},
+		{"free text", "some words here", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := rules.check(tt.value)
+			if got != tt.want {
+				t.Errorf("check(%q) = %v (%s), want %v", tt.value, got, reason, tt.want)
+			}
+			if !got && reason == "" {
+				t.Errorf("check(%q) dropped the value without a reason", tt.value)
+			}
+		})
+	}
+}
+
+func TestCompileScopeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope graph.Scope
+	}{
+		{"bad cidr", graph.Scope{Include: []string{"10.0.0.0/33"}}},
+		{"bad glob", graph.Scope{Exclude: []string{"[a"}}},
+		{"bad path regex", graph.Scope{IncludePaths: []string{"("}}},
+	}
+	for _, tt := range tests {
+		if _, err := compileScope(tt.scope); err == nil {
+			t.Errorf("%s: compileScope succeeded", tt.name)
+		}
+	}
+}
+
+func TestScopedInputAudits(t *testing.T) {
+	df, err := NewDataFlow(t.TempDir(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := df.SetScope(&graph.Scope{Include: []string{"*.example.com"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(df.WorkDir, df.RunID, "raw", "httpx.txt")
+	lines := "https://a.example.com [200] [Home]\nhttps://evil.com [200] [Example Domain]\n"
+	if err := os.WriteFile(file, []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	scoped, err := df.scopedInput("nuclei", "httpx", file, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(scoped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "https://a.example.com [200] [Home]\n" {
+		t.Errorf("scoped input = %q", got)
+	}
+
+	audit, err := os.ReadFile(filepath.Join(df.WorkDir, df.RunID, scopeAuditFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(audit), "evil.com") || strings.Count(string(audit), "\n") != 1 {
+		t.Errorf("audit = %q, want one entry for evil.com", audit)
+	}
+	if got := df.GlobalState.Statistics.ScopeDropped; got != 1 {
+		t.Errorf("ScopeDropped = %d, want 1", got)
+	}
+}
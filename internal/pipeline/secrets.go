@@ -0,0 +1,183 @@
+package pipeline
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/MKlolbullen/termaid/internal/secrets"
+)
+
+/* ─────────────────────────── Secrets Injection ──────────────────────── */
+
+// toolSecrets is what one execution gets from the secrets store: extra
+// environment, a private directory of rendered config files and a redactor
+// for everything the tool prints.
+type toolSecrets struct {
+	env     []string
+	dir     string   // holds the rendered SecretFiles; "" when there are none
+	skipped []string // SecretFiles not written because none of their secrets are set
+	redact  *strings.Replacer
+}
+
+// prepareSecrets resolves tool.SecretEnv and renders tool.SecretFiles into a
+// fresh directory only the owner can read. Secrets missing from the store are
+// left out: their variables are not set, and file lines that mention them are
+// dropped, so optional providers can be listed side by side. A file none of
+// whose secrets are set is not written at all; see withoutSkipped.
+func prepareSecrets(store *secrets.Store, tool *Tool, vars map[string]string) (*toolSecrets, error) {
+	ts := &toolSecrets{redact: store.Redactor()}
+	if store == nil {
+		store = &secrets.Store{}
+	}
+
+	for env, name := range tool.SecretEnv {
+		if v, ok := store.Get(name); ok {
+			ts.env = append(ts.env, env+"="+v)
+		} else {
+			log.Debug("Secret not set", "tool", tool.Name, "secret", name, "env", env)
+		}
+	}
+
+	if len(tool.SecretFiles) == 0 {
+		return ts, nil
+	}
+
+	dir, err := os.MkdirTemp("", "termaid-secrets-")
+	if err != nil {
+		return nil, err
+	}
+	ts.dir = dir
+
+	for file, tmpl := range tool.SecretFiles {
+		content, ok, err := renderSecretFile(store, tmpl, vars)
+		if err != nil {
+			ts.cleanup()
+			return nil, err
+		}
+		if !ok {
+			log.Debug("Secret file skipped, none of its secrets are set", "tool", tool.Name, "file", file)
+			ts.skipped = append(ts.skipped, filepath.Base(file))
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, filepath.Base(file)), []byte(content), 0o600); err != nil {
+			ts.cleanup()
+			return nil, err
+		}
+	}
+
+	return ts, nil
+}
+
+// renderSecretFile expands {{secret.NAME}} and ordinary variables in a file
+// template, line by line. ok is false when the template names secrets but
+// every line naming one was dropped, leaving nothing worth writing.
+func renderSecretFile(store *secrets.Store, tmpl string, vars map[string]string) (content string, ok bool, err error) {
+	all := maps.Clone(vars)
+	if all == nil {
+		all = make(map[string]string)
+	}
+	for _, name := range store.Names() {
+		all["secret."+name], _ = store.Get(name)
+	}
+
+	var b strings.Builder
+	var secretLines, kept int
+lines:
+	for _, line := range strings.SplitAfter(tmpl, "\n") {
+		hasSecret := false
+		for _, m := range varRe.FindAllStringSubmatch(line, -1) {
+			if !strings.HasPrefix(m[1], "secret.") {
+				continue
+			}
+			if !hasSecret {
+				hasSecret = true
+				secretLines++
+			}
+			if _, ok := all[m[1]]; !ok {
+				continue lines
+			}
+		}
+		if hasSecret {
+			kept++
+		}
+
+		out, err := expandVars(line, all, nil)
+		if err != nil {
+			return "", false, err
+		}
+		b.WriteString(out)
+	}
+	return b.String(), secretLines == 0 || kept > 0, nil
+}
+
+// withoutSkipped drops the args that name a secret file prepareSecrets did
+// not write, with the flag before each, so the tool keeps its own
+// configuration rather than reading an empty one. Shell-mode args hold the
+// whole command line and are returned as they are.
+func (ts *toolSecrets) withoutSkipped(tool *Tool, args []string) []string {
+	if len(ts.skipped) == 0 || tool.Shell {
+		return args
+	}
+	var out []string
+	for _, a := range args {
+		if !ts.namesSkipped(a) {
+			out = append(out, a)
+			continue
+		}
+		if n := len(out); n > 0 && strings.HasPrefix(out[n-1], "-") && !strings.HasPrefix(a, "-") {
+			out = out[:n-1]
+		}
+	}
+	return out
+}
+
+func (ts *toolSecrets) namesSkipped(arg string) bool {
+	for _, file := range ts.skipped {
+		if strings.Contains(arg, "{{secret_dir}}/"+file) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactArgs returns a copy of args with secret values hidden, for writing
+// to disk.
+func redactArgs(redact *strings.Replacer, args []string) []string {
+	out := make([]string, len(args))
+	for i, a := range args {
+		out[i] = redact.Replace(a)
+	}
+	return out
+}
+
+// redactVars returns a copy of vars with secret values hidden, for writing
+// to disk.
+func redactVars(redact *strings.Replacer, vars map[string]string) map[string]string {
+	if vars == nil {
+		return nil
+	}
+	out := make(map[string]string, len(vars))
+	for k, v := range vars {
+		out[k] = redact.Replace(v)
+	}
+	return out
+}
+
+// redacted hides secret values in s before the run writes it to disk.
+func (df *DataFlow) redacted(s string) string {
+	if df.redact == nil {
+		return s
+	}
+	return df.redact.Replace(s)
+}
+
+// cleanup removes the rendered secret files.
+func (ts *toolSecrets) cleanup() {
+	if ts.dir != "" {
+		os.RemoveAll(ts.dir)
+	}
+}
@@ -0,0 +1,101 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/MKlolbullen/termaid/internal/secrets"
+)
+
+func TestPrepareSecrets(t *testing.T) {
+	t.Setenv(secrets.PassphraseEnv, "correct horse")
+	store, err := secrets.Open(filepath.Join(t.TempDir(), "secrets.enc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("shodan", "SHODAN-KEY-123"); err != nil {
+		t.Fatal(err)
+	}
+
+	tool := &Tool{
+		Name:      "subfinder",
+		SecretEnv: map[string]string{"SHODAN_API_KEY": "shodan", "CENSYS_API_KEY": "censys"},
+		SecretFiles: map[string]string{
+			"../provider-config.yaml": "shodan: [{{secret.shodan}}]\ncensys: [{{secret.censys}}]\ntarget: {{target}}\n",
+		},
+	}
+	ts, err := prepareSecrets(store, tool, map[string]string{"target": "example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.cleanup()
+
+	// missing secrets are left out rather than failing the tool
+	if !slices.Equal(ts.env, []string{"SHODAN_API_KEY=SHODAN-KEY-123"}) {
+		t.Errorf("env = %q", ts.env)
+	}
+
+	// file names cannot leave the private directory
+	file := filepath.Join(ts.dir, "provider-config.yaml")
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "shodan: [SHODAN-KEY-123]\ntarget: example.com\n"; got != want {
+		t.Errorf("rendered file = %q, want %q", got, want)
+	}
+	if fi, err := os.Stat(file); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("rendered file mode = %v, %v; want 0600", fi.Mode().Perm(), err)
+	}
+	if len(ts.skipped) != 0 {
+		t.Errorf("skipped %q although shodan is set", ts.skipped)
+	}
+	if got := ts.redact.Replace("key SHODAN-KEY-123"); got != "key [REDACTED]" {
+		t.Errorf("redact = %q", got)
+	}
+
+	ts.cleanup()
+	if _, err := os.Stat(ts.dir); !os.IsNotExist(err) {
+		t.Errorf("cleanup left %s: %v", ts.dir, err)
+	}
+}
+
+func TestPrepareSecretsNoneSet(t *testing.T) {
+	t.Setenv(secrets.PassphraseEnv, "correct horse")
+	store, err := secrets.Open(filepath.Join(t.TempDir(), "secrets.enc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tool := &Tool{
+		Name: "subfinder",
+		Args: []string{"-silent", "-pc", "{{secret_dir}}/provider-config.yaml", "-d", "{{target}}"},
+		SecretFiles: map[string]string{
+			"provider-config.yaml": "shodan: [\"{{secret.shodan}}\"]\nchaos: [\"{{secret.chaos}}\"]\n",
+			"resolvers.txt":        "1.1.1.1\n",
+		},
+	}
+	ts, err := prepareSecrets(store, tool, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.cleanup()
+
+	// an empty provider config would hide the user's own, so none is written
+	if _, err := os.Stat(filepath.Join(ts.dir, "provider-config.yaml")); !os.IsNotExist(err) {
+		t.Errorf("provider-config.yaml written without any secret: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(ts.dir, "resolvers.txt")); err != nil {
+		t.Errorf("a file without secrets was not written: %v", err)
+	}
+	if got, want := ts.withoutSkipped(tool, tool.Args), []string{"-silent", "-d", "{{target}}"}; !slices.Equal(got, want) {
+		t.Errorf("args = %q, want %q", got, want)
+	}
+
+	tool.Shell = true
+	if got := ts.withoutSkipped(tool, tool.Args); !slices.Equal(got, tool.Args) {
+		t.Errorf("shell args changed to %q", got)
+	}
+}
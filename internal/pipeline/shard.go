@@ -0,0 +1,302 @@
+package pipeline
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/MKlolbullen/termaid/internal/graph"
+)
+
+/* ─────────────────────────── Input Sharding ─────────────────────────── */
+
+// runSharded splits a node's input into chunks, runs the tool on each chunk
+// as its own sub-execution and merges the chunk outputs into one NodeOutput.
+// Chunks are retried and cached individually, so one failed chunk costs only
+// its own lines.
+func (s *scheduler) runSharded(
+	ctx context.Context,
+	node *graph.Node,
+	tool *Tool,
+	catName, catDir string,
+	inputPath string,
+	env toolEnv,
+) error {
+
+	startTime := time.Now()
+	shardDir := filepath.Join(catDir, fmt.Sprintf("%s-%d.shards", tool.Name, startTime.Unix()))
+
+	split, err := newSplitter(inputPath, shardDir, node.Shard)
+	if err != nil {
+		err = fmt.Errorf("failed to shard input: %w", err)
+		s.fail(tool.Name, tool.Command, catName, err)
+		return err
+	}
+	defer split.Close()
+
+	s.out <- Status{Type: StatusStart, Category: catName, Tool: tool.Name}
+
+	chunks := split.count
+	results := make([]toolResult, chunks)
+	outputs := make([]string, chunks)
+	ran := make([]bool, chunks)
+	keys := limitKeys(node)
+	for i := range outputs {
+		outputs[i] = filepath.Join(shardDir, fmt.Sprintf("output-%04d.txt", i+1))
+	}
+
+	// chunk files are written as workers take them, so the input is never
+	// held in memory and at most one chunk waits ahead of the workers
+	type shardJob struct {
+		i     int
+		input string
+	}
+	jobs := make(chan shardJob)
+	var splitErr error
+	go func() {
+		defer close(jobs)
+		for i := range chunks {
+			input, err := split.next(i)
+			if err != nil {
+				splitErr = fmt.Errorf("failed to shard input: %w", err)
+				return
+			}
+			select {
+			case jobs <- shardJob{i, input}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	run := func(i int, input string) toolResult {
+		// chunks need their own name so pause and resume can reach each
+		// process; {{node_id}} stays the node's
+		chunkTool := *tool
+		chunkTool.Name = fmt.Sprintf("%s#%d", tool.Name, i+1)
+		chunkEnv := env
+		chunkEnv.node, chunkEnv.shard, chunkEnv.shards = tool.Name, i+1, chunks
+
+		release, ok := s.slot(ctx, keys)
+		if !ok {
+			return toolResult{exitCode: 1, err: ctx.Err()}
+		}
+		defer release()
+		return execTool(ctx, &chunkTool, catName, catDir, input, outputs[i], chunkEnv,
+			func(st Status) bool {
+				// per-chunk lifecycle is summarised by StatusShard below
+				if st.Type != StatusOutput && st.Type != StatusProgress {
+					return true
+				}
+				st.Category, st.Tool, st.Shard, st.Shards = catName, tool.Name, i+1, chunks
+				return send(s.out, st)
+			})
+	}
+
+	// no more workers than the node's limits would ever let run at once
+	var wg sync.WaitGroup
+	for range min(s.limits.width(keys), chunks) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				results[job.i], ran[job.i] = run(job.i, job.input), true
+				s.out <- Status{
+					Type:     StatusShard,
+					Category: catName,
+					Tool:     tool.Name,
+					Err:      results[job.i].err,
+					Shard:    job.i + 1,
+					Shards:   chunks,
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// chunks never handed out failed along with the split or the run
+	for i := range results {
+		if !ran[i] {
+			results[i] = toolResult{exitCode: 1, err: cmp.Or(splitErr, ctx.Err())}
+		}
+	}
+
+	// merge whatever the chunks produced, failed ones included
+	outputFile := filepath.Join(catDir, fmt.Sprintf("%s-%d.txt", tool.Name, startTime.Unix()))
+	if err := concatFiles(outputFile, outputs); err != nil {
+		log.Debug("Failed to merge shard outputs", "node", tool.Name, "error", err)
+	}
+
+	var errorLog strings.Builder
+	var exitCode, attempts, failed int
+	var timedOut bool
+	var firstErr error
+	var term Termination
+
+	for i, r := range results {
+		attempts += r.attempts
+		timedOut = timedOut || r.timedOut
+		if r.errorLog != "" {
+			fmt.Fprintf(&errorLog, "--- shard %d/%d ---\n%s", i+1, chunks, r.errorLog)
+		}
+		if r.err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = r.err
+				exitCode = max(r.exitCode, 1)
+				term = r.termination
+			}
+		}
+	}
+
+	err = nil
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d shards failed: %w", failed, chunks, firstErr)
+		s.out <- Status{Type: StatusError, Category: catName, Tool: tool.Name, Err: err}
+	} else {
+		s.out <- Status{Type: StatusFinish, Category: catName, Tool: tool.Name}
+	}
+
+	env.df.recordOutput(tool.Name, tool.Command, startTime, time.Now(), exitCode, failed == 0, []string{outputFile}, errorLog.String())
+	env.df.AnnotateNode(tool.Name, map[string]string{
+		"shards":        strconv.Itoa(chunks),
+		"shards_failed": strconv.Itoa(failed),
+		"attempts":      strconv.Itoa(attempts),
+		"timed_out":     strconv.FormatBool(timedOut),
+	})
+	if term != "" {
+		env.df.RecordTermination(tool.Name, term)
+	}
+
+	return err
+}
+
+// maxShards caps the chunk count of a sharded node; smaller chunks would
+// only add processes.
+const maxShards = 1000
+
+// splitter streams the non-empty lines of a node's input into count chunk
+// files under dir, one chunk per call to next.
+type splitter struct {
+	file    *os.File
+	scanner *bufio.Scanner
+	dir     string
+	size    int // lines per chunk
+	count   int
+}
+
+// newSplitter sizes the chunks of inputPath for spec. It reads the input
+// once to count its lines; the chunks are written by next.
+func newSplitter(inputPath, dir string, spec graph.ShardSpec) (*splitter, error) {
+	total, err := countLines(inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	size := spec.Lines
+	if size <= 0 {
+		size = (total + spec.Chunks - 1) / spec.Chunks
+	}
+	size = max(size, (total+maxShards-1)/maxShards, 1)
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &splitter{
+		file:    file,
+		scanner: bufio.NewScanner(file),
+		dir:     dir,
+		size:    size,
+		count:   max((total+size-1)/size, 1), // an empty input still runs the tool once
+	}, nil
+}
+
+// next writes the following chunk, number i from 0, and returns its path.
+func (sp *splitter) next(i int) (string, error) {
+	path := filepath.Join(sp.dir, fmt.Sprintf("input-%04d.txt", i+1))
+	out, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+
+	w := bufio.NewWriter(out)
+	for n := 0; n < sp.size && sp.scanner.Scan(); {
+		if line := strings.TrimSpace(sp.scanner.Text()); line != "" {
+			w.WriteString(line)
+			w.WriteByte('\n')
+			n++
+		}
+	}
+	if err := sp.scanner.Err(); err != nil {
+		out.Close()
+		return "", err
+	}
+	if err := w.Flush(); err != nil {
+		out.Close()
+		return "", err
+	}
+
+	return path, out.Close()
+}
+
+// Close releases the input file.
+func (sp *splitter) Close() error {
+	return sp.file.Close()
+}
+
+// countLines returns the number of non-empty lines in path.
+func countLines(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var n int
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) != "" {
+			n++
+		}
+	}
+	return n, scanner.Err()
+}
+
+// concatFiles writes the contents of srcs, in order, to dst, ending each one
+// with a newline. Missing sources are skipped.
+func concatFiles(dst string, srcs []string) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	for _, src := range srcs {
+		data, err := os.ReadFile(src)
+		if err != nil || len(data) == 0 {
+			continue
+		}
+		if data[len(data)-1] != '\n' {
+			data = append(data, '\n')
+		}
+		if _, err := out.Write(data); err != nil {
+			out.Close()
+			return err
+		}
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,144 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/MKlolbullen/termaid/internal/graph"
+)
+
+func TestSplitInput(t *testing.T) {
+	tests := []struct {
+		input string
+		spec  graph.ShardSpec
+		want  []string // chunk contents
+	}{
+		{"a\nb\nc\nd\ne\n", graph.ShardSpec{Chunks: 2}, []string{"a\nb\nc\n", "d\ne\n"}},
+		{"a\nb\nc\nd\ne\n", graph.ShardSpec{Lines: 2}, []string{"a\nb\n", "c\nd\n", "e\n"}},
+		{"a\nb\n", graph.ShardSpec{Chunks: 5}, []string{"a\n", "b\n"}},
+		{"a\nb\nc\n", graph.ShardSpec{Chunks: 3, Lines: 2}, []string{"a\nb\n", "c\n"}}, // lines wins
+		{" a \n\n\nb", graph.ShardSpec{Lines: 1}, []string{"a\n", "b\n"}},
+		{"", graph.ShardSpec{Chunks: 4}, []string{""}}, // the tool still runs once
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		input := filepath.Join(dir, "input.txt")
+		if err := os.WriteFile(input, []byte(tt.input), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if got := splitAll(t, input, tt.spec); !slices.Equal(got, tt.want) {
+			t.Errorf("split %q by %+v into %q, want %q", tt.input, tt.spec, got, tt.want)
+		}
+	}
+}
+
+// splitAll splits input by spec and returns the contents of every chunk.
+func splitAll(t *testing.T, input string, spec graph.ShardSpec) []string {
+	t.Helper()
+	split, err := newSplitter(input, filepath.Join(t.TempDir(), "shards"), spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer split.Close()
+
+	var chunks []string
+	for i := range split.count {
+		path, err := split.next(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, string(data))
+	}
+	return chunks
+}
+
+func TestSplitInputMaxShards(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(input, []byte(strings.Repeat("x\n", 2*maxShards+1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	chunks := splitAll(t, input, graph.ShardSpec{Lines: 1})
+	if len(chunks) > maxShards {
+		t.Errorf("split into %d chunks, want at most %d", len(chunks), maxShards)
+	}
+	if got := strings.Count(strings.Join(chunks, ""), "x"); got != 2*maxShards+1 {
+		t.Errorf("chunks hold %d lines, want %d", got, 2*maxShards+1)
+	}
+}
+
+func TestConcatFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	srcs := []string{
+		write("1", "a\nb\n"),
+		write("2", "c"), // no trailing newline
+		write("3", ""),
+		filepath.Join(dir, "missing"),
+		write("4", "d\n"),
+	}
+	dst := filepath.Join(dir, "merged")
+	if err := concatFiles(dst, srcs); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "a\nb\nc\nd\n" {
+		t.Errorf("merged %q", data)
+	}
+}
+
+func TestSchedulerShards(t *testing.T) {
+	g := testDAG(t,
+		emits(t, "hosts", []string{"input"}, "a.example.com", "bad.example.com", "c.example.com"),
+		// fails on the chunk holding the bad host
+		awk(t, "probe", []string{"hosts"}, `/bad/ { exit 1 } { print }`),
+	)
+	g.Nodes["probe"].Shard = graph.ShardSpec{Lines: 1}
+
+	df, statuses, err := runTestDAG(t, t.TempDir(), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var shards []int
+	var final Status
+	for _, st := range statuses {
+		switch {
+		case st.Tool != "probe":
+		case st.Type == StatusShard:
+			shards = append(shards, st.Shard)
+			if st.Shards != 3 {
+				t.Errorf("chunk %d reported %d shards, want 3", st.Shard, st.Shards)
+			}
+		case st.Type != StatusStart:
+			final = st
+		}
+	}
+	slices.Sort(shards)
+	if !slices.Equal(shards, []int{1, 2, 3}) {
+		t.Errorf("chunks reported %v, want each of 1-3 once", shards)
+	}
+	if final.Type != StatusError || final.Err == nil || !strings.Contains(final.Err.Error(), "1 of 3 shards failed") {
+		t.Errorf("probe ended with %v %v, want 1 of 3 shards failed", final.Type, final.Err)
+	}
+
+	// the surviving chunks are merged in input order
+	if got := readLines(t, df, "probe"); !slices.Equal(got, []string{"a.example.com", "c.example.com"}) {
+		t.Errorf("probe output %q", got)
+	}
+	out := df.NodeOutputs["probe"]
+	if out.ExitCode == 0 || out.Metadata["shards"] != "3" || out.Metadata["shards_failed"] != "1" {
+		t.Errorf("probe recorded exit %d, metadata %v", out.ExitCode, out.Metadata)
+	}
+}
@@ -0,0 +1,220 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/MKlolbullen/termaid/internal/graph"
+)
+
+/* ─────────────────────────── Multi-Target Runs ──────────────────────── */
+
+// TargetResult is how one target of a multi-target run ended.
+type TargetResult struct {
+	Target string    `json:"target"`
+	RunID  string    `json:"run_id,omitempty"`
+	Status RunStatus `json:"status,omitempty"` // empty while the target is queued or running
+	Error  string    `json:"error,omitempty"`
+}
+
+// Batch is the manifest of a multi-target run, kept next to the run
+// directories as batch-<unix>-<random>.json.
+type Batch struct {
+	Started      time.Time      `json:"started"`
+	Finished     time.Time      `json:"finished,omitzero"`
+	WorkflowPath string         `json:"workflow_path,omitempty"`
+	Targets      []TargetResult `json:"targets"`
+}
+
+// RunTargets runs g once per target. Every target gets its own run directory
+// and GlobalState, exactly as if RunDAG had been called for it; up to
+// opts.TargetConcurrency targets run at once. Concurrency and tool limits are
+// shared, so a tool capped at one instance runs once across all targets.
+// Every event on out carries the target and run ID it belongs to.
+func RunTargets(
+	ctx context.Context,
+	targets []string,
+	workdir string,
+	g *graph.DAG,
+	opts RunOptions,
+	out chan<- Status,
+) ([]TargetResult, error) {
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets given")
+	}
+	if err := os.MkdirAll(workdir, 0o755); err != nil {
+		return nil, err
+	}
+
+	opts.limits = newLimiter(opts.Concurrency, runLimits(g, opts.ToolLimits))
+
+	batch := &Batch{Started: time.Now(), WorkflowPath: opts.WorkflowPath}
+	for _, t := range targets {
+		batch.Targets = append(batch.Targets, TargetResult{Target: t})
+	}
+	// CreateTemp picks a name no other batch holds, even one started in the
+	// same second
+	f, err := os.CreateTemp(workdir, fmt.Sprintf("batch-%d-*.json", batch.Started.Unix()))
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	manifest := f.Name()
+
+	var mu sync.Mutex // guards batch
+	save := func() {
+		data, err := json.MarshalIndent(batch, "", "  ")
+		if err == nil {
+			err = os.WriteFile(manifest, data, 0o644)
+		}
+		if err != nil {
+			log.Debug("Failed to write batch manifest", "error", err)
+		}
+	}
+	save()
+
+	sem := make(chan struct{}, max(opts.TargetConcurrency, 1))
+	var wg sync.WaitGroup
+
+	for i, target := range targets {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			res := runTarget(ctx, target, workdir, g, opts, out)
+
+			mu.Lock()
+			batch.Targets[i] = res
+			save()
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	batch.Finished = time.Now()
+	save()
+
+	if err := ctx.Err(); err != nil {
+		return batch.Targets, err
+	}
+
+	failed := 0
+	for _, r := range batch.Targets {
+		if r.Status == RunFailed || r.Status == RunAborted {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return batch.Targets, fmt.Errorf("%d of %d targets failed", failed, len(targets))
+	}
+	return batch.Targets, nil
+}
+
+// runTarget runs the workflow for one target, labelling its events.
+func runTarget(
+	ctx context.Context,
+	target string,
+	workdir string,
+	g *graph.DAG,
+	opts RunOptions,
+	out chan<- Status,
+) TargetResult {
+
+	res := TargetResult{Target: target}
+
+	dataFlow, err := newRun(workdir, target, g, opts)
+	if err != nil {
+		res.Status, res.Error = RunFailed, err.Error()
+		out <- Status{Type: StatusTargetDone, Target: target, Err: err, Result: res.Status}
+		return res
+	}
+	res.RunID = dataFlow.RunID
+
+	out <- Status{Type: StatusTargetStart, Target: target, RunID: res.RunID}
+
+	ch := make(chan Status, 64)
+	forwarded := make(chan struct{})
+	go func() {
+		defer close(forwarded)
+		for st := range ch {
+			st.Target, st.RunID = target, res.RunID
+			out <- st
+		}
+	}()
+
+	err = runDataFlow(ctx, dataFlow, g, opts, ch)
+	close(ch)
+	<-forwarded
+
+	res.Status = dataFlow.RunStatus()
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	out <- Status{Type: StatusTargetDone, Target: target, RunID: res.RunID, Err: err, Result: res.Status}
+	return res
+}
+
+// ParseTargets splits a typed-in target list on commas, whitespace and
+// newlines. Blank entries and #-comments are dropped, as are duplicates. A #
+// starts a comment only at the start of a line or after whitespace, so URL
+// fragments such as https://x/#/admin survive.
+func ParseTargets(text string) []string {
+	var targets []string
+	seen := make(map[string]bool)
+
+	for _, line := range strings.Split(text, "\n") {
+		line = stripComment(line)
+		for _, t := range strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\r'
+		}) {
+			if !seen[t] {
+				seen[t] = true
+				targets = append(targets, t)
+			}
+		}
+	}
+
+	return targets
+}
+
+// stripComment cuts line at the first # that opens a comment.
+func stripComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		if line[i] == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// LoadTargets reads a target list from a file, one or more per line.
+func LoadTargets(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := ParseTargets(string(data))
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%s lists no targets", path)
+	}
+	return targets, nil
+}
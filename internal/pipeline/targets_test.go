@@ -0,0 +1,112 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/MKlolbullen/termaid/internal/graph"
+)
+
+func TestParseTargets(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"commas and spaces", "a.com, b.com c.com", []string{"a.com", "b.com", "c.com"}},
+		{"lines and tabs", "a.com\r\n\tb.com\n\n", []string{"a.com", "b.com"}},
+		{"duplicates", "a.com\na.com,b.com", []string{"a.com", "b.com"}},
+		{"comment line", "# scope\na.com", []string{"a.com"}},
+		{"trailing comment", "a.com # prod\nb.com\t#staging", []string{"a.com", "b.com"}},
+		{"url fragment", "https://x.com/#/admin", []string{"https://x.com/#/admin"}},
+		{"only comments", "# nothing\n  # here", nil},
+	}
+	for _, tt := range tests {
+		if got := ParseTargets(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: ParseTargets(%q) = %q, want %q", tt.name, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestRunTargets(t *testing.T) {
+	// the seed input holds the target, so a fails for every target but one
+	a := awk(t, "a", []string{"input"}, `/good/ { print; next } { exit 1 }`)
+	a.onError = graph.OnErrorRequired
+	g := testDAG(t, a)
+	workdir := t.TempDir()
+	opts := RunOptions{Concurrency: 2, TargetConcurrency: 2, NoCache: true}
+
+	var results []TargetResult
+	statuses, err := collect(func(out chan<- Status) error {
+		var err error
+		results, err = RunTargets(context.Background(), []string{"good.test", "bad.test"}, workdir, g, opts, out)
+		return err
+	})
+	if err == nil || err.Error() != "1 of 2 targets failed" {
+		t.Errorf("RunTargets error = %v, want 1 of 2 targets failed", err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	if r := results[0]; r.Target != "good.test" || r.Status != RunSucceeded || r.Error != "" {
+		t.Errorf("good.test = %+v", r)
+	}
+	if r := results[1]; r.Target != "bad.test" || r.Status != RunFailed {
+		t.Errorf("bad.test = %+v", r)
+	}
+	if results[0].RunID == "" || results[0].RunID == results[1].RunID {
+		t.Errorf("run IDs %q and %q are not distinct", results[0].RunID, results[1].RunID)
+	}
+
+	runIDs := map[string]string{results[0].Target: results[0].RunID, results[1].Target: results[1].RunID}
+	for _, st := range statuses {
+		if runIDs[st.Target] != st.RunID {
+			t.Errorf("%v event for %q carries run %q", st.Type, st.Target, st.RunID)
+		}
+	}
+
+	// a second batch started in the same second keeps its own manifest
+	if _, err := collect(func(out chan<- Status) error {
+		_, err := RunTargets(context.Background(), []string{"good.test"}, workdir, g, opts, out)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	manifests, err := filepath.Glob(filepath.Join(workdir, "batch-*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifests) != 2 {
+		t.Fatalf("found manifests %q, want 2", manifests)
+	}
+	for _, m := range manifests {
+		data, err := os.ReadFile(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var batch Batch
+		if err := json.Unmarshal(data, &batch); err != nil {
+			t.Fatal(err)
+		}
+		if batch.Finished.IsZero() {
+			t.Errorf("%s was never marked finished", m)
+		}
+		for _, r := range batch.Targets {
+			if r.Status == "" {
+				t.Errorf("%s leaves %s without a status", m, r.Target)
+			}
+		}
+	}
+}
+
+func TestRunTargetsEmpty(t *testing.T) {
+	g := testDAG(t, copies("a", "input"))
+	if _, err := RunTargets(context.Background(), nil, t.TempDir(), g, RunOptions{}, make(chan Status)); err == nil {
+		t.Error("RunTargets ran without targets")
+	}
+}
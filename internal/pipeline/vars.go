@@ -0,0 +1,190 @@
+package pipeline
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+/* ─────────────────────────── Variables ──────────────────────────────── */
+
+// varRe matches a {{name}} placeholder. Names may contain dots, as in
+// {{env.HOME}}, which reads the environment.
+var varRe = regexp.MustCompile(`\{\{([A-Za-z_][\w.\-]*)\}\}`)
+
+// legacyVarRe matches the $(name) placeholders older catalogs use.
+var legacyVarRe = regexp.MustCompile(`\$\(([A-Za-z_]\w*)\)`)
+
+// builtinVars are set by termaid for every node and cannot be redefined.
+var builtinVars = []string{"input", "output", "node_id", "secret_dir", "shard", "shards", "target", "domain", "run_id", "run_dir", "work_dir"}
+
+// wordlistsEnv overrides where {{wordlists}} points by default.
+const wordlistsEnv = "TERMAID_WORDLISTS"
+
+// runVars resolves the variables shared by every node of a run. Workflow
+// defaults override the built-in {{wordlists}}, and run-time overrides
+// override both. Values may refer to built-ins, {{wordlists}} and {{env.*}},
+// but not to each other.
+func runVars(df *DataFlow, defaults, overrides map[string]string) (map[string]string, error) {
+	base := map[string]string{
+		"target":    df.GlobalState.Domain,
+		"domain":    df.GlobalState.Domain,
+		"run_id":    df.RunID,
+		"run_dir":   filepath.Join(df.WorkDir, df.RunID),
+		"work_dir":  df.WorkDir,
+		"wordlists": defaultWordlists(),
+	}
+
+	merged := maps.Clone(defaults)
+	if merged == nil {
+		merged = make(map[string]string)
+	}
+	maps.Copy(merged, overrides)
+
+	for name := range merged {
+		if slices.Contains(builtinVars, name) {
+			return nil, fmt.Errorf("variable %q is built in and cannot be set", name)
+		}
+		if strings.HasPrefix(name, "env.") {
+			return nil, fmt.Errorf("variable %q: names starting with env. read the environment", name)
+		}
+	}
+
+	// {{wordlists}} first, so the other values see the one in effect
+	if v, ok := merged["wordlists"]; ok {
+		v, err := expandVars(v, base, nil)
+		if err != nil {
+			return nil, fmt.Errorf("variable wordlists: %w", err)
+		}
+		base["wordlists"] = expandHome(v)
+	}
+
+	vars := maps.Clone(base)
+	names := make([]string, 0, len(merged))
+	for name := range merged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == "wordlists" {
+			continue
+		}
+		v, err := expandVars(merged[name], base, nil)
+		if err != nil {
+			return nil, fmt.Errorf("variable %s: %w", name, err)
+		}
+		vars[name] = v
+	}
+
+	return vars, nil
+}
+
+// nodeVars adds the per-node built-ins to the run's variables. {{secret_dir}}
+// stays empty until the node's secret files are written, {{shard}} and
+// {{shards}} unless the node is sharded.
+func nodeVars(vars map[string]string, nodeID, input, output string) map[string]string {
+	v := maps.Clone(vars)
+	if v == nil {
+		v = make(map[string]string)
+	}
+	v["node_id"], v["input"], v["output"] = nodeID, input, output
+	v["secret_dir"], v["shard"], v["shards"] = "", "", ""
+	return v
+}
+
+// expandVars replaces every {{name}} in s, passing each value through quote
+// (nil leaves values as they are). Any name that is neither defined nor a set
+// environment variable is an error.
+func expandVars(s string, vars map[string]string, quote func(string) string) (string, error) {
+	var missing []string
+	out := varRe.ReplaceAllStringFunc(s, func(m string) string {
+		name := varRe.FindStringSubmatch(m)[1]
+		v, ok := lookupVar(name, vars)
+		if !ok {
+			if !slices.Contains(missing, name) {
+				missing = append(missing, name)
+			}
+			return m
+		}
+		if quote != nil {
+			v = quote(v)
+		}
+		return v
+	})
+
+	if len(missing) > 0 {
+		return "", undefinedVars(missing)
+	}
+	return out, nil
+}
+
+func lookupVar(name string, vars map[string]string) (string, bool) {
+	if env, ok := strings.CutPrefix(name, "env."); ok {
+		return os.LookupEnv(env)
+	}
+	v, ok := vars[name]
+	return v, ok
+}
+
+func undefinedVars(names []string) error {
+	refs := make([]string, len(names))
+	for i, n := range names {
+		refs[i] = "{{" + n + "}}"
+	}
+	if strings.HasPrefix(names[0], "env.") {
+		return fmt.Errorf("undefined variable %s: environment variable %s is not set",
+			refs[0], strings.TrimPrefix(names[0], "env."))
+	}
+	return fmt.Errorf("undefined variable %s (define it under \"variables\" in the workflow or pass --var %s=…)",
+		strings.Join(refs, ", "), names[0])
+}
+
+// usesVar reports whether any of args refers to {{name}}.
+func usesVar(args []string, name string) bool {
+	for _, a := range args {
+		for _, m := range varRe.FindAllStringSubmatch(a, -1) {
+			if m[1] == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NormalizePlaceholders rewrites the $(target) and $(target_file)
+// placeholders of older catalogs to {{target}} and {{input}}.
+func NormalizePlaceholders(s string) string {
+	return legacyVarRe.ReplaceAllStringFunc(s, func(m string) string {
+		name := legacyVarRe.FindStringSubmatch(m)[1]
+		if name == "target_file" {
+			name = "input"
+		}
+		return "{{" + name + "}}"
+	})
+}
+
+func defaultWordlists() string {
+	if dir := os.Getenv(wordlistsEnv); dir != "" {
+		return expandHome(dir)
+	}
+	return expandHome("~/.local/share/termaid/wordlists")
+}
+
+// expandHome resolves a leading ~/ to the user's home directory.
+func expandHome(path string) string {
+	rest, ok := strings.CutPrefix(path, "~/")
+	if !ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, rest)
+}
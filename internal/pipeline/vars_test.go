@@ -0,0 +1,122 @@
+package pipeline
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandVars(t *testing.T) {
+	t.Setenv("TERMAID_TEST_TOKEN", "s3cret")
+	vars := map[string]string{"target": "example.com", "rate": "100", "empty": ""}
+
+	tests := []struct {
+		in, want string
+		quote    func(string) string
+		err      string
+	}{
+		{in: "-u https://{{target}}/ -rate {{rate}}", want: "-u https://example.com/ -rate 100"},
+		{in: "{{target}}{{target}}", want: "example.comexample.com"},
+		{in: "-H 'Authorization: {{env.TERMAID_TEST_TOKEN}}'", want: "-H 'Authorization: s3cret'"},
+		{in: "x{{empty}}y", want: "xy"},
+		{in: "{{ target }} and {{}} stay", want: "{{ target }} and {{}} stay"},
+		{in: "echo {{target}}", want: "echo 'example.com'", quote: shellQuote},
+		{in: "{{nope}} {{also_nope}} {{nope}}", err: "{{nope}}, {{also_nope}}"},
+		{in: "{{env.TERMAID_TEST_UNSET}}", err: "TERMAID_TEST_UNSET is not set"},
+	}
+	for _, tt := range tests {
+		got, err := expandVars(tt.in, vars, tt.quote)
+		switch {
+		case tt.err != "":
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expandVars(%q) error = %v, want %q", tt.in, err, tt.err)
+			}
+		case err != nil:
+			t.Errorf("expandVars(%q): %v", tt.in, err)
+		case got != tt.want:
+			t.Errorf("expandVars(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRunVars(t *testing.T) {
+	t.Setenv(wordlistsEnv, "/opt/lists")
+	df, err := NewDataFlow(t.TempDir(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defaults := map[string]string{"rate": "50", "words": "{{wordlists}}/common.txt", "host": "api.{{target}}"}
+	vars, err := runVars(df, defaults, map[string]string{"rate": "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"rate":    "10", // run-time override beats the workflow default
+		"words":   "/opt/lists/common.txt",
+		"host":    "api.example.com",
+		"target":  "example.com",
+		"run_dir": filepath.Join(df.WorkDir, df.RunID),
+	}
+	for name, v := range want {
+		if vars[name] != v {
+			t.Errorf("{{%s}} = %q, want %q", name, vars[name], v)
+		}
+	}
+
+	// a workflow may move {{wordlists}}, and other values follow it
+	vars, err = runVars(df, map[string]string{"wordlists": "/srv/lists", "words": "{{wordlists}}/a.txt"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars["words"] != "/srv/lists/a.txt" {
+		t.Errorf("{{words}} = %q after redefining wordlists", vars["words"])
+	}
+
+	for _, bad := range []map[string]string{
+		{"target": "evil.com"},
+		{"env.HOME": "/tmp"},
+		{"a": "{{b}}", "b": "x"}, // values cannot refer to each other
+	} {
+		if _, err := runVars(df, bad, nil); err == nil {
+			t.Errorf("runVars(%v) succeeded", bad)
+		}
+	}
+}
+
+func TestChunkVars(t *testing.T) {
+	tool := &Tool{Name: "httpx#2"}
+	env := toolEnv{vars: map[string]string{"target": "example.com"}, node: "httpx", shard: 2, shards: 4}
+
+	v := env.nodeVars(tool, "in.txt", "out.txt")
+	if v["node_id"] != "httpx" || v["shard"] != "2" || v["shards"] != "4" {
+		t.Errorf("chunk vars = node_id %q, shard %q/%q", v["node_id"], v["shard"], v["shards"])
+	}
+
+	v = toolEnv{}.nodeVars(&Tool{Name: "httpx"}, "in.txt", "out.txt")
+	if v["node_id"] != "httpx" || v["shard"] != "" || v["shards"] != "" {
+		t.Errorf("unsharded vars = node_id %q, shard %q/%q", v["node_id"], v["shard"], v["shards"])
+	}
+}
+
+func TestNormalizePlaceholders(t *testing.T) {
+	in := "-l $(target_file) -u https://$(target)/ -o $(output) $(1bad)"
+	want := "-l {{input}} -u https://{{target}}/ -o {{output}} $(1bad)"
+	if got := NormalizePlaceholders(in); got != want {
+		t.Errorf("NormalizePlaceholders = %q, want %q", got, want)
+	}
+}
+
+func TestUndefinedVarStopsRun(t *testing.T) {
+	g := testDAG(t,
+		copies("a", "input"),
+		testNode{id: "b", tool: "echo", args: "{{missing}}", parents: []string{"a"}},
+	)
+	_, statuses, err := runTestDAG(t, t.TempDir(), g)
+	if err == nil || !strings.Contains(err.Error(), "{{missing}}") {
+		t.Errorf("run error = %v, want undefined {{missing}}", err)
+	}
+	if len(events(statuses)["a"]) != 0 {
+		t.Errorf("a ran before the undefined variable was reported")
+	}
+}
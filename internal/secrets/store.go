@@ -0,0 +1,240 @@
+// Package secrets keeps tool API keys in an encrypted file on the local
+// machine. Values are sealed with AES-256-GCM under a key derived from
+// $TERMAID_SECRETS_PASSPHRASE, which writing the store requires: a key kept
+// next to the file would protect nothing from whoever can read it.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// PassphraseEnv, when set, is the passphrase the store key is derived from.
+	PassphraseEnv = "TERMAID_SECRETS_PASSPHRASE"
+
+	storeFileName   = "secrets.enc"
+	kdfIterations   = 600_000
+	kdfPBKDF2SHA256 = "pbkdf2-sha256"
+
+	// MinRedactLen is the shortest value Redactor hides; shorter ones would
+	// blank out unrelated text wherever they happen to occur.
+	MinRedactLen = 6
+)
+
+// Store is a decrypted secrets file. The zero value is not usable; call Open.
+type Store struct {
+	mu     sync.RWMutex
+	path   string
+	values map[string]string
+}
+
+// sealed is the on-disk form of a store.
+type sealed struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"` // how the key was derived
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// DefaultPath returns ~/.config/termaid/secrets.enc (or the platform's
+// equivalent config directory).
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "termaid", storeFileName), nil
+}
+
+// Open decrypts the store at path. A missing file is an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, values: make(map[string]string)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file sealed
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("secrets file %s is corrupt: %w", path, err)
+	}
+
+	key, err := s.key(file.KDF, file.Salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt %s: wrong %s", path, PassphraseEnv)
+	}
+
+	if err := json.Unmarshal(plain, &s.values); err != nil {
+		return nil, fmt.Errorf("secrets file %s is corrupt: %w", path, err)
+	}
+	return s, nil
+}
+
+// Get returns the value of a secret.
+func (s *Store) Get(name string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.values[name]
+	return v, ok
+}
+
+// Names lists the stored secrets in order.
+func (s *Store) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.values))
+	for n := range s.values {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Values returns every stored value, for redaction.
+func (s *Store) Values() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	values := make([]string, 0, len(s.values))
+	for _, v := range s.values {
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Set stores a secret and writes the file.
+func (s *Store) Set(name, value string) error {
+	if name == "" || strings.ContainsAny(name, " \t\n{}") {
+		return fmt.Errorf("invalid secret name %q", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[name] = value
+	return s.save()
+}
+
+// Remove deletes a secret and writes the file.
+func (s *Store) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.values[name]; !ok {
+		return fmt.Errorf("no secret named %q", name)
+	}
+	delete(s.values, name)
+	return s.save()
+}
+
+// save seals the values under the passphrase and replaces the file
+// atomically. Callers hold s.mu.
+func (s *Store) save() error {
+	if os.Getenv(PassphraseEnv) == "" {
+		return fmt.Errorf("set %s to encrypt the secrets store", PassphraseEnv)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+
+	file := sealed{Version: 1, KDF: kdfPBKDF2SHA256, Salt: make([]byte, 16)}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return err
+	}
+
+	key, err := s.key(file.KDF, file.Salt)
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	plain, err := json.Marshal(s.values)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	file.Ciphertext = aead.Seal(nil, file.Nonce, plain, nil)
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// key derives the AES key from the passphrase and salt.
+func (s *Store) key(kdf string, salt []byte) ([]byte, error) {
+	if kdf != kdfPBKDF2SHA256 {
+		return nil, fmt.Errorf("%s uses unknown key derivation %q", s.path, kdf)
+	}
+	pass := os.Getenv(PassphraseEnv)
+	if pass == "" {
+		return nil, fmt.Errorf("%s is encrypted with a passphrase; set %s", s.path, PassphraseEnv)
+	}
+	return pbkdf2.Key(sha256.New, pass, salt, kdfIterations, 32)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Redactor replaces every stored value of at least MinRedactLen bytes in a
+// string with [REDACTED]. A nil *Store redacts nothing.
+func (s *Store) Redactor() *strings.Replacer {
+	if s == nil {
+		return strings.NewReplacer()
+	}
+
+	values := slices.DeleteFunc(s.Values(), func(v string) bool { return len(v) < MinRedactLen })
+	// longest first, so a value that contains another is replaced whole
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+
+	pairs := make([]string, 0, 2*len(values))
+	for _, v := range values {
+		pairs = append(pairs, v, "[REDACTED]")
+	}
+	return strings.NewReplacer(pairs...)
+}
@@ -0,0 +1,116 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	t.Setenv(PassphraseEnv, "correct horse")
+	path := filepath.Join(t.TempDir(), "termaid", storeFileName)
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("open missing store: %v", err)
+	}
+	if err := s.Set("shodan", "SHODAN-KEY-123"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("github", "ghp_abcdef"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("bad name", "x"); err == nil {
+		t.Error("Set accepted a name with a space")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "SHODAN-KEY-123") {
+		t.Error("store file holds a value in the clear")
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("store file mode = %v, %v; want 0600", fi.Mode().Perm(), err)
+	}
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := s.Get("shodan"); !ok || v != "SHODAN-KEY-123" {
+		t.Errorf("Get(shodan) = %q, %t", v, ok)
+	}
+	if got := s.Names(); !slices.Equal(got, []string{"github", "shodan"}) {
+		t.Errorf("Names() = %q", got)
+	}
+
+	if err := s.Remove("github"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Remove("github"); err == nil {
+		t.Error("removing a missing secret succeeded")
+	}
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Names(); !slices.Equal(got, []string{"shodan"}) {
+		t.Errorf("Names() after Remove = %q", got)
+	}
+}
+
+func TestStorePassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), storeFileName)
+
+	t.Setenv(PassphraseEnv, "")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("shodan", "SHODAN-KEY-123"); err == nil {
+		t.Fatal("Set wrote the store without a passphrase")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("a failed Set left a file behind: %v", err)
+	}
+
+	t.Setenv(PassphraseEnv, "correct horse")
+	if err := s.Set("shodan", "SHODAN-KEY-123"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(PassphraseEnv, "wrong horse")
+	if _, err := Open(path); err == nil || !strings.Contains(err.Error(), "cannot decrypt") {
+		t.Errorf("Open with the wrong passphrase = %v", err)
+	}
+
+	t.Setenv(PassphraseEnv, "")
+	if _, err := Open(path); err == nil || !strings.Contains(err.Error(), PassphraseEnv) {
+		t.Errorf("Open without a passphrase = %v", err)
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	s := &Store{values: map[string]string{
+		"short": "abc",          // under MinRedactLen, left alone
+		"token": "tok_123456",   // contained in the longer value below
+		"full":  "tok_123456_x", // replaced whole, not as token + "_x"
+		"empty": "",
+	}}
+	r := s.Redactor()
+
+	in := "key=tok_123456_x other=tok_123456 abc"
+	want := "key=[REDACTED] other=[REDACTED] abc"
+	if got := r.Replace(in); got != want {
+		t.Errorf("Replace(%q) = %q, want %q", in, got, want)
+	}
+
+	var none *Store
+	if got := none.Redactor().Replace(in); got != in {
+		t.Errorf("nil store redacted %q to %q", in, got)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -13,8 +14,10 @@ import (
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
 
 	"github.com/MKlolbullen/termaid/internal/graph"
+	"github.com/MKlolbullen/termaid/internal/pipeline"
 )
 
 /*─────────────────────── visual styles ─────────────────────────*/
@@ -40,6 +43,9 @@ var (
 		"subdomains": "12",
 		"hosts":      "6",
 		"urls":       "11",
+		"url":        "11",
+		"ports":      "5",
+		"findings":   "9",
 		"js":         "208",
 		"params":     "13",
 		"mixed":      "8",
@@ -80,15 +86,27 @@ type BuilderModel struct {
 	moveMode bool
 	pickID   string
 
+	// connect (pick a parent, then toggle its edge to another node)
+	linkFrom string
+
+	// re-run AutoLayout on every save
+	layoutOnSave bool
+
 	// DAG
 	g   *graph.DAG
 	occ map[string]int
 
 	// cursor / focus
-	focus focusArea
-	curY  int
-	curX  int
-	msg   string
+	focus   focusArea
+	curY    int
+	curX    int
+	selNode string // node under the cursor, the root until one is picked
+	panX    int    // canvas scrolled this many columns right
+	msg     string
+
+	// background run driven by the header buttons
+	runCh <-chan pipeline.Status
+	ctl   *pipeline.Controller
 }
 
 /*─────────────────────── constructor ─────────────────────────*/
@@ -125,16 +143,19 @@ func NewBuilder(tools []string) BuilderModel {
 	cv := viewport.New(50, 16)
 	cv.YPosition = 1
 
+	g := graph.NewDAG()
+
 	return BuilderModel{
-		btns:       btns,
-		domainInp:  dom,
-		toolSel:    lst,
-		filterBox:  filt,
-		argsInp:    arg,
-		canvas:     cv,
-		g:          graph.NewDAG(),
-		occ:        make(map[string]int),
-		focus:      fHeader,
+		btns:      btns,
+		domainInp: dom,
+		toolSel:   lst,
+		filterBox: filt,
+		argsInp:   arg,
+		canvas:    cv,
+		g:         g,
+		occ:       make(map[string]int),
+		focus:     fHeader,
+		selNode:   g.Root,
 	}
 }
 
@@ -143,12 +164,13 @@ func (m BuilderModel) Init() tea.Cmd { return nil }
 /*─────────────────────── Update loop ─────────────────────────*/
 
 func (m BuilderModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
 
 	switch v := msg.(type) {
 
 	/*──────── mouse handling ───────*/
 	case tea.MouseMsg:
-		if v.Button == tea.MouseButtonLeft && v.Type == tea.MouseButtonPress {
+		if v.Button == tea.MouseButtonLeft && v.Action == tea.MouseActionPress {
 			switch {
 			case hitHeader(v):
 				m.focus = fHeader
@@ -158,7 +180,7 @@ func (m BuilderModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.toolSel.Select(listRow(v))
 			case hitCanvas(v):
 				m.focus = fCanvas
-				m.curX, m.curY = canvasCoord(v, m.canvas)
+				m.curX, m.curY = canvasCoord(v, m.canvas, m.panX)
 				if id := idAtCursor(m); id != "" {
 					m.selNode = id
 				}
@@ -167,17 +189,33 @@ func (m BuilderModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 		if m.focus == fCanvas {
-			if v.Type == tea.MouseWheelUp {
-				m.canvas.LineUp(3)
+			if v.Button == tea.MouseButtonWheelUp {
+				m.canvas.ScrollUp(3)
 			}
-			if v.Type == tea.MouseWheelDown {
-				m.canvas.LineDown(3)
+			if v.Button == tea.MouseButtonWheelDown {
+				m.canvas.ScrollDown(3)
 			}
 		}
 
 	/*──────── keyboard handling ────*/
 	case tea.KeyMsg:
-		m.handleKeys(v)
+		cmd = m.handleKeys(v)
+
+	/*──────── background run ───────*/
+	case pipeline.Status:
+		if v.Type == pipeline.StatusOutput {
+			return m, waitStatus(m.runCh)
+		}
+		m.msg = fmt.Sprintf("[%s] %s %s", v.Category, v.Tool, statusWord(v))
+		if v.Err != nil {
+			m.msg += ": " + v.Err.Error()
+		}
+		return m, waitStatus(m.runCh)
+
+	case doneMsg:
+		m.runCh, m.ctl = nil, nil
+		m.msg = "run finished"
+		return m, nil
 	}
 
 	/* delegate subcomponents */
@@ -198,12 +236,12 @@ func (m BuilderModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	/* refresh canvas */
 	m.canvas.SetContent(renderMatrix(&m))
 
-	return m, nil
+	return m, cmd
 }
 
 /*─────────────────────── key handlers ───────────────────────*/
 
-func (m *BuilderModel) handleKeys(k tea.KeyMsg) {
+func (m *BuilderModel) handleKeys(k tea.KeyMsg) tea.Cmd {
 	ks := k.String()
 
 	// move-mode keys first
@@ -223,7 +261,22 @@ func (m *BuilderModel) handleKeys(k tea.KeyMsg) {
 		case "left", "right", "up", "down":
 			m.arrowMove(ks)
 		}
-		return
+		return nil
+	}
+
+	// connect-mode keys next
+	if m.linkFrom != "" {
+		switch ks {
+		case "esc":
+			m.linkFrom = ""
+			m.msg = "connect cancelled"
+		case "enter", "e":
+			m.toggleEdge(m.linkFrom, idAtCursor(*m))
+			m.linkFrom = ""
+		case "left", "right", "up", "down":
+			m.arrowMove(ks)
+		}
+		return nil
 	}
 
 	switch m.focus {
@@ -242,7 +295,7 @@ func (m *BuilderModel) handleKeys(k tea.KeyMsg) {
 		case "tab":
 			m.focus = fDomain
 		case "enter":
-			m.msg = "clicked " + stripAnsi(m.btns[m.btnIdx])
+			return m.pressButton()
 		}
 
 	/* domain */
@@ -283,10 +336,20 @@ func (m *BuilderModel) handleKeys(k tea.KeyMsg) {
 			m.zoomPan(ks)
 		case "n", "r", "c":
 			m.nodeOps(ks)
+		case "a":
+			m.autoLayout()
+		case "A":
+			m.layoutOnSave = !m.layoutOnSave
+			m.msg = fmt.Sprintf("auto-layout on save: %t", m.layoutOnSave)
 		case "m":
-			if m.selNode != "input" {
+			if m.selNode != m.g.Root {
 				m.moveMode, m.pickID = true, m.selNode
 			}
+		case "e":
+			if m.g.Nodes[m.selNode] != nil {
+				m.linkFrom = m.selNode
+				m.msg = "connect " + m.selNode + " to… (enter on a node, esc cancels)"
+			}
 		case "left", "right", "up", "down":
 			m.arrowMove(ks)
 		}
@@ -297,6 +360,63 @@ func (m *BuilderModel) handleKeys(k tea.KeyMsg) {
 			m.focus = fCanvas
 		}
 	}
+	return nil
+}
+
+/*────────────────── header buttons (run control) ───────────*/
+
+func (m *BuilderModel) pressButton() tea.Cmd {
+	switch m.btnIdx {
+	case 0: // ▶ Run
+		if m.ctl != nil {
+			m.msg = "a run is already in progress"
+			return nil
+		}
+		domain := strings.TrimSpace(m.domainInp.Value())
+		if domain == "" {
+			m.msg = "enter a target domain first"
+			return nil
+		}
+		// run a prepared copy: the graph on the canvas stays editable
+		dag, _, notes, err := prepareRunnable(m.g.Clone(), "builder")
+		if err != nil {
+			m.msg = err.Error()
+			return nil
+		}
+		m.runCh, m.ctl = startRun(dag, domain, "")
+		m.msg = "run started against " + domain
+		if len(notes) > 0 {
+			m.msg += " · " + strings.Join(notes, " · ")
+		}
+		return waitStatus(m.runCh)
+
+	case 1: // ⏸ Pause
+		switch {
+		case m.ctl == nil:
+			m.msg = "nothing is running"
+		case m.ctl.Paused():
+			m.ctl.Resume()
+			m.msg = "run resumed"
+		default:
+			m.ctl.Pause(false)
+			m.msg = "run paused (press again to resume)"
+		}
+
+	case 2: // ■ Stop
+		if m.ctl == nil {
+			m.msg = "nothing is running"
+			return nil
+		}
+		m.ctl.Stop()
+		m.msg = "stopping run…"
+
+	case 3: // 💾 Save
+		m.save()
+
+	default:
+		m.msg = "clicked " + stripAnsi(m.btns[m.btnIdx])
+	}
+	return nil
 }
 
 /*────────────────── DAG operations (add/rm/move) ───────────*/
@@ -305,20 +425,37 @@ func (m *BuilderModel) nodeOps(k string) {
 	switch k {
 
 	case "n": // add child
-		tool := m.toolSel.SelectedItem().(entryItem).name
-		if !canPipe(m.selNode, tool) {
+		item, ok := m.toolSel.SelectedItem().(entryItem)
+		if !ok {
+			return
+		}
+		tool := item.name
+		chain, ok := canPipe(m.g, m.selNode, tool)
+		if !ok {
 			m.msg = lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Render("Type mismatch!")
 			return
 		}
-		m.occ[tool]++
-		id := fmt.Sprintf("%s-%d", tool, m.occ[tool])
+		base := strings.TrimPrefix(tool, pipeline.BuiltinPrefix)
+		m.occ[base]++
+		id := fmt.Sprintf("%s-%d", base, m.occ[base])
 		args := defaultArgs(tool)
-		_ = m.g.AddNode(m.selNode, id, tool, args, m.curY+1)
+		before := m.g.Clone()
+		if m.g.AddNode(m.selNode, id, tool, args, m.curY+1) != nil {
+			return
+		}
+		m.g.Nodes[id].In, m.g.Nodes[id].Out = catalogMap[tool].In, catalogMap[tool].Out
+		if len(chain) > 0 {
+			added, ok := m.convert(before, id+" not added")
+			if !ok {
+				return
+			}
+			m.msg = "converting " + strings.Join(chain, " → ") + " via " + strings.Join(added, ", ")
+		}
 
 	case "r": // remove
-		if m.selNode != "input" {
+		if m.selNode != m.g.Root {
 			_ = m.g.RemoveNode(m.selNode)
-			m.selNode = "input"
+			m.selNode = m.g.Root
 		}
 
 	case "c": // configure args
@@ -328,18 +465,100 @@ func (m *BuilderModel) nodeOps(k string) {
 	}
 }
 
+// toggleEdge removes the edge from → to when there is one and adds it
+// otherwise, converting between their types as a new child would.
+func (m *BuilderModel) toggleEdge(from, to string) {
+	red := lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	child := m.g.Nodes[to]
+	if child == nil {
+		m.msg = "no node here"
+		return
+	}
+	if slices.Contains(m.g.Nodes[from].Children, to) {
+		if err := m.g.RemoveEdge(from, to); err != nil {
+			m.msg = red.Render(err.Error())
+			return
+		}
+		m.msg = "disconnected " + from + " → " + to
+		return
+	}
+
+	chain, ok := canPipe(m.g, from, child.Tool)
+	if !ok {
+		m.msg = red.Render("Type mismatch!")
+		return
+	}
+	before := m.g.Clone()
+	if err := m.g.AddEdge(from, to); err != nil {
+		m.msg = red.Render(err.Error())
+		return
+	}
+	m.msg = "connected " + from + " → " + to
+	if len(chain) > 0 {
+		added, ok := m.convert(before, from+" → "+to+" not connected")
+		if !ok {
+			return
+		}
+		m.msg += ", converting " + strings.Join(chain, " → ") + " via " + strings.Join(added, ", ")
+	}
+}
+
+// convert splices conversion steps into the edges an edit left mismatched.
+// If that fails the edit is undone, restoring before, and the error shown.
+func (m *BuilderModel) convert(before *graph.DAG, undone string) (added []string, ok bool) {
+	added, err := pipeline.InsertConversions(m.g)
+	if err != nil {
+		m.g = before
+		m.msg = lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Render(undone + ": " + err.Error())
+		return nil, false
+	}
+	return added, true
+}
+
+// autoLayout re-derives every node's layer and position from the edges.
+func (m *BuilderModel) autoLayout() {
+	if err := m.g.AutoLayout(); err != nil {
+		m.msg = lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Render(err.Error())
+		return
+	}
+	m.msg = fmt.Sprintf("laid out %d layers", m.g.MaxX+1)
+}
+
+// save writes the workflow and its Mermaid graph to workflows/, laid out
+// first when auto-layout on save is on.
+func (m *BuilderModel) save() {
+	if m.layoutOnSave {
+		if err := m.g.AutoLayout(); err != nil {
+			m.msg = lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Render("not saved: " + err.Error())
+			return
+		}
+	}
+
+	base := filepath.Join("workflows", "workflow-"+time.Now().Format("20060102-150405"))
+	if err := os.MkdirAll("workflows", 0o755); err != nil {
+		m.msg = "save failed: " + err.Error()
+		return
+	}
+	if err := os.WriteFile(base+".json", []byte(m.g.ToJSON()), 0o644); err != nil {
+		m.msg = "save failed: " + err.Error()
+		return
+	}
+	if err := os.WriteFile(base+".mmd", []byte(m.g.ToMermaid()), 0o644); err != nil {
+		m.msg = "save failed: " + err.Error()
+		return
+	}
+	m.msg = "saved " + base + ".json"
+}
+
+// moveSubtree drops the picked node at the end of the cursor's layer and
+// moves its descendants by as many layers.
 func (m *BuilderModel) moveSubtree() {
 	node := m.g.Nodes[m.pickID]
 	dy := m.curY - node.Layer
-	m.g.RemoveFromLayer(m.pickID)
-	m.g.InsertAtLayer(m.pickID, m.curY, m.curX)
-	m.shiftChildren(m.pickID, dy)
-}
-
-func (m *BuilderModel) shiftChildren(id string, dy int) {
-	for _, ch := range m.g.Nodes[id].Children {
-		m.g.Nodes[ch].Layer += dy
-		m.shiftChildren(ch, dy)
+	_ = m.g.MoveNode(m.pickID, m.curY, m.g.GetNextPosition(m.curY, ""))
+	for _, id := range m.g.Descendants(m.pickID) {
+		d := m.g.Nodes[id]
+		_ = m.g.MoveNode(id, max(d.Layer+dy, 1), d.Position)
 	}
 }
 
@@ -354,13 +573,15 @@ func (m *BuilderModel) zoomPan(key string) {
 		m.canvas.Width = clamp(m.canvas.Width+10, 30, 120)
 		m.canvas.Height = clamp(m.canvas.Height-3, 10, 50)
 	case "ctrl+left":
-		m.canvas.SetXOffset(m.canvas.XOffset - 6)
+		m.panX = max(m.panX-6, 0)
+		m.canvas.SetXOffset(m.panX)
 	case "ctrl+right":
-		m.canvas.SetXOffset(m.canvas.XOffset + 6)
+		m.panX += 6
+		m.canvas.SetXOffset(m.panX)
 	case "ctrl+up":
-		m.canvas.LineUp(2)
+		m.canvas.ScrollUp(2)
 	case "ctrl+down":
-		m.canvas.LineDown(2)
+		m.canvas.ScrollDown(2)
 	}
 }
 
@@ -398,14 +619,19 @@ func styleCell(m *BuilderModel, id string, active bool) string {
 			Border(lipgloss.HiddenBorder()).
 			Padding(0, 2).Render("?")
 	}
-	entry, okEntry := catalogMap[node.Tool]
-	if !okEntry {
+	inT, outT := node.In, node.Out
+	if entry, ok := catalogMap[node.Tool]; ok {
+		if inT == "" {
+			inT = entry.In
+		}
+		if outT == "" {
+			outT = entry.Out
+		}
+	} else if !pipeline.IsBuiltin(node.Tool) {
 		return lipgloss.NewStyle().
 			Border(lipgloss.HiddenBorder()).
 			Padding(0, 2).Render("?")
 	}
-	inT := entry.In
-	outT := entry.Out
 
 	st := lipgloss.
 		NewStyle().
@@ -423,8 +649,7 @@ func styleCell(m *BuilderModel, id string, active bool) string {
 func renderMatrix(m *BuilderModel) string {
 	g := m.g
 	var b strings.Builder
-	max := g.MaxLayer()
-	for y := 0; y <= max; y++ {
+	for y := 0; y <= g.MaxX; y++ {
 		row := g.GetLayer(y)
 		fmt.Fprintf(&b, "L%-2d ", y)
 		for x, id := range row {
@@ -478,7 +703,7 @@ func (m BuilderModel) View() string {
 	)
 
 	help := lipgloss.NewStyle().Foreground(lipgloss.Color("8")).Render(
-		"↑↓←→ move  n new  r rm  m pick/drop  c args  PgUp/Down zoom  Ctrl+Arrows pan  / filter  ? legend  q quit",
+		"↑↓←→ move  n new  r rm  m pick/drop  e connect/disconnect  c args  a layout  A layout on save  PgUp/Down zoom  Ctrl+Arrows pan  / filter  ? legend  q quit",
 	)
 
 	return hdr + "\n" +
@@ -494,21 +719,26 @@ func buildToolItems(names []string) []list.Item {
 	for _, c := range catalog {
 		if c.Cat != curCat {
 			curCat = c.Cat
-			items = append(items, list.Separator("── "+curCat+" ──"))
+			items = append(items, separatorItem("── "+curCat+" ──"))
 		}
 		items = append(items, entryItem{c.Name, c.Desc})
 	}
 	return items
 }
 
+// separatorItem is a category heading in the tool list.
+type separatorItem string
+
+func (s separatorItem) FilterValue() string { return "" }
+
 type toolDelegate struct{}
 
 func (toolDelegate) Height() int  { return 1 }
 func (toolDelegate) Spacing() int { return 0 }
 func (toolDelegate) Update(tea.Msg, *list.Model) tea.Cmd { return nil }
 func (toolDelegate) Render(w io.Writer, m list.Model, idx int, itm list.Item) {
-	if sep, ok := itm.(list.Separator); ok {
-		fmt.Fprintln(w, lipgloss.NewStyle().Foreground(lipgloss.Color("8")).Render(sep.String()))
+	if sep, ok := itm.(separatorItem); ok {
+		fmt.Fprintln(w, lipgloss.NewStyle().Foreground(lipgloss.Color("8")).Render(string(sep)))
 		return
 	}
 	e := itm.(entryItem)
@@ -531,8 +761,8 @@ func (m *BuilderModel) applyFilter(cat string) {
 	var items []list.Item
 	for _, it := range buildToolItems(catalogueNames()) {
 		switch v := it.(type) {
-		case list.Separator:
-			if strings.Contains(strings.ToLower(v.String()), cat) {
+		case separatorItem:
+			if strings.Contains(strings.ToLower(string(v)), cat) {
 				items = append(items, v)
 			}
 		case entryItem:
@@ -546,26 +776,21 @@ func (m *BuilderModel) applyFilter(cat string) {
 
 /*──────── type check ─────────────────────*/
 
-func canPipe(parentID, childTool string) bool {
-	parentKey := parentIDTool(parentID)
-	parentEntry, ok1 := catalogMap[parentKey]
+// canPipe reports whether childTool can hang off parentID, either directly
+// or through the conversion steps in chain.
+func canPipe(g *graph.DAG, parentID, childTool string) (chain []string, ok bool) {
+	parent, ok1 := g.Nodes[parentID]
 	childEntry, ok2 := catalogMap[childTool]
 	if !ok1 || !ok2 {
-		return false
+		return nil, false
 	}
-	pOut := parentEntry.Out
-	cIn := childEntry.In
-	if pOut == "raw" || cIn == "raw" {
-		return true
+	pOut := parent.Out
+	if parentID == g.Root {
+		pOut = pipeline.PortDomain
+	} else if pOut == "" {
+		pOut = catalogMap[parent.Tool].Out
 	}
-	return pOut == cIn
-}
-
-func parentIDTool(id string) string {
-	if entry, ok := catalogMap[id]; ok {
-		return entry.Name
-	}
-	return ""
+	return pipeline.Bridge(pOut, childEntry.In)
 }
 
 /*──────── hit-test helpers ───────────────*/
@@ -578,8 +803,8 @@ func hitArgs(v tea.MouseMsg) bool   { return v.X >= 45 && v.Y >= 21 }
 func headerIndex(v tea.MouseMsg) int { return v.X / 10 }
 func listRow(v tea.MouseMsg) int     { return v.Y - 3 }
 
-func canvasCoord(v tea.MouseMsg, vp viewport.Model) (int, int) {
-	x := (v.X - 46 + vp.XOffset) / 8 // 8 chars per cell
+func canvasCoord(v tea.MouseMsg, vp viewport.Model, panX int) (int, int) {
+	x := (v.X - 46 + panX) / 8 // 8 chars per cell
 	y := (v.Y - 3 + vp.YOffset)
 	return x, y
 }
@@ -612,6 +837,5 @@ func idAtCursor(m BuilderModel) string {
 }
 
 func stripAnsi(s string) string {
-	return lipgloss.NewStyle().Unset().
-		UnsetBorder().UnsetMargin().UnsetPadding().Render(s)
+	return ansi.Strip(s)
 }
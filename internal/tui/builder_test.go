@@ -0,0 +1,42 @@
+package tui
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/MKlolbullen/termaid/internal/pipeline"
+)
+
+func TestBuilderConversionRollback(t *testing.T) {
+	m := NewBuilder(catalogueNames())
+	for _, tool := range []string{"bbot", "dnsx", "trufflehog"} {
+		id := tool + "-1"
+		if err := m.g.AddNode(m.g.Root, id, tool, "", 1); err != nil {
+			t.Fatal(err)
+		}
+		m.g.Nodes[id].In, m.g.Nodes[id].Out = catalogMap[tool].In, catalogMap[tool].Out
+	}
+
+	// trufflehog reads repos, which nothing converts the domain into, so
+	// bridging bbot's urls into dnsx's hosts fails and the edge is undone
+	m.toggleEdge("bbot-1", "dnsx-1")
+	if !strings.Contains(m.msg, "not connected") || !strings.Contains(m.msg, "trufflehog-1") {
+		t.Errorf("msg = %q, want the conversion error", m.msg)
+	}
+	if len(m.g.Nodes) != 4 || len(m.g.Nodes["bbot-1"].Children) != 0 {
+		t.Errorf("graph kept the edit: %d nodes, bbot-1 → %q", len(m.g.Nodes), m.g.Nodes["bbot-1"].Children)
+	}
+
+	if err := m.g.RemoveNode("trufflehog-1"); err != nil {
+		t.Fatal(err)
+	}
+	m.toggleEdge("bbot-1", "dnsx-1")
+	converted := func(id string) bool { return m.g.Nodes[id].Tool == pipeline.ConvertTool }
+	if got := m.g.Parents("dnsx-1"); !slices.ContainsFunc(got, converted) {
+		t.Errorf("dnsx-1 reads from %q, want a conversion step", got)
+	}
+	if !slices.Contains(m.g.Ancestors("dnsx-1"), "bbot-1") {
+		t.Errorf("dnsx-1 is not connected to bbot-1: %s", m.msg)
+	}
+}
@@ -2,9 +2,14 @@ package tui
 
 import (
 	"os"
+	"path/filepath"
 	"sort"
+	"strings"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/MKlolbullen/termaid/internal/graph"
+	"github.com/MKlolbullen/termaid/internal/pipeline"
 )
 
 /* ------ Shared UI list.Item: entryItem ------ */
@@ -18,25 +23,75 @@ func (e entryItem) FilterValue() string { return e.name }
 /* ─── catalogEntry (YAML) ─────────────────────────────────────────── */
 
 type catalogEntry struct {
-	Name string `yaml:"name"`
-	Cat  string `yaml:"cat"`
-	Desc string `yaml:"desc"`
-	Def  string `yaml:"def"`
+	Name string   `yaml:"-"` // map key in tools.yaml
+	Cat  string   `yaml:"cat"`
+	Desc string   `yaml:"desc"`
+	In   string   `yaml:"in"`
+	Out  string   `yaml:"out"`
+	Def  []string `yaml:"def"`
+
+	// structured parser of the tool's output (nuclei, httpx, ffuf, …)
+	Parser string `yaml:"parser"`
+
+	// execution defaults, overridden by the workflow node
+	Timeout      int    `yaml:"timeout"`
+	Retries      int    `yaml:"retries"`
+	Backoff      string `yaml:"backoff"`
+	BackoffDelay int    `yaml:"backoff_delay"`
+	AcceptExit   []int  `yaml:"accept_exit"` // non-zero exit codes that still mean success
+	CacheTTL     string `yaml:"cache_ttl"`   // how long cached results stay valid ("12h", "off")
+
+	// instances of this tool allowed to run at once (0 = unlimited)
+	MaxParallel int `yaml:"max_parallel"`
+
+	// API keys from the secrets store (termaid secrets set NAME)
+	SecretEnv   map[string]string `yaml:"secret_env"`   // environment variable → secret name
+	SecretFiles map[string]string `yaml:"secret_files"` // file in {{secret_dir}} → template using {{secret.NAME}}
+
+	// rlimits for the tool process, each overridable by the node
+	Limits graph.ResourceLimits `yaml:"limits"`
 }
 
 /* ─── entryItem (UI list item) ────────────────────────────────────── */
 
-
 /* ─── global catalog slice ───────────────────────────────────────── */
 
-var catalog []catalogEntry
+var (
+	catalog    []catalogEntry
+	catalogMap map[string]catalogEntry
+)
 
 func init() {
-	c, err := LoadCatalog("assets/tools.yaml")
+	c, err := LoadCatalog(findUp("assets/tools.yaml"))
 	if err != nil {
 		panic(err)
 	}
 	catalog = c
+	catalogMap = make(map[string]catalogEntry, len(c))
+	for _, e := range c {
+		catalogMap[e.Name] = e
+	}
+}
+
+// findUp returns path under the working directory or, failing that, under
+// the nearest parent that has it, so termaid also starts from a subdirectory
+// of its checkout. path itself comes back when no directory has it.
+func findUp(path string) string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	for {
+		p := filepath.Join(dir, path)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return path
+		}
+		dir = parent
+	}
 }
 
 func LoadCatalog(path string) ([]catalogEntry, error) {
@@ -44,20 +99,112 @@ func LoadCatalog(path string) ([]catalogEntry, error) {
 	if err != nil {
 		return nil, err
 	}
-	var list []catalogEntry
-	if err := yaml.Unmarshal(raw, &list); err != nil {
+	var byName map[string]catalogEntry
+	if err := yaml.Unmarshal(raw, &byName); err != nil {
 		return nil, err
 	}
-	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	list := builtinEntries(byName)
+	for name, e := range byName {
+		e.Name = name
+		for i, a := range e.Def {
+			e.Def[i] = pipeline.NormalizePlaceholders(a)
+		}
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Cat != list[j].Cat {
+			return list[i].Cat < list[j].Cat
+		}
+		return list[i].Name < list[j].Name
+	})
 	return list, nil
 }
 
+// builtinEntries lists termaid's in-process nodes, which need nothing on
+// PATH, under their own category; they replace yaml entries of the same name.
+func builtinEntries(byName map[string]catalogEntry) []catalogEntry {
+	var list []catalogEntry
+	for _, b := range pipeline.Builtins() {
+		delete(byName, b.Name)
+		desc := b.Desc
+		if b.Usage != "" {
+			desc += " — " + b.Usage
+		}
+		list = append(list, catalogEntry{Name: b.Name, Cat: "builtin", Desc: desc, In: b.In, Out: b.Out, Def: b.Def})
+	}
+	return list
+}
+
 /* helper used by builder */
 func defaultArgs(tool string) string {
+	if c, ok := catalogMap[tool]; ok {
+		return strings.Join(c.Def, " ")
+	}
+	return ""
+}
+
+/* toolLimits returns the per-tool concurrency caps declared in the catalog */
+func toolLimits() map[string]int {
+	limits := make(map[string]int)
 	for _, c := range catalog {
-		if c.Name == tool {
-			return c.Def
+		if c.MaxParallel > 0 {
+			limits[c.Name] = c.MaxParallel
+		}
+	}
+	return limits
+}
+
+/* applyCatalogDefaults fills execution settings a node leaves unset */
+func applyCatalogDefaults(g *graph.DAG) {
+	for _, n := range g.Nodes {
+		c, ok := catalogMap[n.Tool]
+		if !ok {
+			continue
+		}
+		if n.In == "" {
+			n.In = c.In
+		}
+		if n.Out == "" {
+			n.Out = c.Out
+		}
+		if n.Parser == "" {
+			n.Parser = c.Parser
+		}
+		if n.Timeout == nil && c.Timeout != 0 {
+			n.Timeout = &c.Timeout
+		}
+		if n.Retries == nil && c.Retries != 0 {
+			n.Retries = &c.Retries
+		}
+		if n.Backoff == "" {
+			n.Backoff = c.Backoff
+		}
+		if n.BackoffDelay == nil && c.BackoffDelay != 0 {
+			n.BackoffDelay = &c.BackoffDelay
+		}
+		if len(n.AcceptExit) == 0 {
+			n.AcceptExit = c.AcceptExit
+		}
+		if n.CacheTTL == "" {
+			n.CacheTTL = c.CacheTTL
+		}
+		if len(n.SecretEnv) == 0 {
+			n.SecretEnv = c.SecretEnv
+		}
+		if len(n.SecretFiles) == 0 {
+			n.SecretFiles = c.SecretFiles
+		}
+		if n.Limits.CPUSeconds == 0 {
+			n.Limits.CPUSeconds = c.Limits.CPUSeconds
+		}
+		if n.Limits.MemoryMB == 0 {
+			n.Limits.MemoryMB = c.Limits.MemoryMB
+		}
+		if n.Limits.OpenFiles == 0 {
+			n.Limits.OpenFiles = c.Limits.OpenFiles
+		}
+		if n.Limits.FileSizeMB == 0 {
+			n.Limits.FileSizeMB = c.Limits.FileSizeMB
 		}
 	}
-	return ""
 }
@@ -0,0 +1,45 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyCatalogDefaults(t *testing.T) {
+	bbot, ok := catalogMap["bbot"]
+	if !ok || bbot.Timeout == 0 || bbot.Retries == 0 {
+		t.Fatalf("catalog bbot = %+v, want a timeout and retries to override", bbot)
+	}
+
+	// bbot-1 leaves both unset, bbot-2 turns them off, bbot-3 picks its own
+	path := filepath.Join(t.TempDir(), "workflow.json")
+	src := `{"version": "2.0", "workflow": [
+		{"id": "bbot-1", "tool": "bbot", "layer": 1},
+		{"id": "bbot-2", "tool": "bbot", "layer": 1, "timeout": 0, "retries": 0},
+		{"id": "bbot-3", "tool": "bbot", "layer": 1, "timeout": 60, "retries": 3}
+	]}`
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dag, err := LoadWorkflow(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applyCatalogDefaults(dag)
+
+	for id, want := range map[string][2]int{
+		"bbot-1": {bbot.Timeout, bbot.Retries},
+		"bbot-2": {0, 0},
+		"bbot-3": {60, 3},
+	} {
+		n := dag.Nodes[id]
+		if n == nil || n.Timeout == nil || n.Retries == nil {
+			t.Errorf("%s: timeout or retries unset: %+v", id, n)
+			continue
+		}
+		if got := [2]int{*n.Timeout, *n.Retries}; got != want {
+			t.Errorf("%s: timeout, retries = %v, want %v", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package tui
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// maxLogLines is how many lines of the run log the viewport keeps.
+const maxLogLines = 2000
+
+// logTail is the run log: the last maxLogLines lines for the viewport, with
+// every line also written to the log file so the file keeps the whole run.
+// Models hold it by pointer since bubbletea copies them on every update.
+type logTail struct {
+	lines []string
+	path  string
+	w     *bufio.Writer
+}
+
+func newLogTail(path string) *logTail {
+	return &logTail{path: path}
+}
+
+// add appends a line, dropping the oldest once the tail is full.
+func (l *logTail) add(line string) {
+	l.lines = append(l.lines, line)
+	if len(l.lines) > maxLogLines {
+		// re-slicing lets append move the tail to a fresh array once the old
+		// one fills up, so memory stays around twice the cap
+		l.lines = l.lines[len(l.lines)-maxLogLines:]
+	}
+
+	if l.w == nil && l.path != "" {
+		f, err := os.Create(l.path)
+		if err != nil {
+			l.path = "" // do not retry on every line
+			return
+		}
+		l.w = bufio.NewWriter(f)
+	}
+	if l.w != nil {
+		l.w.WriteString(line + "\n")
+	}
+}
+
+// String renders the tail for the viewport.
+func (l *logTail) String() string {
+	return strings.Join(l.lines, "\n")
+}
+
+// flush writes out what the log file has buffered.
+func (l *logTail) flush() {
+	if l.w != nil {
+		l.w.Flush()
+	}
+}
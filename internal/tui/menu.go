@@ -8,7 +8,9 @@ import (
 	"os/exec"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/textinput"
@@ -17,6 +19,7 @@ import (
 
 	"github.com/MKlolbullen/termaid/internal/graph"
 	"github.com/MKlolbullen/termaid/internal/pipeline"
+	"github.com/MKlolbullen/termaid/internal/secrets"
 )
 
 /*───────── entryItem ────────────────────────────────────────────────────────*/
@@ -72,15 +75,11 @@ func (m MenuModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if _, err := os.Stat("workflow.json"); os.IsNotExist(err) {
 				return errView(fmt.Errorf("workflow.json not found - please create a workflow first or use a template")), nil
 			}
-			// ask for domain first
-			domInput := textinput.New()
-			domInput.Placeholder = "target.com"
-			domInput.Focus()
-			return domainPrompt{input: domInput, template: "workflow.json"}, nil
+			// ask for targets first
+			return newDomainPrompt("workflow.json"), nil
 
 		case "📋 Run Template":
-			files, _ := filepath.Glob("workflows/*.json")
-			return newTmplPicker(files), nil
+			return newTmplPicker(workflowFiles()), nil
 
 		case "👁️  Preview Workflow":
 			if _, err := os.Stat("workflow.mmd"); os.IsNotExist(err) {
@@ -130,11 +129,29 @@ func (m MenuModel) View() string {
 
 /*───────── domainPrompt ──────────────────────────────────────────────────────*/
 
+// domainPrompt asks for one target or several: typed in separated by commas
+// or spaces, or loaded from a file with @path. A second field sets how many
+// targets run at once.
 type domainPrompt struct {
 	input    textinput.Model
+	parallel textinput.Model
 	template string
 }
 
+func newDomainPrompt(template string) domainPrompt {
+	input := textinput.New()
+	input.Placeholder = "target.com, other.com or @targets.txt"
+	input.Width = 48
+	input.Focus()
+
+	parallel := textinput.New()
+	parallel.Placeholder = strconv.Itoa(runDefaults.TargetConcurrency)
+	parallel.CharLimit = 3
+	parallel.Width = 4
+
+	return domainPrompt{input: input, parallel: parallel, template: template}
+}
+
 func (d domainPrompt) Init() tea.Cmd { return nil }
 
 func (d domainPrompt) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -142,18 +159,61 @@ func (d domainPrompt) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.KeyMsg:
 		switch v.String() {
 		case "enter":
-			return runWorkflowWithDomain(d.template, d.input.Value())
+			return d.submit()
+		case "tab", "shift+tab":
+			if d.input.Focused() {
+				d.input.Blur()
+				d.parallel.Focus()
+			} else {
+				d.parallel.Blur()
+				d.input.Focus()
+			}
+			return d, nil
 		case "esc":
 			return NewMenu(), nil
 		}
 	}
 	var cmd tea.Cmd
-	d.input, cmd = d.input.Update(msg)
+	if d.parallel.Focused() {
+		d.parallel, cmd = d.parallel.Update(msg)
+	} else {
+		d.input, cmd = d.input.Update(msg)
+	}
 	return d, cmd
 }
 
+func (d domainPrompt) submit() (tea.Model, tea.Cmd) {
+	value := strings.TrimSpace(d.input.Value())
+
+	var targets []string
+	if path, ok := strings.CutPrefix(value, "@"); ok {
+		var err error
+		if targets, err = pipeline.LoadTargets(strings.TrimSpace(path)); err != nil {
+			return errView(fmt.Errorf("cannot load targets: %w", err)), nil
+		}
+	} else {
+		targets = pipeline.ParseTargets(value)
+	}
+
+	if len(targets) <= 1 {
+		return runWorkflowWithDomain(d.template, strings.Join(targets, ""))
+	}
+
+	parallel := runDefaults.TargetConcurrency
+	if p := strings.TrimSpace(d.parallel.Value()); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 {
+			return errView(fmt.Errorf("targets at once must be a positive number, got %q", p)), nil
+		}
+		parallel = n
+	}
+	return runWorkflowTargets(d.template, targets, parallel)
+}
+
 func (d domainPrompt) View() string {
-	return "Enter target domain:\n\n" + d.input.View() + "\n\n[enter] to continue • [esc] cancel"
+	return "Enter target(s):\n\n" + d.input.View() +
+		"\n\nTargets at once: " + d.parallel.View() +
+		"\n\n[enter] to continue • [tab] switch field • [esc] cancel"
 }
 
 /*───────── helpers ──────────────────────────────────────────────────────────*/
@@ -167,12 +227,41 @@ func catalogueNames() []string {
 	return out
 }
 
+// workflowFiles lists the workflows in workflows/: every .json, and every
+// .mmd that is not just the diagram saved next to a .json.
+func workflowFiles() []string {
+	files, _ := filepath.Glob("workflows/*.json")
+	charts, _ := filepath.Glob("workflows/*.mmd")
+	for _, c := range charts {
+		if _, err := os.Stat(strings.TrimSuffix(c, filepath.Ext(c)) + ".json"); os.IsNotExist(err) {
+			files = append(files, c)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
 func LoadWorkflow(path string) (*graph.DAG, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 	
+	// Mermaid flowcharts name their tools; args missing from the chart come
+	// from the catalog
+	if strings.EqualFold(filepath.Ext(path), ".mmd") {
+		g, err := graph.ParseMermaid(string(data))
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range g.Nodes {
+			if n.ID != g.Root && n.Args == "" {
+				n.Args = defaultArgs(n.Tool)
+			}
+		}
+		return g, nil
+	}
+
 	// Try new format first
 	var newFormat struct {
 		Version   string                      `json:"version"`
@@ -181,12 +270,15 @@ func LoadWorkflow(path string) (*graph.DAG, error) {
 			MaxY int `json:"max_y"`
 		} `json:"matrix"`
 		Subgraphs []struct {
-			ID       string   `json:"id"`
-			Name     string   `json:"name"`
-			Parallel bool     `json:"parallel"`
-			Nodes    []string `json:"nodes"`
+			ID          string   `json:"id"`
+			Name        string   `json:"name"`
+			Parallel    bool     `json:"parallel"`
+			MaxParallel int      `json:"max_parallel"`
+			Nodes       []string `json:"nodes"`
 		} `json:"subgraphs"`
-		Workflow []graph.Node `json:"workflow"`
+		Scope    *graph.Scope      `json:"scope"`
+		Vars     map[string]string `json:"variables"`
+		Workflow []graph.Node      `json:"workflow"`
 	}
 	
 	if err := json.Unmarshal(data, &newFormat); err == nil && newFormat.Version == "2.0" {
@@ -194,15 +286,18 @@ func LoadWorkflow(path string) (*graph.DAG, error) {
 		g := graph.NewDAG()
 		g.MaxX = newFormat.Matrix.MaxX
 		g.MaxY = newFormat.Matrix.MaxY
+		g.Scope = newFormat.Scope
+		g.Vars = newFormat.Vars
 		
 		// Load subgraphs
 		for _, sg := range newFormat.Subgraphs {
 			g.Subgraphs[sg.ID] = &graph.SubgraphInfo{
-				ID:       sg.ID,
-				Name:     sg.Name,
-				Parallel: sg.Parallel,
-				Nodes:    sg.Nodes,
-				Matrix:   make(map[string]graph.Coordinate),
+				ID:          sg.ID,
+				Name:        sg.Name,
+				Parallel:    sg.Parallel,
+				MaxParallel: sg.MaxParallel,
+				Nodes:       sg.Nodes,
+				Matrix:      make(map[string]graph.Coordinate),
 			}
 		}
 		
@@ -219,13 +314,15 @@ func LoadWorkflow(path string) (*graph.DAG, error) {
 	
 	// Fallback to old format
 	var oldFormat struct {
-		Workflow []graph.Node `json:"workflow"`
+		Vars     map[string]string `json:"variables"`
+		Workflow []graph.Node      `json:"workflow"`
 	}
 	if err := json.Unmarshal(data, &oldFormat); err != nil {
 		return nil, err
 	}
 	
 	g := graph.NewDAG()
+	g.Vars = oldFormat.Vars
 	for _, n := range oldFormat.Workflow {
 		cp := n
 		// Convert old format: no position field, so auto-assign
@@ -250,22 +347,205 @@ func runWorkflowWithDomain(path, domain string) (tea.Model, tea.Cmd) {
 		return errView(fmt.Errorf("domain cannot be empty")), nil
 	}
 	
+	dag, cats, notes, err := loadRunnable(path)
+	if err != nil {
+		return errView(err), nil
+	}
+
+	ch, ctl := startRun(dag, domain, path)
+	model := New(cats, ch, ctl)
+	for _, note := range notes {
+		model.notef("%s", note)
+	}
+	for _, issue := range dag.Lint() {
+		model.notef("[lint] %s", issue)
+	}
+	return model, nil
+}
+
+// runWorkflowTargets runs the workflow once per target, parallel at a time,
+// and shows their progress side by side.
+func runWorkflowTargets(path string, targets []string, parallel int) (tea.Model, tea.Cmd) {
+	dag, cats, notes, err := loadRunnable(path)
+	if err != nil {
+		return errView(err), nil
+	}
+
+	ch, ctl := startPipeline(func(ctx context.Context, opts pipeline.RunOptions, ch chan<- pipeline.Status) error {
+		opts.WorkflowPath = path
+		opts.TargetConcurrency = parallel
+		_, err := pipeline.RunTargets(ctx, targets, "workdir", dag, opts, ch)
+		return err
+	})
+
+	nodes := 0
+	for _, c := range cats {
+		nodes += len(c.Tools)
+	}
+	model := newTargetsModel(targets, nodes, parallel, ch, ctl)
+	for _, note := range notes {
+		model.notef("%s", note)
+	}
+	for _, issue := range dag.Lint() {
+		model.notef("[lint] %s", issue)
+	}
+	return model, nil
+}
+
+// loadRunnable loads a workflow and prepares it with prepareRunnable.
+func loadRunnable(path string) (*graph.DAG, []pipeline.Category, []string, error) {
 	dag, err := LoadWorkflow(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return errView(fmt.Errorf("workflow file '%s' not found - please create a workflow first", path)), nil
+			return nil, nil, nil, fmt.Errorf("workflow file '%s' not found - please create a workflow first", path)
 		}
-		return errView(fmt.Errorf("failed to load workflow '%s': %w", path, err)), nil
+		return nil, nil, nil, fmt.Errorf("failed to load workflow '%s': %w", path, err)
 	}
-	
+	return prepareRunnable(dag, path)
+}
+
+// prepareRunnable validates dag, fills in catalog defaults, bridges type
+// mismatches with conversion steps and checks it has something to run. The
+// notes say which conversions were added, which edges none could bridge and
+// what validation found: warnings always, errors when forced. dag is
+// modified in place.
+func prepareRunnable(dag *graph.DAG, name string) (*graph.DAG, []pipeline.Category, []string, error) {
+	var notes []string
+	problems := dag.Validate()
+	if errs := graph.Errors(problems); len(errs) > 0 && !runDefaults.Force {
+		return nil, nil, nil, fmt.Errorf("%w\n(fix the workflow or pass --force to run it anyway)", &graph.ValidationError{Problems: errs})
+	}
+	for _, p := range problems {
+		notes = append(notes, "[validate] "+p.String())
+	}
+
+	applyCatalogDefaults(dag)
+
+	added, err := pipeline.InsertConversions(dag)
+	if len(added) > 0 {
+		notes = append(notes, "[types] added conversion steps: "+strings.Join(added, ", "))
+	}
+	if err != nil {
+		notes = append(notes, "[types] "+err.Error())
+	}
+
 	cats := dagToCategories(dag)
 	if len(cats) == 0 {
-		return errView(fmt.Errorf("workflow '%s' contains no valid tools to execute", path)), nil
+		return nil, nil, nil, fmt.Errorf("workflow '%s' contains no valid tools to execute", name)
 	}
+	return dag, cats, notes, nil
+}
+
+// runDefaults are the options every run started from the TUI begins with.
+var runDefaults = pipeline.RunOptions{Concurrency: 6, TargetConcurrency: 2}
+
+// DisableCache makes every run ignore the result cache (--no-cache).
+func DisableCache() { runDefaults.NoCache = true }
+
+// ForceInvalid runs workflows even when graph.Validate finds problems
+// (--force).
+func ForceInvalid() { runDefaults.Force = true }
+
+// SetScopeFile applies the scope in a JSON file to every run, overriding
+// the workflow's own (--scope).
+func SetScopeFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var scope graph.Scope
+	if err := json.Unmarshal(data, &scope); err != nil {
+		return fmt.Errorf("invalid scope file %s: %w", path, err)
+	}
+	runDefaults.Scope = &scope
+	return nil
+}
+
+// SetVar overrides a workflow variable for every run (--var name=value).
+func SetVar(assignment string) error {
+	name, value, ok := strings.Cut(assignment, "=")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("invalid variable %q, want name=value", assignment)
+	}
+	if runDefaults.Vars == nil {
+		runDefaults.Vars = make(map[string]string)
+	}
+	runDefaults.Vars[strings.TrimSpace(name)] = value
+	return nil
+}
+
+// UseSecrets makes the secrets in store available to every run.
+func UseSecrets(store *secrets.Store) { runDefaults.Secrets = store }
+
+// SetConcurrency sets the global cap on nodes running at once (--concurrency).
+func SetConcurrency(n int) {
+	if n > 0 {
+		runDefaults.Concurrency = n
+	}
+}
+
+// SetTargetConcurrency sets how many targets of a multi-target run are
+// scanned at once (--target-concurrency).
+func SetTargetConcurrency(n int) {
+	if n > 0 {
+		runDefaults.TargetConcurrency = n
+	}
+}
+
+// ResumeRun continues an interrupted run from its checkpoint in ./workdir.
+func ResumeRun(runID string) (tea.Model, tea.Cmd) {
+	dag, err := LoadWorkflow(pipeline.SnapshotPath("workdir", runID))
+	if err != nil {
+		return errView(fmt.Errorf("cannot resume %s: %w", runID, err)), nil
+	}
+	applyCatalogDefaults(dag)
+
+	ch, ctl := startPipeline(func(ctx context.Context, opts pipeline.RunOptions, ch chan<- pipeline.Status) error {
+		return pipeline.ResumeDAG(ctx, "workdir", runID, dag, opts, ch)
+	})
+	model := New(dagToCategories(dag), ch, ctl)
+	model.notef("[run] resuming %s", runID)
+	return model, nil
+}
+
+// startRun executes g in the background and returns its status stream
+// together with the handle that pauses, resumes or stops it.
+func startRun(g *graph.DAG, domain, workflowPath string) (<-chan pipeline.Status, *pipeline.Controller) {
+	return startPipeline(func(ctx context.Context, opts pipeline.RunOptions, ch chan<- pipeline.Status) error {
+		opts.WorkflowPath = workflowPath
+		return pipeline.RunDAG(ctx, domain, "workdir", g, opts, ch)
+	})
+}
+
+// runs holds the controller of every run started from the TUI, so StopRuns
+// can reach them when the program exits.
+var runs struct {
+	sync.Mutex
+	ctls []*pipeline.Controller
+}
+
+// StopRuns stops every run started from the TUI and kills their tools. Call
+// it before exiting so no tool is left running as an orphan.
+func StopRuns() {
+	runs.Lock()
+	defer runs.Unlock()
+	for _, ctl := range runs.ctls {
+		ctl.Stop()
+	}
+	runs.ctls = nil
+}
 
+func startPipeline(run func(context.Context, pipeline.RunOptions, chan<- pipeline.Status) error) (<-chan pipeline.Status, *pipeline.Controller) {
+	ctx, ctl := pipeline.NewController(context.Background())
+	runs.Lock()
+	runs.ctls = append(runs.ctls, ctl)
+	runs.Unlock()
 	ch := make(chan pipeline.Status, 128)
 	go func() {
-		if err := pipeline.Run(context.Background(), domain, "workdir", cats, 6, ch); err != nil {
+		opts := runDefaults
+		opts.Control = ctl
+		opts.ToolLimits = toolLimits()
+		if err := run(ctx, opts, ch); err != nil {
 			ch <- pipeline.Status{
 				Type: pipeline.StatusError,
 				Tool: "pipeline",
@@ -274,7 +554,7 @@ func runWorkflowWithDomain(path, domain string) (tea.Model, tea.Cmd) {
 		}
 		close(ch)
 	}()
-	return New(cats, ch), nil
+	return ch, ctl
 }
 
 func previewMermaid() (tea.Model, tea.Cmd) {
@@ -326,13 +606,9 @@ func dagToCategories(g *graph.DAG) []pipeline.Category {
 		
 		for _, nodeID := range nodeGroup {
 			if node, exists := g.Nodes[nodeID]; exists && node.ID != g.Root {
-				tools = append(tools, pipeline.Tool{
-					Name:     node.ID,
-					Command:  node.Tool,
-					Args:     strings.Fields(node.Args),
-					Output:   fmt.Sprintf("%s_%s.txt", node.Tool, node.ID),
-					Parallel: isParallel,
-				})
+				tool := pipeline.ToolFromNode(node)
+				tool.Parallel = isParallel
+				tools = append(tools, tool)
 			}
 		}
 		
@@ -0,0 +1,51 @@
+package tui
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/MKlolbullen/termaid/internal/graph"
+)
+
+// unloadable are shipped files that are not workflow JSON at all.
+var unloadable = map[string]string{
+	"advanced-recon.json": "empty file",
+	"mypreset1.json":      "JSON with /* */ comments",
+}
+
+// TestShippedWorkflows loads every workflow and template in the repository
+// and checks that it validates and prepares to run without --force.
+func TestShippedWorkflows(t *testing.T) {
+	var files []string
+	for _, pattern := range []string{"workflows/*.json", "workflows/*.mmd", "templates/*.json"} {
+		matches, err := filepath.Glob(filepath.Join("..", "..", pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		t.Fatal("no shipped workflows found")
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			if why, ok := unloadable[filepath.Base(file)]; ok {
+				t.Skip(why)
+			}
+			dag, err := LoadWorkflow(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if errs := graph.Errors(dag.Validate()); len(errs) > 0 {
+				t.Errorf("validation errors: %v", errs)
+			}
+			if len(dag.Nodes) == 1 {
+				return // only the root, nothing to run
+			}
+			if _, _, _, err := prepareRunnable(dag, file); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -1,9 +1,7 @@
 package tui
 
 import (
-	"bytes"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/charmbracelet/bubbles/viewport"
@@ -16,30 +14,42 @@ import (
 /* ────────────────── Progress + Log Model ─────────────────────── */
 
 type Model struct {
-	cats  []pipeline.Category
-	state map[string]pipeline.StatusUpdateType // node ID → status
+	cats   []pipeline.Category
+	state  map[string]pipeline.StatusUpdateType // node ID → status
+	shards map[string]shardProgress             // node ID → chunks finished
+	counts map[string]pipeline.Status           // node ID → latest StatusProgress
 
-	logBuf  bytes.Buffer
+	log     *logTail
 	vp      viewport.Model
 	showLog bool
 
 	statusCh <-chan pipeline.Status
+	ctl      *pipeline.Controller
 	done     bool
-	logPath  string
 }
 
 type doneMsg struct{}
 
-func New(cats []pipeline.Category, ch <-chan pipeline.Status) Model {
+// shardProgress counts the finished chunks of a sharded node and the stdout
+// lines of each chunk so far.
+type shardProgress struct {
+	done, total int
+	lines       map[int]int // chunk → lines
+}
+
+func New(cats []pipeline.Category, ch <-chan pipeline.Status, ctl *pipeline.Controller) Model {
 	vp := viewport.New(0, 10) // width set later
 	vp.SetContent("")
 
 	return Model{
 		cats:     cats,
 		state:    make(map[string]pipeline.StatusUpdateType),
+		shards:   make(map[string]shardProgress),
+		counts:   make(map[string]pipeline.Status),
 		vp:       vp,
 		statusCh: ch,
-		logPath:  fmt.Sprintf("run-%d.log", time.Now().Unix()),
+		ctl:      ctl,
+		log:      newLogTail(fmt.Sprintf("run-%d.log", time.Now().Unix())),
 	}
 }
 
@@ -51,13 +61,45 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch v := msg.(type) {
 
 	case pipeline.Status:
-		m.state[v.Tool] = v.Type
+		switch v.Type {
+		case pipeline.StatusOutput:
+			m.writeOutput(v)
+			return m, m.nextStatus()
+		case pipeline.StatusProgress:
+			if v.Shard > 0 {
+				p := m.shards[v.Tool]
+				if p.lines == nil {
+					p.lines = make(map[int]int)
+				}
+				p.lines[v.Shard], p.total = v.OutLines, v.Shards
+				m.shards[v.Tool] = p
+			} else {
+				m.counts[v.Tool] = v
+			}
+			return m, m.nextStatus()
+		case pipeline.StatusShard:
+			p := m.shards[v.Tool]
+			p.done, p.total = p.done+1, v.Shards
+			m.shards[v.Tool] = p
+		default:
+			m.state[v.Tool] = v.Type
+		}
 		line := fmt.Sprintf("[%s] %-15s %s", v.Category, v.Tool, statusWord(v))
-		if v.Type == pipeline.StatusError {
+		if v.Err != nil && v.Type != pipeline.StatusError {
+			line += ": " + v.Err.Error()
+		}
+		switch v.Type {
+		case pipeline.StatusError, pipeline.StatusTimeout:
 			line = lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Render(line)
+		case pipeline.StatusRetry:
+			line = lipgloss.NewStyle().Foreground(lipgloss.Color("208")).Render(line)
+		case pipeline.StatusShard:
+			if v.Err != nil {
+				line = lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Render(line)
+			}
 		}
-		m.logBuf.WriteString(line + "\n")
-		m.vp.SetContent(m.logBuf.String())
+		m.log.add(line)
+		m.vp.SetContent(m.log.String())
 		m.vp.GotoBottom()
 		return m, m.nextStatus()
 
@@ -68,11 +110,28 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case tea.KeyMsg:
 		switch v.String() {
-		case "q":
+		case "q", "ctrl+c":
 			if !m.done {
+				m.ctl.Stop()
 				m.flushLog()
 			}
 			return m, tea.Quit
+		case "p", "P":
+			if m.done {
+				break
+			}
+			if m.ctl.Paused() {
+				m.ctl.Resume()
+				m.notef("[run] resumed")
+			} else {
+				m.ctl.Pause(v.String() == "P")
+				m.notef("[run] paused")
+			}
+		case "s":
+			if !m.done {
+				m.ctl.Stop()
+				m.notef("[run] stopping")
+			}
 		case "tab":
 			m.showLog = !m.showLog
 		}
@@ -94,7 +153,7 @@ func (m Model) View() string {
 
 	footer := lipgloss.NewStyle().
 		Foreground(lipgloss.Color("8")).
-		Render("[tab] logs • [q] quit")
+		Render("[tab] logs • [p] pause/resume • [P] pause + freeze tools • [s] stop • [q] quit")
 
 	if m.showLog {
 		title := lipgloss.NewStyle().Bold(true).Render("Live Output (↑/↓ PgUp/PgDn)")
@@ -106,16 +165,51 @@ func (m Model) View() string {
 /* ────────────────── helpers ───────────────────── */
 
 func (m Model) nextStatus() tea.Cmd {
+	return waitStatus(m.statusCh)
+}
+
+// waitStatus delivers the next pipeline.Status, or doneMsg once ch closes.
+func waitStatus(ch <-chan pipeline.Status) tea.Cmd {
 	return func() tea.Msg {
-		if st, ok := <-m.statusCh; ok {
+		if st, ok := <-ch; ok {
 			return st
 		}
 		return doneMsg{}
 	}
 }
 
+// writeOutput appends a batch of tool output to the log, dimmed and prefixed
+// with the node (and chunk) it came from.
+func (m *Model) writeOutput(st pipeline.Status) {
+	prefix := st.Tool
+	if st.Shard > 0 {
+		prefix = fmt.Sprintf("%s#%d", st.Tool, st.Shard)
+	}
+	color := lipgloss.Color("8")
+	if st.Stream == "stderr" {
+		color = lipgloss.Color("3")
+	}
+	style := lipgloss.NewStyle().Foreground(color)
+
+	for _, l := range st.Lines {
+		m.log.add(style.Render(fmt.Sprintf("  %s │ %s", prefix, l)))
+	}
+	if st.Dropped > 0 {
+		m.log.add(style.Render(fmt.Sprintf("  %s │ … %d more %s lines", prefix, st.Dropped, st.Stream)))
+	}
+	m.vp.SetContent(m.log.String())
+	m.vp.GotoBottom()
+}
+
+// notef writes a dimmed informational line to the log before the run starts.
+func (m *Model) notef(format string, args ...any) {
+	line := lipgloss.NewStyle().Foreground(lipgloss.Color("8")).Render(fmt.Sprintf(format, args...))
+	m.log.add(line)
+	m.vp.SetContent(m.log.String())
+}
+
 func (m Model) flushLog() {
-	_ = os.WriteFile(m.logPath, m.logBuf.Bytes(), 0644)
+	m.log.flush()
 }
 
 func statusWord(s pipeline.Status) string {
@@ -126,6 +220,29 @@ func statusWord(s pipeline.Status) string {
 		return "done"
 	case pipeline.StatusError:
 		return "error"
+	case pipeline.StatusTimeout:
+		return "timeout"
+	case pipeline.StatusRetry:
+		return "retrying"
+	case pipeline.StatusReused:
+		return "reused"
+	case pipeline.StatusCached:
+		return "cached"
+	case pipeline.StatusSkipped:
+		return "skipped"
+	case pipeline.StatusShard:
+		if s.Err != nil {
+			return fmt.Sprintf("shard %d/%d failed", s.Shard, s.Shards)
+		}
+		return fmt.Sprintf("shard %d/%d done", s.Shard, s.Shards)
+	case pipeline.StatusOutput:
+		return "output"
+	case pipeline.StatusProgress:
+		return fmt.Sprintf("running (%d lines, %s)", s.OutLines, s.Elapsed.Round(time.Second))
+	case pipeline.StatusTargetStart:
+		return "target started as " + s.RunID
+	case pipeline.StatusTargetDone:
+		return "target " + string(s.Result)
 	default:
 		return "?"
 	}
@@ -148,12 +265,31 @@ func (m Model) renderChart() string {
 			switch m.state[id] {
 			case pipeline.StatusStart:
 				style = style.Foreground(lipgloss.Color("11")) // yellow
-			case pipeline.StatusFinish:
+			case pipeline.StatusFinish, pipeline.StatusReused:
 				style = style.Foreground(lipgloss.Color("10")) // green
+			case pipeline.StatusCached:
+				style = style.Foreground(lipgloss.Color("14")) // cyan
 			case pipeline.StatusError:
 				style = style.Foreground(lipgloss.Color("9")) // red
+			case pipeline.StatusTimeout:
+				style = style.Foreground(lipgloss.Color("9")).Underline(true) // red, underlined
+			case pipeline.StatusRetry:
+				style = style.Foreground(lipgloss.Color("208")) // orange
+			case pipeline.StatusSkipped:
+				style = style.Foreground(lipgloss.Color("8")).Strikethrough(true) // grey, struck out
+			}
+			label := id
+			running := m.state[id] == pipeline.StatusStart || m.state[id] == pipeline.StatusRetry
+			if p, ok := m.shards[id]; ok && running {
+				lines := 0
+				for _, n := range p.lines {
+					lines += n
+				}
+				label = fmt.Sprintf("%s %d/%d %d lines", id, p.done, p.total, lines)
+			} else if c, ok := m.counts[id]; ok && running {
+				label = fmt.Sprintf("%s %d lines %s", id, c.OutLines, c.Elapsed.Round(time.Second))
 			}
-			out += style.Render(id)
+			out += style.Render(label)
 			if j != len(cat.Tools)-1 {
 				out += ","
 			}
@@ -0,0 +1,287 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/MKlolbullen/termaid/internal/pipeline"
+)
+
+/* ────────────────── Multi-Target Progress Model ─────────────── */
+
+// targetsModel shows a run over several targets as one row per target:
+// state, nodes settled out of the workflow's total and what is running now.
+type targetsModel struct {
+	targets  []string
+	rows     map[string]*targetRow
+	nodes    int // tool nodes per target
+	parallel int // targets running at once
+
+	log     *logTail
+	vp      viewport.Model
+	showLog bool
+
+	statusCh <-chan pipeline.Status
+	ctl      *pipeline.Controller
+	done     bool
+}
+
+type targetRow struct {
+	runID   string
+	started bool
+	result  pipeline.RunStatus // set once the target's run ended
+	settled int                // nodes finished, failed, skipped or reused
+	failed  int
+	running map[string]bool
+}
+
+func newTargetsModel(targets []string, nodes, parallel int, ch <-chan pipeline.Status, ctl *pipeline.Controller) targetsModel {
+	vp := viewport.New(0, 10) // width set later
+	vp.SetContent("")
+
+	rows := make(map[string]*targetRow, len(targets))
+	for _, t := range targets {
+		rows[t] = &targetRow{running: make(map[string]bool)}
+	}
+
+	return targetsModel{
+		targets:  targets,
+		rows:     rows,
+		nodes:    nodes,
+		parallel: parallel,
+		vp:       vp,
+		statusCh: ch,
+		ctl:      ctl,
+		log:      newLogTail(fmt.Sprintf("run-%d.log", time.Now().Unix())),
+	}
+}
+
+func (m targetsModel) Init() tea.Cmd {
+	return tea.Batch(waitStatus(m.statusCh), viewport.Sync(m.vp))
+}
+
+func (m targetsModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch v := msg.(type) {
+
+	case pipeline.Status:
+		row := m.rows[v.Target]
+		if row != nil {
+			row.track(v)
+		}
+
+		switch v.Type {
+		case pipeline.StatusOutput:
+			m.writeOutput(v)
+			return m, waitStatus(m.statusCh)
+		case pipeline.StatusProgress:
+			return m, waitStatus(m.statusCh)
+		}
+
+		line := fmt.Sprintf("[%s] %-15s %s", v.Target, v.Tool, statusWord(v))
+		if v.Err != nil {
+			line += ": " + v.Err.Error()
+		}
+		switch v.Type {
+		case pipeline.StatusError, pipeline.StatusTimeout:
+			line = lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Render(line)
+		case pipeline.StatusTargetStart, pipeline.StatusTargetDone:
+			line = lipgloss.NewStyle().Bold(true).Render(line)
+		}
+		m.log.add(line)
+		m.vp.SetContent(m.log.String())
+		m.vp.GotoBottom()
+		return m, waitStatus(m.statusCh)
+
+	case doneMsg:
+		m.done = true
+		m.flushLog()
+		return m, nil
+
+	case tea.KeyMsg:
+		switch v.String() {
+		case "q", "ctrl+c":
+			if !m.done {
+				m.ctl.Stop()
+				m.flushLog()
+			}
+			return m, tea.Quit
+		case "p", "P":
+			if m.done {
+				break
+			}
+			if m.ctl.Paused() {
+				m.ctl.Resume()
+				m.notef("[run] resumed")
+			} else {
+				m.ctl.Pause(v.String() == "P")
+				m.notef("[run] paused")
+			}
+		case "s":
+			if !m.done {
+				m.ctl.Stop()
+				m.notef("[run] stopping")
+			}
+		case "tab":
+			m.showLog = !m.showLog
+		}
+		if m.showLog {
+			var cmd tea.Cmd
+			m.vp, cmd = m.vp.Update(msg)
+			return m, cmd
+		}
+	}
+	return m, nil
+}
+
+// track folds one event of the target's run into its row.
+func (r *targetRow) track(st pipeline.Status) {
+	switch st.Type {
+	case pipeline.StatusTargetStart:
+		r.started, r.runID = true, st.RunID
+	case pipeline.StatusTargetDone:
+		r.started, r.result = true, st.Result
+		if r.result == "" {
+			r.result = pipeline.RunFailed
+		}
+		clear(r.running)
+	case pipeline.StatusStart:
+		r.running[st.Tool] = true
+	case pipeline.StatusFinish, pipeline.StatusReused, pipeline.StatusCached, pipeline.StatusSkipped:
+		r.settled++
+		delete(r.running, st.Tool)
+	case pipeline.StatusError, pipeline.StatusTimeout:
+		r.settled++
+		r.failed++
+		delete(r.running, st.Tool)
+	}
+}
+
+func (m targetsModel) View() string {
+	table := m.renderTargets()
+
+	if m.vp.Width == 0 {
+		m.vp.Width = lipgloss.Width(table)
+	}
+
+	footer := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("8")).
+		Render("[tab] logs • [p] pause/resume • [P] pause + freeze tools • [s] stop • [q] quit")
+
+	if m.showLog {
+		title := lipgloss.NewStyle().Bold(true).Render("Live Output (↑/↓ PgUp/PgDn)")
+		return table + "\n" + title + "\n" + m.vp.View() + "\n" + footer
+	}
+	return table + "\n" + footer
+}
+
+func (m targetsModel) renderTargets() string {
+	var queued, running, finished int
+	for _, t := range m.targets {
+		switch r := m.rows[t]; {
+		case r.result != "":
+			finished++
+		case r.started:
+			running++
+		default:
+			queued++
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(lipgloss.NewStyle().Bold(true).Render(
+		fmt.Sprintf("Targets: %d running • %d queued • %d finished (%d at once)",
+			running, queued, finished, m.parallel)) + "\n\n")
+
+	width := 6
+	for _, t := range m.targets {
+		width = max(width, len(t))
+	}
+
+	for _, t := range m.targets {
+		r := m.rows[t]
+
+		word, color := "queued", lipgloss.Color("8")
+		switch {
+		case r.result == pipeline.RunSucceeded:
+			word, color = string(r.result), lipgloss.Color("10")
+		case r.result == pipeline.RunPartial:
+			word, color = string(r.result), lipgloss.Color("208")
+		case r.result == pipeline.RunCancelled:
+			word, color = string(r.result), lipgloss.Color("8")
+		case r.result != "":
+			word, color = string(r.result), lipgloss.Color("9")
+		case r.started:
+			word, color = "running", lipgloss.Color("11")
+		}
+
+		var active []string
+		for id := range r.running {
+			active = append(active, id)
+		}
+		sort.Strings(active)
+
+		detail := strings.Join(active, ", ")
+		if r.failed > 0 {
+			detail = strings.TrimSpace(fmt.Sprintf("%d failed  %s", r.failed, detail))
+		}
+
+		fmt.Fprintf(&b, "%-*s  %s  %s %3d/%-3d  %s\n",
+			width, t,
+			lipgloss.NewStyle().Foreground(color).Width(9).Render(word),
+			progressBar(r.settled, m.nodes, 16),
+			r.settled, m.nodes,
+			lipgloss.NewStyle().Foreground(lipgloss.Color("8")).Render(detail))
+	}
+
+	return b.String()
+}
+
+// progressBar draws done out of total as a bar width cells wide.
+func progressBar(done, total, width int) string {
+	filled := 0
+	if total > 0 {
+		filled = min(done*width/total, width)
+	}
+	return lipgloss.NewStyle().Foreground(lipgloss.Color("10")).Render(strings.Repeat("█", filled)) +
+		lipgloss.NewStyle().Foreground(lipgloss.Color("8")).Render(strings.Repeat("░", width-filled))
+}
+
+// writeOutput appends a batch of tool output to the log, dimmed and prefixed
+// with the target and node it came from.
+func (m *targetsModel) writeOutput(st pipeline.Status) {
+	prefix := st.Target + "/" + st.Tool
+	if st.Shard > 0 {
+		prefix = fmt.Sprintf("%s#%d", prefix, st.Shard)
+	}
+	color := lipgloss.Color("8")
+	if st.Stream == "stderr" {
+		color = lipgloss.Color("3")
+	}
+	style := lipgloss.NewStyle().Foreground(color)
+
+	for _, l := range st.Lines {
+		m.log.add(style.Render(fmt.Sprintf("  %s │ %s", prefix, l)))
+	}
+	if st.Dropped > 0 {
+		m.log.add(style.Render(fmt.Sprintf("  %s │ … %d more %s lines", prefix, st.Dropped, st.Stream)))
+	}
+	m.vp.SetContent(m.log.String())
+	m.vp.GotoBottom()
+}
+
+// notef writes a dimmed informational line to the log.
+func (m *targetsModel) notef(format string, args ...any) {
+	line := lipgloss.NewStyle().Foreground(lipgloss.Color("8")).Render(fmt.Sprintf(format, args...))
+	m.log.add(line)
+	m.vp.SetContent(m.log.String())
+}
+
+func (m targetsModel) flushLog() {
+	m.log.flush()
+}
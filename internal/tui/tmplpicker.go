@@ -4,7 +4,6 @@ import (
 	"path/filepath"
 
 	"github.com/charmbracelet/bubbles/list"
-	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
@@ -37,10 +36,7 @@ func (m tmplPicker) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		if v.String() == "enter" {
 			selected := m.list.SelectedItem().(entryItem).desc // file path
-			domInput := textinput.New()
-			domInput.Placeholder = "target.com"
-			domInput.Focus()
-			return domainPrompt{input: domInput, template: selected}, nil
+			return newDomainPrompt(selected), nil
 		}
 	}
 	var cmd tea.Cmd